@@ -4,13 +4,17 @@ package ast
 
 import (
 	"bytes"
+	"math/big"
 	"mira/token"
+	"sort"
 	"strings"
 )
 
 type Node interface {
 	TokenLiteral() string
 	String() string
+	Pos() token.Position // Position of the first character of the node
+	End() token.Position // Position immediately after the node
 }
 
 type Statement interface {
@@ -25,6 +29,7 @@ type Expression interface {
 
 type Program struct {
 	Statements []Statement
+	Comments   []*CommentGroup // Every comment in the source, in order
 }
 
 func (p *Program) TokenLiteral() string {
@@ -35,6 +40,20 @@ func (p *Program) TokenLiteral() string {
 	}
 }
 
+func (p *Program) Pos() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[0].Pos()
+	}
+	return token.Position{}
+}
+
+func (p *Program) End() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[len(p.Statements)-1].End()
+	}
+	return token.Position{}
+}
+
 func (p *Program) String() string {
 	var out bytes.Buffer
 
@@ -48,21 +67,79 @@ func (p *Program) String() string {
 type ExpressionStatement struct {
 	Expression Expression
 	Token      token.Token
+	Trivia
 }
 
 type LetStatement struct {
 	Value Expression
 	Name  *Identifier
 	Token token.Token
+	Trivia
+}
+
+// FunctionStatement declares a function, `fn name(params) { ... }`. The
+// name is bound when the enclosing block starts, so declarations in the
+// same block can call each other regardless of their order.
+type FunctionStatement struct {
+	Name     *Identifier
+	Function *FunctionLiteral
+	Token    token.Token
+	Trivia
+}
+
+// AssignStatement stores Value in Target, a variable or an element of an
+// array or hash. Operator is "=", or a compound operator such as "+=" that
+// combines the current value of Target with Value.
+type AssignStatement struct {
+	Target   Expression
+	Value    Expression
+	Token    token.Token // The operator token
+	Operator string
+	Trivia
 }
 
 type ReturnStatement struct {
 	ReturnValue Expression
 	Token       token.Token
+	Trivia
+}
+
+// WhileStatement runs Body for as long as Condition is truthy.
+type WhileStatement struct {
+	Condition Expression
+	Body      *BlockStatement
+	Token     token.Token
+	Trivia
+}
+
+// ForStatement runs Body once for each element of Iterable. Value is bound
+// to the element, or to the key of a hash entry; with two variables, Key is
+// bound to the index or key and Value to the element or entry value.
+type ForStatement struct {
+	Key      *Identifier // nil when the loop has a single variable
+	Value    *Identifier
+	Iterable Expression
+	Body     *BlockStatement
+	Token    token.Token
+	Trivia
+}
+
+// BreakStatement leaves the innermost enclosing loop.
+type BreakStatement struct {
+	Token token.Token
+	Trivia
+}
+
+// ContinueStatement skips to the next iteration of the innermost
+// enclosing loop.
+type ContinueStatement struct {
+	Token token.Token
+	Trivia
 }
 
 type BlockStatement struct {
 	Token      token.Token
+	Rbrace     token.Token
 	Statements []Statement
 }
 
@@ -74,6 +151,12 @@ type Identifier struct {
 type IntegerLiteral struct {
 	Token token.Token
 	Value int64
+	Big   *big.Int // Set instead of Value when the literal overflows an int64
+}
+
+type FloatLiteral struct {
+	Token token.Token
+	Value float64
 }
 
 type StringLiteral struct {
@@ -81,8 +164,17 @@ type StringLiteral struct {
 	Value string
 }
 
+// InterpolatedString is a string literal with embedded ${...} expressions.
+// Parts alternates between *StringLiteral text and embedded expressions.
+type InterpolatedString struct {
+	Token token.Token // The INTERP_HEAD token
+	Tail  token.Token // The INTERP_TAIL token
+	Parts []Expression
+}
+
 type ArrayLiteral struct {
 	Token    token.Token
+	Rbracket token.Token
 	Elements []Expression
 }
 
@@ -106,9 +198,10 @@ type InfixExpression struct {
 }
 
 type IndexExpression struct {
-	Left  Expression
-	Index Expression
-	Token token.Token
+	Left     Expression
+	Index    Expression
+	Token    token.Token
+	Rbracket token.Token
 }
 
 type Bool struct {
@@ -125,12 +218,17 @@ type IfExpression struct {
 
 type CallExpression struct {
 	Token     token.Token
+	Rparen    token.Token
 	Function  Expression
 	Arguments []Expression
 }
 
 func (es *ExpressionStatement) statementNode()       {}
 func (es *ExpressionStatement) TokenLiteral() string { return es.Token.Literal }
+func (es *ExpressionStatement) Pos() token.Position  { return es.Token.Pos }
+func (es *ExpressionStatement) End() token.Position {
+	return endOf(es.Expression, es.Token.End)
+}
 func (es *ExpressionStatement) String() string {
 	if es.Expression != nil {
 		return es.Expression.String()
@@ -141,6 +239,13 @@ func (es *ExpressionStatement) String() string {
 
 func (ls *LetStatement) statementNode()       {}
 func (ls *LetStatement) TokenLiteral() string { return ls.Token.Literal }
+func (ls *LetStatement) Pos() token.Position  { return ls.Token.Pos }
+func (ls *LetStatement) End() token.Position {
+	if ls.Name != nil {
+		return endOf(ls.Value, ls.Name.End())
+	}
+	return endOf(ls.Value, ls.Token.End)
+}
 func (ls *LetStatement) String() string {
 	var out bytes.Buffer
 
@@ -157,8 +262,65 @@ func (ls *LetStatement) String() string {
 	return out.String()
 }
 
+func (fs *FunctionStatement) statementNode()       {}
+func (fs *FunctionStatement) TokenLiteral() string { return fs.Token.Literal }
+func (fs *FunctionStatement) Pos() token.Position  { return fs.Token.Pos }
+func (fs *FunctionStatement) End() token.Position {
+	if fs.Function != nil {
+		return fs.Function.End()
+	}
+	if fs.Name != nil {
+		return fs.Name.End()
+	}
+	return fs.Token.End
+}
+func (fs *FunctionStatement) String() string {
+	var out bytes.Buffer
+
+	params := []string{}
+	for _, param := range fs.Function.Parameters {
+		params = append(params, param.String())
+	}
+
+	out.WriteString("fn ")
+	out.WriteString(fs.Name.String())
+	out.WriteString("(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") ")
+	out.WriteString(fs.Function.Body.String())
+
+	return out.String()
+}
+
+func (as *AssignStatement) statementNode()       {}
+func (as *AssignStatement) TokenLiteral() string { return as.Token.Literal }
+func (as *AssignStatement) Pos() token.Position {
+	return posOf(as.Target, as.Token.Pos)
+}
+func (as *AssignStatement) End() token.Position {
+	return endOf(as.Value, as.Token.End)
+}
+func (as *AssignStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(as.Target.String())
+	out.WriteString(" " + as.Operator + " ")
+
+	if as.Value != nil {
+		out.WriteString(as.Value.String())
+	}
+
+	out.WriteString(";")
+
+	return out.String()
+}
+
 func (rs *ReturnStatement) statementNode()       {}
 func (rs *ReturnStatement) TokenLiteral() string { return rs.Token.Literal }
+func (rs *ReturnStatement) Pos() token.Position  { return rs.Token.Pos }
+func (rs *ReturnStatement) End() token.Position {
+	return endOf(rs.ReturnValue, rs.Token.End)
+}
 func (rs *ReturnStatement) String() string {
 	var out bytes.Buffer
 
@@ -173,8 +335,75 @@ func (rs *ReturnStatement) String() string {
 	return out.String()
 }
 
+func (ws *WhileStatement) statementNode()       {}
+func (ws *WhileStatement) TokenLiteral() string { return ws.Token.Literal }
+func (ws *WhileStatement) Pos() token.Position  { return ws.Token.Pos }
+func (ws *WhileStatement) End() token.Position {
+	if ws.Body != nil {
+		return ws.Body.End()
+	}
+	return endOf(ws.Condition, ws.Token.End)
+}
+func (ws *WhileStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("while")
+	out.WriteString(ws.Condition.String())
+	out.WriteString(" ")
+	out.WriteString(ws.Body.String())
+
+	return out.String()
+}
+
+func (fs *ForStatement) statementNode()       {}
+func (fs *ForStatement) TokenLiteral() string { return fs.Token.Literal }
+func (fs *ForStatement) Pos() token.Position  { return fs.Token.Pos }
+func (fs *ForStatement) End() token.Position {
+	if fs.Body != nil {
+		return fs.Body.End()
+	}
+	return endOf(fs.Iterable, fs.Token.End)
+}
+func (fs *ForStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("for (")
+	if fs.Key != nil {
+		out.WriteString(fs.Key.String() + ", ")
+	}
+	out.WriteString(fs.Value.String())
+	out.WriteString(" in ")
+	out.WriteString(fs.Iterable.String())
+	out.WriteString(") ")
+	out.WriteString(fs.Body.String())
+
+	return out.String()
+}
+
+func (bs *BreakStatement) statementNode()       {}
+func (bs *BreakStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BreakStatement) Pos() token.Position  { return bs.Token.Pos }
+func (bs *BreakStatement) End() token.Position  { return bs.Token.End }
+func (bs *BreakStatement) String() string       { return "break;" }
+
+func (cs *ContinueStatement) statementNode()       {}
+func (cs *ContinueStatement) TokenLiteral() string { return cs.Token.Literal }
+func (cs *ContinueStatement) Pos() token.Position  { return cs.Token.Pos }
+func (cs *ContinueStatement) End() token.Position  { return cs.Token.End }
+func (cs *ContinueStatement) String() string       { return "continue;" }
+
 func (bs *BlockStatement) statementNode()       {}
 func (bs *BlockStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BlockStatement) Pos() token.Position  { return bs.Token.Pos }
+func (bs *BlockStatement) End() token.Position {
+	if bs.Rbrace.End.IsValid() {
+		return bs.Rbrace.End
+	}
+	if len(bs.Statements) > 0 {
+		return bs.Statements[len(bs.Statements)-1].End()
+	}
+	return bs.Token.End
+}
 func (bs *BlockStatement) String() string {
 	var out bytes.Buffer
 
@@ -187,20 +416,36 @@ func (bs *BlockStatement) String() string {
 
 func (i *Identifier) expressionNode()      {}
 func (i *Identifier) TokenLiteral() string { return i.Token.Literal }
+func (i *Identifier) Pos() token.Position  { return i.Token.Pos }
+func (i *Identifier) End() token.Position  { return i.Token.End }
 func (i *Identifier) String() string {
 	return i.Value
 }
 
 func (il *IntegerLiteral) expressionNode()      {}
 func (il *IntegerLiteral) TokenLiteral() string { return il.Token.Literal }
+func (il *IntegerLiteral) Pos() token.Position  { return il.Token.Pos }
+func (il *IntegerLiteral) End() token.Position  { return il.Token.End }
 func (il *IntegerLiteral) String() string       { return il.Token.Literal }
 
+func (fl *FloatLiteral) expressionNode()      {}
+func (fl *FloatLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FloatLiteral) Pos() token.Position  { return fl.Token.Pos }
+func (fl *FloatLiteral) End() token.Position  { return fl.Token.End }
+func (fl *FloatLiteral) String() string       { return fl.Token.Literal }
+
 func (sl *StringLiteral) expressionNode()      {}
 func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Literal }
+func (sl *StringLiteral) Pos() token.Position  { return sl.Token.Pos }
+func (sl *StringLiteral) End() token.Position  { return sl.Token.End }
 func (sl *StringLiteral) String() string       { return sl.Token.Literal }
 
 func (prefix *PrefixExpression) expressionNode()      {}
 func (prefix *PrefixExpression) TokenLiteral() string { return prefix.Token.Literal }
+func (prefix *PrefixExpression) Pos() token.Position  { return prefix.Token.Pos }
+func (prefix *PrefixExpression) End() token.Position {
+	return endOf(prefix.Right, prefix.Token.End)
+}
 func (prefix *PrefixExpression) String() string {
 	var out bytes.Buffer
 
@@ -214,6 +459,12 @@ func (prefix *PrefixExpression) String() string {
 
 func (infix *InfixExpression) expressionNode()      {}
 func (infix *InfixExpression) TokenLiteral() string { return infix.Token.Literal }
+func (infix *InfixExpression) Pos() token.Position {
+	return posOf(infix.Left, infix.Token.Pos)
+}
+func (infix *InfixExpression) End() token.Position {
+	return endOf(infix.Right, infix.Token.End)
+}
 func (infix *InfixExpression) String() string {
 	var out bytes.Buffer
 
@@ -228,10 +479,22 @@ func (infix *InfixExpression) String() string {
 
 func (b *Bool) expressionNode()      {}
 func (b *Bool) TokenLiteral() string { return b.Token.Literal }
+func (b *Bool) Pos() token.Position  { return b.Token.Pos }
+func (b *Bool) End() token.Position  { return b.Token.End }
 func (b *Bool) String() string       { return b.Token.Literal }
 
 func (ifExp *IfExpression) expressionNode()      {}
 func (ifExp *IfExpression) TokenLiteral() string { return ifExp.Token.Literal }
+func (ifExp *IfExpression) Pos() token.Position  { return ifExp.Token.Pos }
+func (ifExp *IfExpression) End() token.Position {
+	if ifExp.Else != nil {
+		return ifExp.Else.End()
+	}
+	if ifExp.Then != nil {
+		return ifExp.Then.End()
+	}
+	return endOf(ifExp.Condition, ifExp.Token.End)
+}
 func (ifExp *IfExpression) String() string {
 	var out bytes.Buffer
 
@@ -250,6 +513,13 @@ func (ifExp *IfExpression) String() string {
 
 func (fl *FunctionLiteral) expressionNode()      {}
 func (fl *FunctionLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FunctionLiteral) Pos() token.Position  { return fl.Token.Pos }
+func (fl *FunctionLiteral) End() token.Position {
+	if fl.Body != nil {
+		return fl.Body.End()
+	}
+	return fl.Token.End
+}
 func (fl *FunctionLiteral) String() string {
 	var out bytes.Buffer
 
@@ -268,6 +538,15 @@ func (fl *FunctionLiteral) String() string {
 
 func (ce *CallExpression) expressionNode()      {}
 func (ce *CallExpression) TokenLiteral() string { return ce.Token.Literal }
+func (ce *CallExpression) Pos() token.Position {
+	return posOf(ce.Function, ce.Token.Pos)
+}
+func (ce *CallExpression) End() token.Position {
+	if ce.Rparen.End.IsValid() {
+		return ce.Rparen.End
+	}
+	return ce.Token.End
+}
 func (ce *CallExpression) String() string {
 	var out bytes.Buffer
 
@@ -284,8 +563,37 @@ func (ce *CallExpression) String() string {
 	return out.String()
 }
 
+func (is *InterpolatedString) expressionNode()      {}
+func (is *InterpolatedString) TokenLiteral() string { return is.Token.Literal }
+func (is *InterpolatedString) Pos() token.Position  { return is.Token.Pos }
+func (is *InterpolatedString) End() token.Position  { return is.Tail.End }
+func (is *InterpolatedString) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(`"`)
+	for _, part := range is.Parts {
+		if text, ok := part.(*StringLiteral); ok {
+			out.WriteString(text.Value)
+			continue
+		}
+		out.WriteString("${")
+		out.WriteString(part.String())
+		out.WriteString("}")
+	}
+	out.WriteString(`"`)
+
+	return out.String()
+}
+
 func (al *ArrayLiteral) expressionNode()      {}
 func (al *ArrayLiteral) TokenLiteral() string { return al.Token.Literal }
+func (al *ArrayLiteral) Pos() token.Position  { return al.Token.Pos }
+func (al *ArrayLiteral) End() token.Position {
+	if al.Rbracket.End.IsValid() {
+		return al.Rbracket.End
+	}
+	return al.Token.End
+}
 func (al *ArrayLiteral) String() string {
 	var out bytes.Buffer
 
@@ -303,6 +611,15 @@ func (al *ArrayLiteral) String() string {
 
 func (ie *IndexExpression) expressionNode()      {}
 func (ie *IndexExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IndexExpression) Pos() token.Position {
+	return posOf(ie.Left, ie.Token.Pos)
+}
+func (ie *IndexExpression) End() token.Position {
+	if ie.Rbracket.End.IsValid() {
+		return ie.Rbracket.End
+	}
+	return endOf(ie.Index, ie.Token.End)
+}
 func (ie *IndexExpression) String() string {
 	var out bytes.Buffer
 
@@ -316,12 +633,33 @@ func (ie *IndexExpression) String() string {
 }
 
 type HashLiteral struct {
-	Pairs map[Expression]Expression
-	Token token.Token
+	Pairs  map[Expression]Expression
+	Token  token.Token
+	Rbrace token.Token
 }
 
 func (h *HashLiteral) expressionNode()      {}
 func (h *HashLiteral) TokenLiteral() string { return h.Token.Literal }
+func (h *HashLiteral) Pos() token.Position  { return h.Token.Pos }
+func (h *HashLiteral) End() token.Position {
+	if h.Rbrace.End.IsValid() {
+		return h.Rbrace.End
+	}
+	return h.Token.End
+}
+
+// Keys returns the keys of the literal in source order.
+func (h *HashLiteral) Keys() []Expression {
+	keys := make([]Expression, 0, len(h.Pairs))
+	for key := range h.Pairs {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].Pos().Offset < keys[j].Pos().Offset
+	})
+	return keys
+}
+
 func (h *HashLiteral) String() string {
 	var out bytes.Buffer
 
@@ -345,6 +683,13 @@ type MacroLiteral struct {
 
 func (ml *MacroLiteral) expressionNode()      {}
 func (ml *MacroLiteral) TokenLiteral() string { return ml.Token.Literal }
+func (ml *MacroLiteral) Pos() token.Position  { return ml.Token.Pos }
+func (ml *MacroLiteral) End() token.Position {
+	if ml.Body != nil {
+		return ml.Body.End()
+	}
+	return ml.Token.End
+}
 func (ml *MacroLiteral) String() string {
 	var out bytes.Buffer
 
@@ -361,3 +706,19 @@ func (ml *MacroLiteral) String() string {
 
 	return out.String()
 }
+
+// posOf returns the start of n, or fallback when n is missing.
+func posOf(n Node, fallback token.Position) token.Position {
+	if n == nil {
+		return fallback
+	}
+	return n.Pos()
+}
+
+// endOf returns the end of n, or fallback when n is missing.
+func endOf(n Node, fallback token.Position) token.Position {
+	if n == nil {
+		return fallback
+	}
+	return n.End()
+}
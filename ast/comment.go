@@ -0,0 +1,66 @@
+// ast/comment.go
+
+package ast
+
+import (
+	"mira/token"
+	"strings"
+)
+
+// A Comment is a single `//` or `/* */` comment. Comments are only present
+// in the AST when the lexer runs in lexer.ScanComments mode.
+type Comment struct {
+	Token token.Token
+}
+
+func (c *Comment) Pos() token.Position { return c.Token.Pos }
+func (c *Comment) End() token.Position { return c.Token.End }
+
+// Text returns the comment without its delimiters.
+func (c *Comment) Text() string {
+	text := c.Token.Literal
+	if strings.HasPrefix(text, "//") {
+		return strings.TrimPrefix(text[2:], " ")
+	}
+
+	text = strings.TrimPrefix(text, "/*")
+	text = strings.TrimSuffix(text, "*/")
+	return strings.TrimSpace(text)
+}
+
+// A CommentGroup is a run of comments with no tokens or blank lines
+// between them.
+type CommentGroup struct {
+	List []*Comment
+}
+
+func (g *CommentGroup) Pos() token.Position { return g.List[0].Pos() }
+func (g *CommentGroup) End() token.Position { return g.List[len(g.List)-1].End() }
+
+// Text returns the text of the group, one comment per line.
+func (g *CommentGroup) Text() string {
+	if g == nil {
+		return ""
+	}
+
+	lines := make([]string, 0, len(g.List))
+	for _, c := range g.List {
+		lines = append(lines, c.Text())
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// Trivia holds the comments the parser attached to a statement.
+type Trivia struct {
+	Doc     *CommentGroup // Comments on the lines directly above the statement
+	Comment *CommentGroup // Comment following the statement on its last line
+}
+
+func (t *Trivia) CommentTrivia() *Trivia { return t }
+
+// Commented is implemented by statements that can carry comments.
+type Commented interface {
+	Statement
+	CommentTrivia() *Trivia
+}
@@ -28,6 +28,10 @@ func TestModify(t *testing.T) {
 		expected Node
 	}{
 		{one(), two()},
+		{
+			&InterpolatedString{Parts: []Expression{&StringLiteral{Value: "a"}, one()}},
+			&InterpolatedString{Parts: []Expression{&StringLiteral{Value: "a"}, two()}},
+		},
 		{
 			&Program{
 				Statements: []Statement{
@@ -84,6 +88,24 @@ func TestModify(t *testing.T) {
 				},
 			},
 		},
+		{
+			&IfExpression{
+				Condition: one(),
+				Then: &BlockStatement{
+					Statements: []Statement{
+						&ExpressionStatement{Expression: one()},
+					},
+				},
+			},
+			&IfExpression{
+				Condition: two(),
+				Then: &BlockStatement{
+					Statements: []Statement{
+						&ExpressionStatement{Expression: two()},
+					},
+				},
+			},
+		},
 		{
 			&ReturnStatement{ReturnValue: one()},
 			&ReturnStatement{ReturnValue: two()},
@@ -114,6 +136,76 @@ func TestModify(t *testing.T) {
 			&ArrayLiteral{Elements: []Expression{one(), one()}},
 			&ArrayLiteral{Elements: []Expression{two(), two()}},
 		},
+		{
+			&AssignStatement{Target: &IndexExpression{Left: one(), Index: one()}, Operator: "+=", Value: one()},
+			&AssignStatement{Target: &IndexExpression{Left: two(), Index: two()}, Operator: "+=", Value: two()},
+		},
+		{
+			&WhileStatement{
+				Condition: one(),
+				Body: &BlockStatement{
+					Statements: []Statement{
+						&ExpressionStatement{Expression: one()},
+						&BreakStatement{},
+					},
+				},
+			},
+			&WhileStatement{
+				Condition: two(),
+				Body: &BlockStatement{
+					Statements: []Statement{
+						&ExpressionStatement{Expression: two()},
+						&BreakStatement{},
+					},
+				},
+			},
+		},
+		{
+			&ForStatement{
+				Value:    &Identifier{Value: "x"},
+				Iterable: &ArrayLiteral{Elements: []Expression{one()}},
+				Body: &BlockStatement{
+					Statements: []Statement{
+						&ExpressionStatement{Expression: one()},
+						&ContinueStatement{},
+					},
+				},
+			},
+			&ForStatement{
+				Value:    &Identifier{Value: "x"},
+				Iterable: &ArrayLiteral{Elements: []Expression{two()}},
+				Body: &BlockStatement{
+					Statements: []Statement{
+						&ExpressionStatement{Expression: two()},
+						&ContinueStatement{},
+					},
+				},
+			},
+		},
+		{
+			&FunctionStatement{
+				Name: &Identifier{Value: "f"},
+				Function: &FunctionLiteral{
+					Parameters: []*Identifier{},
+					Body: &BlockStatement{
+						Statements: []Statement{
+							&ExpressionStatement{Expression: one()},
+						},
+					},
+				},
+			},
+			&FunctionStatement{
+				Name: &Identifier{Value: "f"},
+				Function: &FunctionLiteral{
+					Parameters: []*Identifier{},
+					Body: &BlockStatement{
+						Statements: []Statement{
+							&ExpressionStatement{Expression: two()},
+						},
+					},
+				},
+			},
+		},
 	}
 	// Iterate over the test cases
 	for _, tt := range tests {
@@ -0,0 +1,111 @@
+// ast/walk.go
+
+package ast
+
+import "reflect"
+
+// Inspect traverses the AST in depth-first order, calling f for each node.
+// If f returns true, Inspect visits the node's children and then calls
+// f(nil). Hash literal pairs are visited in source order.
+func Inspect(node Node, f func(Node) bool) {
+	if node == nil || !f(node) {
+		return
+	}
+
+	for _, child := range children(node) {
+		Inspect(child, f)
+	}
+
+	f(nil)
+}
+
+// children returns the non-nil direct children of node in source order.
+func children(node Node) []Node {
+	var nodes []Node
+	add := func(n Node) {
+		if n != nil && !isNilNode(n) {
+			nodes = append(nodes, n)
+		}
+	}
+
+	switch node := node.(type) {
+	case *Program:
+		for _, s := range node.Statements {
+			add(s)
+		}
+	case *ExpressionStatement:
+		add(node.Expression)
+	case *LetStatement:
+		add(node.Name)
+		add(node.Value)
+	case *FunctionStatement:
+		add(node.Name)
+		add(node.Function)
+	case *AssignStatement:
+		add(node.Target)
+		add(node.Value)
+	case *ReturnStatement:
+		add(node.ReturnValue)
+	case *BlockStatement:
+		for _, s := range node.Statements {
+			add(s)
+		}
+	case *WhileStatement:
+		add(node.Condition)
+		add(node.Body)
+	case *ForStatement:
+		add(node.Key)
+		add(node.Value)
+		add(node.Iterable)
+		add(node.Body)
+	case *InterpolatedString:
+		for _, part := range node.Parts {
+			add(part)
+		}
+	case *ArrayLiteral:
+		for _, el := range node.Elements {
+			add(el)
+		}
+	case *FunctionLiteral:
+		for _, param := range node.Parameters {
+			add(param)
+		}
+		add(node.Body)
+	case *MacroLiteral:
+		for _, param := range node.Parameters {
+			add(param)
+		}
+		add(node.Body)
+	case *PrefixExpression:
+		add(node.Right)
+	case *InfixExpression:
+		add(node.Left)
+		add(node.Right)
+	case *IndexExpression:
+		add(node.Left)
+		add(node.Index)
+	case *IfExpression:
+		add(node.Condition)
+		add(node.Then)
+		add(node.Else)
+	case *CallExpression:
+		add(node.Function)
+		for _, arg := range node.Arguments {
+			add(arg)
+		}
+	case *HashLiteral:
+		for _, key := range node.Keys() {
+			add(key)
+			add(node.Pairs[key])
+		}
+	}
+
+	return nodes
+}
+
+// isNilNode reports whether n holds a typed nil pointer, as left behind by
+// optional fields such as IfExpression.Else.
+func isNilNode(n Node) bool {
+	v := reflect.ValueOf(n)
+	return v.Kind() == reflect.Pointer && v.IsNil()
+}
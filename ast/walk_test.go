@@ -0,0 +1,61 @@
+package ast
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestInspect(t *testing.T) {
+	program := &Program{
+		Statements: []Statement{
+			&LetStatement{
+				Name: &Identifier{Value: "x"},
+				Value: &IfExpression{
+					Condition: &Bool{Value: true},
+					Then: &BlockStatement{Statements: []Statement{
+						&ExpressionStatement{Expression: &InfixExpression{
+							Left:     &IntegerLiteral{Value: 1},
+							Operator: "+",
+							Right:    &IntegerLiteral{Value: 2},
+						}},
+					}},
+				},
+			},
+		},
+	}
+
+	var visited []string
+	depth := 0
+	Inspect(program, func(n Node) bool {
+		if n == nil {
+			depth--
+			return false
+		}
+		visited = append(visited, fmt.Sprintf("%s%T", strings.Repeat(".", depth), n))
+		depth++
+		return true
+	})
+
+	expected := []string{
+		"*ast.Program",
+		".*ast.LetStatement",
+		"..*ast.Identifier",
+		"..*ast.IfExpression",
+		"...*ast.Bool",
+		"...*ast.BlockStatement",
+		"....*ast.ExpressionStatement",
+		".....*ast.InfixExpression",
+		"......*ast.IntegerLiteral",
+		"......*ast.IntegerLiteral",
+	}
+
+	if strings.Join(visited, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("wrong traversal. expected=\n%s\ngot=\n%s",
+			strings.Join(expected, "\n"), strings.Join(visited, "\n"))
+	}
+
+	if depth != 0 {
+		t.Errorf("f(nil) not called once per visited node. depth=%d", depth)
+	}
+}
@@ -0,0 +1,364 @@
+// cmd/mira/main.go
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"mira/ast"
+	"mira/compiler"
+	"mira/evaluator"
+	"mira/lexer"
+	"mira/object"
+	"mira/parser"
+	"mira/repl"
+	"mira/vm"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+)
+
+// INFO: Exit codes, following the BSD sysexits conventions. Like
+// EX_DATAERR, 65 covers all bad input, so a script that fails to parse and
+// a compiled module that is corrupt exit with the same code; the message on
+// standard error tells them apart.
+const (
+	exitOK           = 0
+	exitUsage        = 64 // Bad command line
+	exitSyntaxError  = 65 // The program failed to parse or compile
+	exitDataError    = 65 // A compiled module is corrupt
+	exitNoInput      = 66 // The script file could not be read
+	exitRuntimeError = 70 // The program raised an error
+	exitCantCreate   = 73 // The output file could not be written
+)
+
+// compiledExt is the extension mira build gives compiled modules.
+const compiledExt = ".mirc"
+
+const usage = `Usage:
+  mira [file [args...]]                    run a script, or start the REPL without one
+  mira run [-engine e] <file> [args...]    run a script
+  mira eval [-engine e] -e <expr> [args...]
+                                           evaluate an expression and print its value
+  mira repl [-engine e]                    start the interactive REPL
+  mira build [-o out] <file>               compile a script to a module file
+  mira disasm <file>                       list the bytecode of a script or module
+
+The engine is "eval", which walks the syntax tree, or "vm", which compiles
+to bytecode first. Both give the same results; the default is eval.
+Compiled modules are run with mira run, always on the vm engine.
+Script arguments are available to programs as the array ` + "`args`" + `.
+`
+
+// Values of the -engine flag.
+const (
+	engineEval = "eval"
+	engineVM   = "vm"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run executes the command line args and returns the process exit code.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		return startRepl(engineEval, stdin, stdout)
+	}
+
+	switch args[0] {
+	case "run":
+		flags, engine := newFlagSet("run", stderr)
+		if err := flags.Parse(args[1:]); err != nil {
+			return exitUsage
+		}
+		if !validEngine(*engine, stderr) {
+			return exitUsage
+		}
+		if flags.NArg() == 0 {
+			fmt.Fprint(stderr, "mira run: missing file\n\n", usage)
+			return exitUsage
+		}
+		exec := object.NewExecContext(stdin, stdout, stderr)
+		return runFile(flags.Arg(0), flags.Args()[1:], *engine, exec)
+	case "eval":
+		return runEval(args[1:], object.NewExecContext(stdin, stdout, stderr))
+	case "repl":
+		flags, engine := newFlagSet("repl", stderr)
+		if err := flags.Parse(args[1:]); err != nil {
+			return exitUsage
+		}
+		if !validEngine(*engine, stderr) {
+			return exitUsage
+		}
+		return startRepl(*engine, stdin, stdout)
+	case "build":
+		return runBuild(args[1:], stderr)
+	case "disasm":
+		return runDisasm(args[1:], stdout, stderr)
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(stdout, usage)
+		return exitOK
+	default:
+		// Allows "#!/usr/bin/env mira" scripts.
+		exec := object.NewExecContext(stdin, stdout, stderr)
+		return runFile(args[0], args[1:], engineEval, exec)
+	}
+}
+
+// newFlagSet returns the flags of a subcommand, which all take -engine.
+func newFlagSet(name string, stderr io.Writer) (*flag.FlagSet, *string) {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	engine := flags.String("engine", engineEval, "execution engine, eval or vm")
+	return flags, engine
+}
+
+func validEngine(engine string, stderr io.Writer) bool {
+	if engine != engineEval && engine != engineVM {
+		fmt.Fprintf(stderr, "mira: unknown engine %q, want eval or vm\n", engine)
+		return false
+	}
+	return true
+}
+
+func startRepl(engine string, stdin io.Reader, stdout io.Writer) int {
+	if user, err := user.Current(); err == nil {
+		fmt.Fprintf(stdout, "Hello %s! This is the Mira REPL!\n", user.Username)
+	}
+	fmt.Fprintf(stdout, "You can get started by typing some commands.\n")
+	if engine == engineVM {
+		repl.Start(stdin, stdout, repl.VM)
+	} else {
+		repl.Start(stdin, stdout, repl.Evaluator)
+	}
+
+	return exitOK
+}
+
+// runFile runs a script or compiled module with the standard streams of
+// exec.
+func runFile(filename string, args []string, engine string, exec *object.ExecContext) int {
+	source, err := os.ReadFile(filename)
+	if err != nil {
+		fmt.Fprintf(exec.Stderr, "mira: %s\n", err)
+		return exitNoInput
+	}
+
+	// Compiled modules always run on the VM.
+	if compiler.IsBytecode(source) {
+		bytecode, err := compiler.ReadBytecode(bytes.NewReader(source))
+		if err != nil {
+			fmt.Fprintf(exec.Stderr, "mira: %s: %s\n", filename, err)
+			return exitDataError
+		}
+		_, code := report(runBytecode(bytecode, args, exec), exec.Stderr)
+		return code
+	}
+
+	_, code := execute(filename, string(source), args, engine, exec)
+	return code
+}
+
+func runEval(args []string, exec *object.ExecContext) int {
+	stdout, stderr := exec.Stdout, exec.Stderr
+	flags, engine := newFlagSet("eval", stderr)
+	expr := flags.String("e", "", "expression to evaluate")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if !validEngine(*engine, stderr) {
+		return exitUsage
+	}
+
+	if *expr == "" {
+		fmt.Fprint(stderr, "mira eval: missing -e <expr>\n\n", usage)
+		return exitUsage
+	}
+
+	result, code := execute("<eval>", *expr, flags.Args(), *engine, exec)
+	if code == exitOK && result != nil && result != object.NULL {
+		fmt.Fprintln(stdout, result.Inspect())
+	}
+
+	return code
+}
+
+func runBuild(args []string, stderr io.Writer) int {
+	flags := flag.NewFlagSet("build", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	output := flags.String("o", "", "output file (default: the input file with extension "+compiledExt+")")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() != 1 {
+		fmt.Fprint(stderr, "mira build: want exactly one file\n\n", usage)
+		return exitUsage
+	}
+
+	filename := flags.Arg(0)
+	source, err := os.ReadFile(filename)
+	if err != nil {
+		fmt.Fprintf(stderr, "mira: %s\n", err)
+		return exitNoInput
+	}
+
+	bytecode, code := compile(filename, string(source), stderr)
+	if bytecode == nil {
+		return code
+	}
+
+	if *output == "" {
+		*output = strings.TrimSuffix(filename, filepath.Ext(filename)) + compiledExt
+	}
+
+	var out bytes.Buffer
+	if _, err := bytecode.WriteTo(&out); err != nil {
+		fmt.Fprintf(stderr, "mira: %s\n", err)
+		return exitCantCreate
+	}
+	if err := os.WriteFile(*output, out.Bytes(), 0o644); err != nil {
+		fmt.Fprintf(stderr, "mira: %s\n", err)
+		return exitCantCreate
+	}
+
+	return exitOK
+}
+
+func runDisasm(args []string, stdout, stderr io.Writer) int {
+	if len(args) != 1 {
+		fmt.Fprint(stderr, "mira disasm: want exactly one file\n\n", usage)
+		return exitUsage
+	}
+
+	filename := args[0]
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		fmt.Fprintf(stderr, "mira: %s\n", err)
+		return exitNoInput
+	}
+
+	var bytecode *compiler.Bytecode
+	source := string(data)
+	if compiler.IsBytecode(data) {
+		if bytecode, err = compiler.ReadBytecode(bytes.NewReader(data)); err != nil {
+			fmt.Fprintf(stderr, "mira: %s: %s\n", filename, err)
+			return exitDataError
+		}
+
+		// Show the source lines if the module's source is still around.
+		source = ""
+		if data, err := os.ReadFile(bytecode.Main.Positions.Filename()); err == nil {
+			source = string(data)
+		}
+	} else {
+		var code int
+		if bytecode, code = compile(filename, source, stderr); bytecode == nil {
+			return code
+		}
+	}
+
+	if err := compiler.Disassemble(stdout, bytecode, source); err != nil {
+		fmt.Fprintf(stderr, "mira: %s\n", err)
+		return exitCantCreate
+	}
+	return exitOK
+}
+
+// parse parses source and expands its macros, reporting syntax errors to
+// stderr.
+func parse(filename, source string, stderr io.Writer) (ast.Node, bool) {
+	p := parser.New(lexer.NewFile(filename, source))
+	program := p.ParseProgram()
+
+	if diagnostics := p.Diagnostics(); len(diagnostics) != 0 {
+		for _, d := range diagnostics {
+			io.WriteString(stderr, d.Render(source))
+		}
+		return nil, false
+	}
+
+	macroEnv := object.NewEnv()
+	evaluator.DefineMacros(program, macroEnv)
+	return evaluator.ExpandMacros(program, macroEnv), true
+}
+
+// compile parses and compiles source. It returns nil bytecode and an exit
+// code if that fails.
+func compile(filename, source string, stderr io.Writer) (*compiler.Bytecode, int) {
+	program, ok := parse(filename, source, stderr)
+	if !ok {
+		return nil, exitSyntaxError
+	}
+
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		fmt.Fprintf(stderr, "mira: %s\n", err)
+		return nil, exitSyntaxError
+	}
+
+	return comp.Bytecode(), exitOK
+}
+
+// execute parses and runs source on engine with args bound as `args` and
+// the standard streams of exec, reporting any errors to its stderr.
+func execute(filename, source string, args []string, engine string, exec *object.ExecContext) (object.Object, int) {
+	if engine == engineVM {
+		bytecode, code := compile(filename, source, exec.Stderr)
+		if bytecode == nil {
+			return nil, code
+		}
+		return report(runBytecode(bytecode, args, exec), exec.Stderr)
+	}
+
+	program, ok := parse(filename, source, exec.Stderr)
+	if !ok {
+		return nil, exitSyntaxError
+	}
+
+	env := object.NewEnv()
+	env.Set("args", scriptArgs(args))
+	c := evaluator.NewContext()
+	c.SetExecContext(exec)
+	return report(c.Eval(program, env), exec.Stderr)
+}
+
+// runBytecode runs bytecode on the VM with the global `args` bound to args.
+func runBytecode(bytecode *compiler.Bytecode, args []string, exec *object.ExecContext) object.Object {
+	globals := make([]object.Object, vm.GlobalsSize)
+	for i, name := range bytecode.Globals {
+		if name == "args" {
+			globals[i] = scriptArgs(args)
+		}
+	}
+
+	machine := vm.NewWithGlobalsStore(bytecode, globals)
+	machine.SetExecContext(exec)
+	return machine.Run()
+}
+
+// report prints a runtime error and its stack trace to stderr, returning
+// the exit code for result.
+func report(result object.Object, stderr io.Writer) (object.Object, int) {
+	if err, ok := result.(*object.Error); ok {
+		fmt.Fprintln(stderr, err.Inspect())
+		if len(err.Stack) > 1 {
+			io.WriteString(stderr, err.StackTrace())
+		}
+		return result, exitRuntimeError
+	}
+
+	return result, exitOK
+}
+
+func scriptArgs(args []string) *object.Array {
+	elements := make([]object.Object, len(args))
+	for i, arg := range args {
+		elements[i] = &object.String{Value: arg}
+	}
+
+	return &object.Array{Elements: elements}
+}
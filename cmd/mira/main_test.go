@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunCommands(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, source string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(source), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	ok := write("ok.mira", "#!/usr/bin/env mira\nlet x = len(args);\nx")
+	syntax := write("syntax.mira", "let x = ;")
+	runtime := write("runtime.mira", "let f = fn() { 1 + true };\nf();")
+
+	tests := []struct {
+		args           []string
+		expectedCode   int
+		expectedStdout string
+		expectedStderr string
+	}{
+		{[]string{"run", ok, "a", "b"}, exitOK, "", ""},
+		{[]string{ok}, exitOK, "", ""},
+		{[]string{"run", syntax}, exitSyntaxError, "", syntax + ":1:9: error[E0002]: expected an expression, found ;"},
+		{[]string{"run", runtime}, exitRuntimeError, "", "ERROR: " + runtime + ":1:16: type mismatch: INTEGER + BOOL"},
+		{[]string{"run", filepath.Join(dir, "missing.mira")}, exitNoInput, "", "no such file or directory"},
+		{[]string{"run"}, exitUsage, "", "missing file"},
+		{[]string{"eval", "-e", "1 + 2"}, exitOK, "3\n", ""},
+		{[]string{"eval", "-e", "args", "x", "y"}, exitOK, "[x, y]\n", ""},
+		{[]string{"eval", "-e", "let a = 1;"}, exitOK, "", ""},
+		{[]string{"eval", "-e", "-true"}, exitRuntimeError, "", "ERROR: <eval>:1:1: unknown operator: -BOOL"},
+		{[]string{"eval"}, exitUsage, "", "missing -e"},
+		{[]string{"help"}, exitOK, "Usage:", ""},
+		{[]string{"run", "-engine=vm", ok, "a"}, exitOK, "", ""},
+		{[]string{"run", "-engine=vm", runtime}, exitRuntimeError, "", "ERROR: " + runtime + ":1:16: type mismatch: INTEGER + BOOL\nf\n\t"},
+		{[]string{"eval", "-engine=vm", "-e", "len(args) * 10", "x", "y"}, exitOK, "20\n", ""},
+		{[]string{"eval", "-engine=vm", "-e", "if (true) { 1 }"}, exitOK, "1\n", ""},
+		{[]string{"eval", "-engine=vm", "-e", "quote(1)"}, exitSyntaxError, "", "quote is only supported by the evaluator"},
+		{[]string{"eval", "-engine=jit", "-e", "1"}, exitUsage, "", "unknown engine"},
+		{[]string{"eval", "-e", "if (true) { 1 }"}, exitOK, "1\n", ""},
+	}
+
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+		code := run(tt.args, strings.NewReader(""), &stdout, &stderr)
+
+		if code != tt.expectedCode {
+			t.Errorf("%q: wrong exit code. expected=%d, got=%d (stderr: %q)", tt.args, tt.expectedCode, code, stderr.String())
+		}
+		if !strings.Contains(stdout.String(), tt.expectedStdout) || tt.expectedStdout == "" && stdout.Len() != 0 {
+			t.Errorf("%q: wrong stdout. expected=%q, got=%q", tt.args, tt.expectedStdout, stdout.String())
+		}
+		if !strings.Contains(stderr.String(), tt.expectedStderr) || tt.expectedStderr == "" && stderr.Len() != 0 {
+			t.Errorf("%q: wrong stderr. expected=%q, got=%q", tt.args, tt.expectedStderr, stderr.String())
+		}
+	}
+}
+
+func TestBuildAndDisasm(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "prog.mira")
+	source := "let f = fn(x) { x * 2 };\nlet r = f(len(args));\nif (r > 2) { 1 + true }\nr"
+	if err := os.WriteFile(script, []byte(source), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	module := filepath.Join(dir, "prog.mirc")
+	other := filepath.Join(dir, "other.out")
+	corrupt := filepath.Join(dir, "corrupt.mirc")
+	if err := os.WriteFile(corrupt, []byte("\x00MIRA\x01"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		args           []string
+		expectedCode   int
+		expectedStdout string
+		expectedStderr string
+	}{
+		{[]string{"build", script}, exitOK, "", ""},
+		{[]string{"run", module, "a"}, exitOK, "", ""},
+		{[]string{"run", module, "a", "b"}, exitRuntimeError, "", "ERROR: " + script + ":3:14: type mismatch: INTEGER + BOOL"},
+		{[]string{"build", "-o", other, script}, exitOK, "", ""},
+		{[]string{other, "a"}, exitOK, "", ""},
+		{[]string{"disasm", module}, exitOK, "     2 | let r = f(len(args));\n", ""},
+		{[]string{"disasm", script}, exitOK, "0010 2:11    OpGetBuiltin 0         len\n", ""},
+		{[]string{"run", corrupt}, exitDataError, "", "corrupt.mirc: corrupt bytecode: unexpected EOF"},
+		{[]string{"build", "-o", filepath.Join(dir, "missing", "x.mirc"), script}, exitCantCreate, "", "no such file or directory"},
+		{[]string{"build"}, exitUsage, "", "want exactly one file"},
+		{[]string{"disasm"}, exitUsage, "", "want exactly one file"},
+	}
+
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+		code := run(tt.args, strings.NewReader(""), &stdout, &stderr)
+
+		if code != tt.expectedCode {
+			t.Errorf("%q: wrong exit code. expected=%d, got=%d (stderr: %q)", tt.args, tt.expectedCode, code, stderr.String())
+		}
+		if !strings.Contains(stdout.String(), tt.expectedStdout) || tt.expectedStdout == "" && stdout.Len() != 0 {
+			t.Errorf("%q: wrong stdout. expected=%q, got=%q", tt.args, tt.expectedStdout, stdout.String())
+		}
+		if !strings.Contains(stderr.String(), tt.expectedStderr) || tt.expectedStderr == "" && stderr.Len() != 0 {
+			t.Errorf("%q: wrong stderr. expected=%q, got=%q", tt.args, tt.expectedStderr, stderr.String())
+		}
+	}
+}
+
+func TestStandardStreams(t *testing.T) {
+	program := `let name = input("name? "); println("hi", name); eprint("no", 2); [readline(), readline()]`
+
+	for _, engine := range []string{"-engine=eval", "-engine=vm"} {
+		var stdout, stderr bytes.Buffer
+		code := run([]string{"eval", engine, "-e", program}, strings.NewReader("Ann\r\nlast"), &stdout, &stderr)
+
+		if code != exitOK {
+			t.Fatalf("%s: wrong exit code %d (stderr: %q)", engine, code, stderr.String())
+		}
+		if expected := "name? hi Ann\n[last, null]\n"; stdout.String() != expected {
+			t.Errorf("%s: wrong stdout. expected=%q, got=%q", engine, expected, stdout.String())
+		}
+		if expected := "no 2 "; stderr.String() != expected {
+			t.Errorf("%s: wrong stderr. expected=%q, got=%q", engine, expected, stderr.String())
+		}
+	}
+}
@@ -0,0 +1,362 @@
+// code/code.go
+
+package code
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"mira/token"
+	"sort"
+)
+
+// Instructions is a sequence of encoded instructions: an opcode byte
+// followed by its big-endian operands.
+type Instructions []byte
+
+func (ins Instructions) String() string {
+	var out bytes.Buffer
+
+	i := 0
+	for i < len(ins) {
+		def, err := Lookup(ins[i])
+		if err != nil {
+			fmt.Fprintf(&out, "ERROR: %s\n", err)
+			break
+		}
+
+		operands, read := ReadOperands(def, ins[i+1:])
+
+		fmt.Fprintf(&out, "%04d %s\n", i, ins.fmtInstruction(def, operands))
+
+		i += 1 + read
+	}
+
+	return out.String()
+}
+
+func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
+	operandCount := len(def.OperandWidths)
+
+	if len(operands) != operandCount {
+		return fmt.Sprintf("ERROR: operand len %d does not match defined %d\n", len(operands), operandCount)
+	}
+
+	switch operandCount {
+	case 0:
+		return def.Name
+	case 1:
+		return fmt.Sprintf("%s %d", def.Name, operands[0])
+	case 2:
+		return fmt.Sprintf("%s %d %d", def.Name, operands[0], operands[1])
+	}
+
+	return fmt.Sprintf("ERROR: unhandled operandCount for %s\n", def.Name)
+}
+
+type Opcode byte
+
+const (
+	OpConstant Opcode = iota
+	OpPop
+
+	// Binary operators, applied with object.Infix.
+	OpAdd
+	OpSub
+	OpMul
+	OpDiv
+	OpEqual
+	OpNotEqual
+	OpLess
+	OpGreater
+	OpLessEqual
+	OpGreaterEqual
+
+	// Prefix operators, applied with object.Prefix.
+	OpMinus
+	OpBang
+
+	OpTrue
+	OpFalse
+	OpNull
+
+	OpJump
+	OpJumpNotTruthy
+
+	OpGetGlobal
+	OpSetGlobal
+	OpGetLocal
+	OpSetLocal
+	OpGetBuiltin
+
+	OpArray
+	OpHash
+	OpIndex
+
+	OpCall
+	OpReturnValue
+	OpReturn
+
+	// Closures. Locals captured by a nested function live in cells, so
+	// that assignments stay visible to both functions.
+	OpClosure
+	OpGetFree
+	OpSetFree
+	OpGetCell
+	OpSetCell
+	OpLoadCell
+	OpLoadFreeCell
+
+	OpIncrement
+	OpDecrement
+	OpDup
+	OpDup2
+	OpGetIndexTarget
+	OpSetIndex
+
+	OpInterpolate
+
+	// OpError raises a runtime error whose message is a string constant,
+	// for mistakes such as assigning to a literal that the evaluator also
+	// reports only when they are reached.
+	OpError
+
+	// OpTailCall is OpCall for a call whose result the function returns
+	// straight away. It reuses the caller's frame, so that recursion in
+	// tail position runs in constant space.
+	OpTailCall
+
+	// OpMod is the binary operator %.
+	OpMod
+
+	// OpCheckIndexTarget raises the error of object.CheckIndexTarget for
+	// the container and index on top of the stack, leaving them in place,
+	// so that an assignment fails before its value is computed.
+	OpCheckIndexTarget
+
+	// For-in loops. OpIter replaces the value on top of the stack with an
+	// *object.Iterator over it. OpIterNext pushes the next element of the
+	// iterator on top of the stack, as its value, or its value and then
+	// its key with a second operand of 2, or jumps to its first operand
+	// once the iterator is exhausted.
+	OpIter
+	OpIterNext
+
+	// The logical operators &&, || and ??. Each jumps to its operand,
+	// leaving the left operand on top of the stack as the result, when
+	// object.ShortCircuits; otherwise it pops the left operand, and the
+	// right operand is computed next.
+	OpAnd
+	OpOr
+	OpNullish
+
+	// The binary operators **, &, |, ^, << and >>, and the prefix
+	// operator ~.
+	OpPow
+	OpBitAnd
+	OpBitOr
+	OpBitXor
+	OpShl
+	OpShr
+	OpBitNot
+
+	// Variables that may not be bound yet, which then resolve to the next
+	// binding of the same name further out, as in the evaluator. Each reads
+	// or stores the local, which may be a cell, or the free variable named by
+	// its second operand and jumps to its first operand if the variable is
+	// bound; otherwise it does nothing, leaving a stored value on the stack.
+	OpTryGetLocal
+	OpTrySetLocal
+	OpTryGetFree
+	OpTrySetFree
+)
+
+type Definition struct {
+	Name          string
+	OperandWidths []int
+}
+
+var definitions = map[Opcode]*Definition{
+	OpConstant: {"OpConstant", []int{2}},
+	OpPop:      {"OpPop", []int{}},
+
+	OpAdd:          {"OpAdd", []int{}},
+	OpSub:          {"OpSub", []int{}},
+	OpMul:          {"OpMul", []int{}},
+	OpDiv:          {"OpDiv", []int{}},
+	OpEqual:        {"OpEqual", []int{}},
+	OpNotEqual:     {"OpNotEqual", []int{}},
+	OpLess:         {"OpLess", []int{}},
+	OpGreater:      {"OpGreater", []int{}},
+	OpLessEqual:    {"OpLessEqual", []int{}},
+	OpGreaterEqual: {"OpGreaterEqual", []int{}},
+
+	OpMinus: {"OpMinus", []int{}},
+	OpBang:  {"OpBang", []int{}},
+
+	OpTrue:  {"OpTrue", []int{}},
+	OpFalse: {"OpFalse", []int{}},
+	OpNull:  {"OpNull", []int{}},
+
+	OpJump:          {"OpJump", []int{2}},
+	OpJumpNotTruthy: {"OpJumpNotTruthy", []int{2}},
+
+	OpGetGlobal:  {"OpGetGlobal", []int{2}},
+	OpSetGlobal:  {"OpSetGlobal", []int{2}},
+	OpGetLocal:   {"OpGetLocal", []int{1}},
+	OpSetLocal:   {"OpSetLocal", []int{1}},
+	OpGetBuiltin: {"OpGetBuiltin", []int{1}},
+
+	OpArray: {"OpArray", []int{2}},
+	OpHash:  {"OpHash", []int{2}},
+	OpIndex: {"OpIndex", []int{}},
+
+	OpCall:        {"OpCall", []int{1}},
+	OpReturnValue: {"OpReturnValue", []int{}},
+	OpReturn:      {"OpReturn", []int{}},
+
+	OpClosure:      {"OpClosure", []int{2, 1}},
+	OpGetFree:      {"OpGetFree", []int{1}},
+	OpSetFree:      {"OpSetFree", []int{1}},
+	OpGetCell:      {"OpGetCell", []int{1}},
+	OpSetCell:      {"OpSetCell", []int{1}},
+	OpLoadCell:     {"OpLoadCell", []int{1}},
+	OpLoadFreeCell: {"OpLoadFreeCell", []int{1}},
+
+	OpIncrement:      {"OpIncrement", []int{}},
+	OpDecrement:      {"OpDecrement", []int{}},
+	OpDup:            {"OpDup", []int{}},
+	OpDup2:           {"OpDup2", []int{}},
+	OpGetIndexTarget: {"OpGetIndexTarget", []int{}},
+	OpSetIndex:       {"OpSetIndex", []int{}},
+
+	OpInterpolate: {"OpInterpolate", []int{2}},
+	OpError:       {"OpError", []int{2}},
+
+	OpTailCall: {"OpTailCall", []int{1}},
+
+	OpMod:              {"OpMod", []int{}},
+	OpCheckIndexTarget: {"OpCheckIndexTarget", []int{}},
+
+	OpIter:     {"OpIter", []int{}},
+	OpIterNext: {"OpIterNext", []int{2, 1}},
+
+	OpAnd:     {"OpAnd", []int{2}},
+	OpOr:      {"OpOr", []int{2}},
+	OpNullish: {"OpNullish", []int{2}},
+
+	OpPow:    {"OpPow", []int{}},
+	OpBitAnd: {"OpBitAnd", []int{}},
+	OpBitOr:  {"OpBitOr", []int{}},
+	OpBitXor: {"OpBitXor", []int{}},
+	OpShl:    {"OpShl", []int{}},
+	OpShr:    {"OpShr", []int{}},
+	OpBitNot: {"OpBitNot", []int{}},
+
+	OpTryGetLocal: {"OpTryGetLocal", []int{2, 1}},
+	OpTrySetLocal: {"OpTrySetLocal", []int{2, 1}},
+	OpTryGetFree:  {"OpTryGetFree", []int{2, 1}},
+	OpTrySetFree:  {"OpTrySetFree", []int{2, 1}},
+}
+
+func Lookup(op byte) (*Definition, error) {
+	def, ok := definitions[Opcode(op)]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+
+	return def, nil
+}
+
+// MaxOperand returns the largest value an operand of the given width in
+// bytes can hold.
+func MaxOperand(width int) int {
+	return 1<<(8*width) - 1
+}
+
+// Make encodes op and its operands as a single instruction. It returns an
+// empty slice for an unknown opcode. Operands that do not fit their width
+// are truncated; the compiler checks them with MaxOperand first.
+func Make(op Opcode, operands ...int) []byte {
+	def, ok := definitions[op]
+	if !ok {
+		return []byte{}
+	}
+
+	instructionLen := 1
+	for _, w := range def.OperandWidths {
+		instructionLen += w
+	}
+
+	instruction := make([]byte, instructionLen)
+	instruction[0] = byte(op)
+
+	offset := 1
+	for i, o := range operands {
+		width := def.OperandWidths[i]
+		switch width {
+		case 2:
+			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
+		case 1:
+			instruction[offset] = byte(o)
+		}
+		offset += width
+	}
+
+	return instruction
+}
+
+// ReadOperands decodes the operands of an instruction described by def,
+// returning them with the number of bytes read.
+func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+
+	for i, width := range def.OperandWidths {
+		switch width {
+		case 2:
+			operands[i] = int(ReadUint16(ins[offset:]))
+		case 1:
+			operands[i] = int(ReadUint8(ins[offset:]))
+		}
+
+		offset += width
+	}
+
+	return operands, offset
+}
+
+func ReadUint16(ins Instructions) uint16 {
+	return binary.BigEndian.Uint16(ins)
+}
+
+func ReadUint8(ins Instructions) uint8 { return uint8(ins[0]) }
+
+// PosEntry records that the instructions from Offset onwards were compiled
+// from source at Pos.
+type PosEntry struct {
+	Offset int
+	Pos    token.Position
+}
+
+// PosTable maps instruction offsets back to source positions. Entries are
+// sorted by offset.
+type PosTable []PosEntry
+
+// Lookup returns the source position of the instruction at offset, or the
+// zero Position if it is not known.
+func (t PosTable) Lookup(offset int) token.Position {
+	i := sort.Search(len(t), func(i int) bool { return t[i].Offset > offset })
+	if i == 0 {
+		return token.Position{}
+	}
+	return t[i-1].Pos
+}
+
+// Filename returns the file the positions refer to.
+func (t PosTable) Filename() string {
+	if len(t) == 0 {
+		return ""
+	}
+	return t[0].Pos.Filename
+}
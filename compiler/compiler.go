@@ -0,0 +1,1145 @@
+// compiler/compiler.go
+
+package compiler
+
+import (
+	"fmt"
+	"mira/ast"
+	"mira/code"
+	"mira/object"
+	"mira/token"
+	"strings"
+)
+
+// Compiler lowers a program into bytecode for the vm package. Compiled
+// programs behave exactly like the same programs run by the evaluator,
+// including the positions and stack traces of runtime errors. Macros must
+// be expanded before compiling.
+type Compiler struct {
+	constants []object.Object
+
+	symbolTable *SymbolTable
+
+	scopes     []CompilationScope
+	scopeIndex int
+
+	pos token.Position // Position of the node being compiled
+	err error          // First operand that did not fit, see checkOperands
+}
+
+// CompilationScope holds the instructions of the function being compiled.
+type CompilationScope struct {
+	instructions code.Instructions
+	positions    code.PosTable
+
+	depth int     // Values on the stack after the last instruction
+	loops []*loop // Enclosing loops, innermost last
+
+	// For a function, the names it binds, by its parameters or as by
+	// letNames, and those that may be bound after the last instruction,
+	// mapped to true if they certainly are.
+	names map[string]bool
+	bound map[string]bool
+}
+
+// loop is a loop being compiled. Its break statements jump to the end of
+// the loop, which is only known once the loop has been compiled.
+type loop struct {
+	depth  int   // Values on the stack at the start of each iteration
+	next   int   // Offset continue jumps to
+	breaks []int // Offsets of the jumps made by break
+}
+
+// Error is a compile error. The only programs that compile with errors are
+// those using features the evaluator handles specially, such as quote, and
+// those exceeding a limit of the bytecode, such as calls with more than 255
+// arguments.
+type Error struct {
+	Pos     token.Position
+	Message string
+}
+
+func (e *Error) Error() string {
+	if e.Pos.IsValid() {
+		return e.Pos.String() + ": " + e.Message
+	}
+	return e.Message
+}
+
+func New() *Compiler {
+	return &Compiler{
+		constants:   []object.Object{},
+		symbolTable: NewGlobalSymbolTable(),
+		scopes:      []CompilationScope{{}},
+	}
+}
+
+// NewWithState returns a compiler that continues from the symbol table and
+// constants of an earlier compilation, as the REPL does between inputs.
+func NewWithState(s *SymbolTable, constants []object.Object) *Compiler {
+	compiler := New()
+	compiler.symbolTable = s
+	compiler.constants = constants
+	return compiler
+}
+
+// Compile compiles node, which is normally an *ast.Program.
+func (c *Compiler) Compile(node ast.Node) error {
+	program, ok := node.(*ast.Program)
+	if !ok {
+		return c.result(c.compile(node))
+	}
+
+	// All top-level bindings are globals. Declaring them up front lets
+	// functions refer to globals that are bound after them, and lets a
+	// program shadow builtins.
+	for _, name := range letNames(program) {
+		c.symbolTable.Define(name)
+	}
+
+	return c.result(c.compileBody(program.Statements))
+}
+
+// result returns err, or else the error of an operand that did not fit.
+func (c *Compiler) result(err error) error {
+	if err != nil {
+		return err
+	}
+	return c.err
+}
+
+// Bytecode is a compiled program.
+type Bytecode struct {
+	Main      *object.CompiledFunction
+	Constants []object.Object
+	Globals   []string // Names of the global slots, for errors and builtins
+}
+
+func (c *Compiler) Bytecode() *Bytecode {
+	scope := c.scopes[c.scopeIndex]
+
+	return &Bytecode{
+		Main: &object.CompiledFunction{
+			Instructions: scope.instructions,
+			Name:         "<main>",
+			Positions:    scope.positions,
+		},
+		Constants: c.constants,
+		Globals:   c.symbolTable.Global().Names(),
+	}
+}
+
+func (c *Compiler) compile(node ast.Node) error {
+	saved := c.pos
+	c.pos = node.Pos()
+	defer func() { c.pos = saved }()
+
+	switch node := node.(type) {
+	case *ast.ExpressionStatement:
+		if err := c.compile(node.Expression); err != nil {
+			return err
+		}
+		c.emit(code.OpPop)
+
+	case *ast.LetStatement:
+		return c.compileLet(node)
+
+	case *ast.FunctionStatement:
+		// Compiled by declareFunctions at the start of the enclosing block.
+
+	case *ast.AssignStatement:
+		return c.compileAssign(node)
+
+	case *ast.WhileStatement:
+		return c.compileWhile(node)
+
+	case *ast.ForStatement:
+		return c.compileFor(node)
+
+	case *ast.BreakStatement:
+		return c.compileLoopControl(true)
+
+	case *ast.ContinueStatement:
+		return c.compileLoopControl(false)
+
+	case *ast.ReturnStatement:
+		if err := c.compile(node.ReturnValue); err != nil {
+			return err
+		}
+		c.emit(code.OpReturnValue)
+
+	case *ast.BlockStatement:
+		return c.compileBlock(node)
+
+	case *ast.Identifier:
+		c.loadVariable(c.variable(node.Value))
+
+	case *ast.IntegerLiteral:
+		if node.Big != nil {
+			c.emit(code.OpConstant, c.addConstant(&object.BigInteger{Value: node.Big}))
+		} else {
+			c.emit(code.OpConstant, c.addConstant(&object.Integer{Value: node.Value}))
+		}
+
+	case *ast.FloatLiteral:
+		c.emit(code.OpConstant, c.addConstant(&object.Float{Value: node.Value}))
+
+	case *ast.StringLiteral:
+		c.emit(code.OpConstant, c.addConstant(&object.String{Value: node.Value}))
+
+	case *ast.Bool:
+		if node.Value {
+			c.emit(code.OpTrue)
+		} else {
+			c.emit(code.OpFalse)
+		}
+
+	case *ast.InterpolatedString:
+		for _, part := range node.Parts {
+			if err := c.compile(part); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpInterpolate, len(node.Parts))
+
+	case *ast.PrefixExpression:
+		return c.compilePrefix(node)
+
+	case *ast.InfixExpression:
+		if op, ok := logicalOps[node.Operator]; ok {
+			return c.compileLogical(node, op)
+		}
+
+		op, ok := infixOps[node.Operator]
+		if !ok {
+			return c.errorf("unknown operator %s", node.Operator)
+		}
+
+		if err := c.compile(node.Left); err != nil {
+			return err
+		}
+		if err := c.compile(node.Right); err != nil {
+			return err
+		}
+		c.emit(op)
+
+	case *ast.IfExpression:
+		return c.compileIf(node)
+
+	case *ast.ArrayLiteral:
+		for _, el := range node.Elements {
+			if err := c.compile(el); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpArray, len(node.Elements))
+
+	case *ast.HashLiteral:
+		keys := node.Keys()
+		for _, k := range keys {
+			if err := c.compile(k); err != nil {
+				return err
+			}
+			if err := c.compile(node.Pairs[k]); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpHash, len(keys)*2)
+
+	case *ast.IndexExpression:
+		if err := c.compile(node.Left); err != nil {
+			return err
+		}
+		if err := c.compile(node.Index); err != nil {
+			return err
+		}
+		c.emit(code.OpIndex)
+
+	case *ast.FunctionLiteral:
+		return c.compileFunction(node, "")
+
+	case *ast.CallExpression:
+		if node.Function.String() == "quote" {
+			return c.errorf("quote is only supported by the evaluator")
+		}
+
+		if err := c.compile(node.Function); err != nil {
+			return err
+		}
+		for _, a := range node.Arguments {
+			if err := c.compile(a); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpCall, len(node.Arguments))
+
+	case *ast.MacroLiteral:
+		return c.errorf("macro definitions must be expanded before compiling")
+
+	default:
+		return c.errorf("cannot compile %T", node)
+	}
+
+	return nil
+}
+
+var infixOps = map[string]code.Opcode{
+	"+":  code.OpAdd,
+	"-":  code.OpSub,
+	"*":  code.OpMul,
+	"/":  code.OpDiv,
+	"%":  code.OpMod,
+	"**": code.OpPow,
+	"&":  code.OpBitAnd,
+	"|":  code.OpBitOr,
+	"^":  code.OpBitXor,
+	"<<": code.OpShl,
+	">>": code.OpShr,
+	"==": code.OpEqual,
+	"!=": code.OpNotEqual,
+	"<":  code.OpLess,
+	">":  code.OpGreater,
+	"<=": code.OpLessEqual,
+	">=": code.OpGreaterEqual,
+}
+
+var logicalOps = map[string]code.Opcode{
+	"&&": code.OpAnd,
+	"||": code.OpOr,
+	"??": code.OpNullish,
+}
+
+// compileLogical compiles &&, || or ??. The right operand is skipped when
+// the left one decides the result, which is then left on the stack.
+func (c *Compiler) compileLogical(node *ast.InfixExpression, op code.Opcode) error {
+	if err := c.compile(node.Left); err != nil {
+		return err
+	}
+	jumpPos := c.emit(op, 9999)
+
+	if err := c.compile(node.Right); err != nil {
+		return err
+	}
+
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+	return nil
+}
+
+// compileBody compiles the statements of a function or the program. The
+// last expression statement is the return value; a body ending in any
+// other statement returns null, or nothing for the program.
+func (c *Compiler) compileBody(statements []ast.Statement) error {
+	if err := c.declareFunctions(statements); err != nil {
+		return err
+	}
+
+	for i, s := range statements {
+		last, ok := s.(*ast.ExpressionStatement)
+		if !ok || i < len(statements)-1 {
+			if err := c.compile(s); err != nil {
+				return err
+			}
+			continue
+		}
+
+		saved := c.pos
+		c.pos = last.Pos()
+		defer func() { c.pos = saved }()
+		if err := c.compile(last.Expression); err != nil {
+			return err
+		}
+		c.emit(code.OpReturnValue)
+		return nil
+	}
+
+	c.emit(code.OpReturn)
+	return nil
+}
+
+// compileBlock compiles a block used as a value, such as a branch of an if
+// expression. It leaves the value of its last expression statement on the
+// stack, or null.
+func (c *Compiler) compileBlock(block *ast.BlockStatement) error {
+	// Bindings made by the block are visible after it, as in the
+	// evaluator, but may not have been made.
+	defer c.mayBind(c.branch())
+
+	if err := c.declareFunctions(block.Statements); err != nil {
+		return err
+	}
+
+	for i, s := range block.Statements {
+		last, ok := s.(*ast.ExpressionStatement)
+		if !ok || i < len(block.Statements)-1 {
+			if err := c.compile(s); err != nil {
+				return err
+			}
+			continue
+		}
+
+		saved := c.pos
+		c.pos = last.Pos()
+		defer func() { c.pos = saved }()
+		return c.compile(last.Expression)
+	}
+
+	c.emit(code.OpNull)
+	return nil
+}
+
+func (c *Compiler) compileLet(node *ast.LetStatement) error {
+	// A function is bound before its body is compiled, so that it can
+	// call itself.
+	if _, ok := node.Value.(*ast.FunctionLiteral); ok {
+		symbol := c.symbolTable.Define(node.Name.Value)
+		c.bind(node.Name.Value)
+		if err := c.compile(node.Value); err != nil {
+			return err
+		}
+		c.storeSymbol(symbol)
+		return nil
+	}
+
+	if err := c.compile(node.Value); err != nil {
+		return err
+	}
+	c.storeSymbol(c.symbolTable.Define(node.Name.Value))
+	c.bind(node.Name.Value)
+	return nil
+}
+
+// declareFunctions binds the functions declared among statements before
+// any of them runs. Every name is defined before the first body is
+// compiled, so that the functions can call each other whatever their order.
+func (c *Compiler) declareFunctions(statements []ast.Statement) error {
+	var decls []*ast.FunctionStatement
+	var symbols []Symbol
+	for _, s := range statements {
+		if decl, ok := s.(*ast.FunctionStatement); ok {
+			decls = append(decls, decl)
+			symbols = append(symbols, c.symbolTable.Define(decl.Name.Value))
+			c.bind(decl.Name.Value)
+		}
+	}
+
+	for i, decl := range decls {
+		if err := c.compileDeclaration(decl, symbols[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Compiler) compileDeclaration(decl *ast.FunctionStatement, symbol Symbol) error {
+	saved := c.pos
+	c.pos = decl.Pos()
+	defer func() { c.pos = saved }()
+
+	if err := c.compileFunction(decl.Function, decl.Name.Value); err != nil {
+		return err
+	}
+	c.storeSymbol(symbol)
+	return nil
+}
+
+func (c *Compiler) compileIf(node *ast.IfExpression) error {
+	if err := c.compile(node.Condition); err != nil {
+		return err
+	}
+
+	jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+	if err := c.compileBlock(node.Then); err != nil {
+		return err
+	}
+
+	jumpPos := c.emit(code.OpJump, 9999)
+	c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+	// The else branch starts without the value of the then branch.
+	c.scopes[c.scopeIndex].depth--
+
+	if node.Else == nil {
+		c.emit(code.OpNull)
+	} else if err := c.compileBlock(node.Else); err != nil {
+		return err
+	}
+
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+	return nil
+}
+
+func (c *Compiler) compileWhile(node *ast.WhileStatement) error {
+	// Each iteration may see the bindings of the one before.
+	defer c.mayBind(c.branch(letNames(node)...))
+
+	start := len(c.currentInstructions())
+	if err := c.compile(node.Condition); err != nil {
+		return err
+	}
+	jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+	if err := c.compileLoopBody(node.Body, start); err != nil {
+		return err
+	}
+
+	c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+	return nil
+}
+
+// compileFor compiles a for-in loop. The iterator stays on the stack while
+// the loop runs, and is popped at the end, where break jumps to as well.
+func (c *Compiler) compileFor(node *ast.ForStatement) error {
+	if err := c.compile(node.Iterable); err != nil {
+		return err
+	}
+	c.pos = node.Iterable.Pos()
+	c.emit(code.OpIter)
+	c.pos = node.Pos()
+
+	// Each iteration may see the bindings of the one before.
+	defer c.mayBind(c.branch(letNames(node)...))
+
+	vars := []*ast.Identifier{node.Value}
+	if node.Key != nil {
+		vars = []*ast.Identifier{node.Key, node.Value}
+	}
+
+	nextPos := c.emit(code.OpIterNext, 9999, len(vars))
+	for _, v := range vars {
+		c.storeSymbol(c.symbolTable.Define(v.Value))
+		c.bind(v.Value)
+	}
+
+	if err := c.compileLoopBody(node.Body, nextPos); err != nil {
+		return err
+	}
+
+	c.changeOperand(nextPos, len(c.currentInstructions()))
+	c.emit(code.OpPop)
+	return nil
+}
+
+// compileLoopBody compiles the statements of a loop body followed by a
+// jump back to next, and points the breaks in it past that jump.
+func (c *Compiler) compileLoopBody(body *ast.BlockStatement, next int) error {
+	scope := &c.scopes[c.scopeIndex]
+	l := &loop{depth: scope.depth, next: next}
+	scope.loops = append(scope.loops, l)
+
+	if err := c.declareFunctions(body.Statements); err != nil {
+		return err
+	}
+	for _, s := range body.Statements {
+		if err := c.compile(s); err != nil {
+			return err
+		}
+	}
+	c.emit(code.OpJump, next)
+
+	// Compiling may have grown c.scopes, so scope is looked up again.
+	scope = &c.scopes[c.scopeIndex]
+	scope.loops = scope.loops[:len(scope.loops)-1]
+	for _, pos := range l.breaks {
+		c.changeOperand(pos, len(c.currentInstructions()))
+	}
+	return nil
+}
+
+// compileLoopControl compiles a break, or a continue. Either pops whatever
+// the innermost loop's body has left on the stack, such as the elements of
+// an array literal the statement is nested in, before jumping.
+func (c *Compiler) compileLoopControl(isBreak bool) error {
+	scope := &c.scopes[c.scopeIndex]
+	if len(scope.loops) == 0 {
+		if isBreak {
+			return c.errorf("break outside of a loop")
+		}
+		return c.errorf("continue outside of a loop")
+	}
+	l := scope.loops[len(scope.loops)-1]
+
+	// The code after the jump is unreachable; it is compiled as if the
+	// statement had not been there.
+	depth := scope.depth
+	for scope.depth > l.depth {
+		c.emit(code.OpPop)
+	}
+
+	if isBreak {
+		l.breaks = append(l.breaks, c.emit(code.OpJump, 9999))
+	} else {
+		c.emit(code.OpJump, l.next)
+	}
+
+	scope.depth = depth
+	return nil
+}
+
+func (c *Compiler) compilePrefix(node *ast.PrefixExpression) error {
+	switch node.Operator {
+	case "++", "--":
+		return c.compileIncDec(node)
+	case "-", "!", "~":
+	default:
+		return c.errorf("unknown operator %s", node.Operator)
+	}
+
+	if err := c.compile(node.Right); err != nil {
+		return err
+	}
+
+	switch node.Operator {
+	case "-":
+		c.emit(code.OpMinus)
+	case "!":
+		c.emit(code.OpBang)
+	default:
+		c.emit(code.OpBitNot)
+	}
+	return nil
+}
+
+// compileIncDec applies ++ or -- to a variable or an element, stores the
+// result back and leaves it on the stack.
+func (c *Compiler) compileIncDec(node *ast.PrefixExpression) error {
+	op := code.OpIncrement
+	if node.Operator == "--" {
+		op = code.OpDecrement
+	}
+
+	switch target := node.Right.(type) {
+	case *ast.Identifier:
+		symbols := c.variable(target.Value)
+		c.loadVariable(symbols)
+		c.emit(op)
+		c.emit(code.OpDup)
+		c.storeVariable(symbols)
+
+	case *ast.IndexExpression:
+		if err := c.compile(target.Left); err != nil {
+			return err
+		}
+		if err := c.compile(target.Index); err != nil {
+			return err
+		}
+		c.emit(code.OpDup2)
+		c.emit(code.OpGetIndexTarget)
+		c.emit(op)
+		c.emit(code.OpSetIndex)
+
+	default:
+		c.emitError(fmt.Sprintf("cannot assign to %s", target.String()))
+	}
+
+	return nil
+}
+
+// compileAssign stores into a variable or an element. As in the evaluator,
+// the target is checked before the value is computed, and a compound
+// assignment reads it at that point.
+func (c *Compiler) compileAssign(node *ast.AssignStatement) error {
+	compound := node.Operator != "="
+	var op code.Opcode
+	if compound {
+		var ok bool
+		if op, ok = infixOps[strings.TrimSuffix(node.Operator, "=")]; !ok {
+			return c.errorf("unknown operator %s", node.Operator)
+		}
+	}
+
+	switch target := node.Target.(type) {
+	case *ast.Identifier:
+		symbols := c.variable(target.Value)
+		if symbols[len(symbols)-1].Scope == BuiltinScope {
+			// Builtins are not variables.
+			symbols = symbols[:len(symbols)-1]
+			if len(symbols) == 0 {
+				c.emitError("identifier not found: " + target.Value)
+				return nil
+			}
+		}
+
+		c.loadVariable(symbols)
+		if !compound {
+			c.emit(code.OpPop)
+		}
+		if err := c.compile(node.Value); err != nil {
+			return err
+		}
+		if compound {
+			c.emit(op)
+		}
+		c.storeVariable(symbols)
+
+	case *ast.IndexExpression:
+		if err := c.compile(target.Left); err != nil {
+			return err
+		}
+		if err := c.compile(target.Index); err != nil {
+			return err
+		}
+		if compound {
+			c.emit(code.OpDup2)
+			c.emit(code.OpGetIndexTarget)
+		} else {
+			c.emit(code.OpCheckIndexTarget)
+		}
+		if err := c.compile(node.Value); err != nil {
+			return err
+		}
+		if compound {
+			c.emit(op)
+		}
+		c.emit(code.OpSetIndex)
+		c.emit(code.OpPop)
+
+	default:
+		c.emitError(fmt.Sprintf("cannot assign to %s", target.String()))
+	}
+
+	return nil
+}
+
+// compileFunction compiles a function literal, or the function of a
+// declaration with the given name.
+func (c *Compiler) compileFunction(node *ast.FunctionLiteral, name string) error {
+	c.enterScope(capturedNames(node.Body))
+
+	names := map[string]bool{}
+	for _, name := range letNames(node.Body) {
+		names[name] = true
+	}
+	bound := map[string]bool{}
+	for _, p := range node.Parameters {
+		names[p.Value] = true
+		bound[p.Value] = true
+	}
+	c.scopes[c.scopeIndex].names = names
+	c.scopes[c.scopeIndex].bound = bound
+
+	for _, p := range node.Parameters {
+		symbol := c.symbolTable.define(p.Value)
+		if symbol.Scope == CellScope {
+			// Move the argument into a cell before the body runs.
+			c.emit(code.OpLoadCell, symbol.Index)
+			c.emit(code.OpPop)
+		}
+	}
+
+	if err := c.compileBody(node.Body.Statements); err != nil {
+		return err
+	}
+	markTailCalls(c.currentInstructions())
+
+	freeSymbols := c.symbolTable.FreeSymbols
+	freeNames := make([]string, len(freeSymbols))
+	for i, s := range freeSymbols {
+		freeNames[i] = s.Name
+	}
+	numLocals := c.symbolTable.numDefinitions
+	localNames := c.symbolTable.Names()
+	scope := c.leaveScope()
+
+	for _, s := range freeSymbols {
+		c.loadCell(s)
+	}
+
+	compiledFn := &object.CompiledFunction{
+		Instructions:  scope.instructions,
+		NumLocals:     numLocals,
+		NumParameters: len(node.Parameters),
+		Name:          name,
+		Positions:     scope.positions,
+		LocalNames:    localNames,
+		FreeNames:     freeNames,
+		Source:        (&object.Function{Parameters: node.Parameters, Body: node.Body}).Inspect(),
+	}
+
+	c.emit(code.OpClosure, c.addConstant(compiledFn), len(freeSymbols))
+	return nil
+}
+
+// markTailCalls turns every call whose result is returned unchanged, either
+// directly or through jumps out of if branches, into OpTailCall. Both have
+// the same operands, so the instructions are rewritten in place.
+func markTailCalls(ins code.Instructions) {
+	for i := 0; i < len(ins); {
+		def, err := code.Lookup(ins[i])
+		if err != nil {
+			return
+		}
+
+		next := i + 1
+		for _, w := range def.OperandWidths {
+			next += w
+		}
+		if code.Opcode(ins[i]) == code.OpCall && returnsAt(ins, next) {
+			ins[i] = byte(code.OpTailCall)
+		}
+
+		i = next
+	}
+}
+
+// returnsAt reports whether the instruction at offset returns the value on
+// top of the stack, possibly after following jumps.
+func returnsAt(ins code.Instructions, offset int) bool {
+	for offset < len(ins) {
+		switch code.Opcode(ins[offset]) {
+		case code.OpReturnValue:
+			return true
+		case code.OpJump:
+			target := int(code.ReadUint16(ins[offset+1:]))
+			if target <= offset {
+				return false
+			}
+			offset = target
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+// variable returns the bindings name may refer to at this point, from the
+// innermost out. As in the evaluator, a binding made by a let in a branch
+// or loop may not have been made yet, so a function's own binding is used
+// only if it may be bound by now, and any enclosing binding only until one
+// that certainly is; the code tries each in turn. A name that is not bound
+// anywhere is taken to be a global, which may be bound by the time the
+// code runs.
+func (c *Compiler) variable(name string) []Symbol {
+	var symbols []Symbol
+	table := c.symbolTable
+	for i := c.scopeIndex; i > 0; i-- {
+		scope := c.scopes[i]
+		// An enclosing function may bind name by the time this code
+		// runs, even if it has not yet.
+		certain, ok := scope.bound[name]
+		if scope.names[name] && (ok || i < c.scopeIndex) {
+			symbols = append(symbols, c.symbolTable.capture(table, name))
+			if certain {
+				return symbols
+			}
+		}
+		table = table.Outer
+	}
+
+	if symbol, ok := table.store[name]; ok {
+		symbols = append(symbols, symbol)
+	} else if len(symbols) == 0 {
+		symbols = append(symbols, table.Define(name))
+	}
+	return symbols
+}
+
+// bind records that name is now certainly bound in the current function.
+func (c *Compiler) bind(name string) {
+	if scope := &c.scopes[c.scopeIndex]; scope.bound != nil {
+		scope.bound[name] = true
+	}
+}
+
+// branch returns what is bound in the current function before code that
+// may not run, or may run repeatedly, and so may or may not bind names.
+func (c *Compiler) branch(names ...string) map[string]bool {
+	scope := &c.scopes[c.scopeIndex]
+	if scope.bound == nil {
+		return nil
+	}
+
+	saved := make(map[string]bool, len(scope.bound))
+	for name, certain := range scope.bound {
+		saved[name] = certain
+	}
+	for _, name := range names {
+		if _, ok := scope.bound[name]; !ok {
+			scope.bound[name] = false
+		}
+	}
+	return saved
+}
+
+// mayBind follows branch: names bound since then are only maybe bound.
+func (c *Compiler) mayBind(saved map[string]bool) {
+	scope := &c.scopes[c.scopeIndex]
+	for name, certain := range scope.bound {
+		if certain && !saved[name] {
+			scope.bound[name] = false
+		}
+	}
+}
+
+// loadVariable pushes the first of symbols, as returned by variable, that
+// is bound.
+func (c *Compiler) loadVariable(symbols []Symbol) {
+	last := len(symbols) - 1
+	var jumps []int
+	for _, s := range symbols[:last] {
+		op := code.OpTryGetLocal
+		if s.Scope == FreeScope {
+			op = code.OpTryGetFree
+		}
+		jumps = append(jumps, c.emit(op, 9999, s.Index))
+	}
+	c.loadSymbol(symbols[last])
+
+	for _, pos := range jumps {
+		c.changeOperand(pos, len(c.currentInstructions()))
+	}
+}
+
+// storeVariable stores into the first of symbols that is bound, or else
+// the last.
+func (c *Compiler) storeVariable(symbols []Symbol) {
+	last := len(symbols) - 1
+	var jumps []int
+	for _, s := range symbols[:last] {
+		op := code.OpTrySetLocal
+		if s.Scope == FreeScope {
+			op = code.OpTrySetFree
+		}
+		jumps = append(jumps, c.emit(op, 9999, s.Index))
+	}
+	c.storeSymbol(symbols[last])
+
+	for _, pos := range jumps {
+		c.changeOperand(pos, len(c.currentInstructions()))
+	}
+}
+
+func (c *Compiler) loadSymbol(s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpGetGlobal, s.Index)
+	case LocalScope:
+		c.emit(code.OpGetLocal, s.Index)
+	case CellScope:
+		c.emit(code.OpGetCell, s.Index)
+	case BuiltinScope:
+		c.emit(code.OpGetBuiltin, s.Index)
+	case FreeScope:
+		c.emit(code.OpGetFree, s.Index)
+	}
+}
+
+func (c *Compiler) storeSymbol(s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpSetGlobal, s.Index)
+	case LocalScope:
+		c.emit(code.OpSetLocal, s.Index)
+	case CellScope:
+		c.emit(code.OpSetCell, s.Index)
+	case FreeScope:
+		c.emit(code.OpSetFree, s.Index)
+	}
+}
+
+// loadCell pushes the cell of a variable captured by a closure.
+func (c *Compiler) loadCell(s Symbol) {
+	if s.Scope == FreeScope {
+		c.emit(code.OpLoadFreeCell, s.Index)
+	} else {
+		c.emit(code.OpLoadCell, s.Index)
+	}
+}
+
+func (c *Compiler) addConstant(obj object.Object) int {
+	c.constants = append(c.constants, obj)
+	return len(c.constants) - 1
+}
+
+// emit appends an instruction, recording the position of the node being
+// compiled, and returns its offset.
+func (c *Compiler) emit(op code.Opcode, operands ...int) int {
+	c.checkOperands(op, operands)
+	ins := code.Make(op, operands...)
+	pos := len(c.currentInstructions())
+
+	scope := &c.scopes[c.scopeIndex]
+	scope.instructions = append(scope.instructions, ins...)
+	scope.depth += stackEffect(op, operands)
+	if n := len(scope.positions); n == 0 || scope.positions[n-1].Pos != c.pos {
+		scope.positions = append(scope.positions, code.PosEntry{Offset: pos, Pos: c.pos})
+	}
+
+	return pos
+}
+
+// stackEffect returns how many values an instruction adds to the stack,
+// or removes from it when negative, if execution continues with the next
+// instruction.
+func stackEffect(op code.Opcode, operands []int) int {
+	switch op {
+	case code.OpConstant, code.OpTrue, code.OpFalse, code.OpNull, code.OpDup,
+		code.OpGetGlobal, code.OpGetLocal, code.OpGetBuiltin, code.OpGetFree, code.OpGetCell,
+		code.OpLoadCell, code.OpLoadFreeCell:
+		return 1
+	case code.OpDup2:
+		return 2
+	case code.OpPop, code.OpJumpNotTruthy, code.OpReturnValue,
+		code.OpAnd, code.OpOr, code.OpNullish,
+		code.OpSetGlobal, code.OpSetLocal, code.OpSetFree, code.OpSetCell,
+		code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpMod,
+		code.OpPow, code.OpBitAnd, code.OpBitOr, code.OpBitXor, code.OpShl, code.OpShr,
+		code.OpEqual, code.OpNotEqual, code.OpLess, code.OpGreater,
+		code.OpLessEqual, code.OpGreaterEqual,
+		code.OpIndex, code.OpGetIndexTarget:
+		return -1
+	case code.OpSetIndex:
+		return -2
+	case code.OpArray, code.OpHash, code.OpInterpolate:
+		return 1 - operands[0]
+	case code.OpCall, code.OpTailCall:
+		return -operands[0]
+	case code.OpClosure:
+		return 1 - operands[1]
+	case code.OpIterNext:
+		return operands[1]
+	default:
+		return 0
+	}
+}
+
+// emitError emits an instruction that raises a runtime error with message.
+func (c *Compiler) emitError(message string) {
+	c.emit(code.OpError, c.addConstant(&object.String{Value: message}))
+}
+
+func (c *Compiler) currentInstructions() code.Instructions {
+	return c.scopes[c.scopeIndex].instructions
+}
+
+// changeOperand replaces the first operand of the instruction at opPos,
+// such as the target of a jump.
+func (c *Compiler) changeOperand(opPos int, operand int) {
+	ins := c.currentInstructions()
+	def, _ := code.Lookup(ins[opPos])
+	operands, _ := code.ReadOperands(def, ins[opPos+1:])
+	operands[0] = operand
+	c.checkOperands(code.Opcode(ins[opPos]), operands)
+	copy(ins[opPos:], code.Make(code.Opcode(ins[opPos]), operands...))
+}
+
+// checkOperands records an error, reported when compilation ends, for the
+// first operand that does not fit its width, rather than let it wrap.
+func (c *Compiler) checkOperands(op code.Opcode, operands []int) {
+	if c.err != nil {
+		return
+	}
+
+	def, _ := code.Lookup(byte(op))
+	for i, operand := range operands {
+		limit := code.MaxOperand(def.OperandWidths[i])
+		if operand > limit {
+			c.err = c.errorf("%s: %d exceeds the limit of %d", operandLimit(op, i), operand, limit)
+			return
+		}
+	}
+}
+
+// operandLimit names what operand i of op counts or indexes.
+func operandLimit(op code.Opcode, i int) string {
+	switch op {
+	case code.OpCall, code.OpTailCall:
+		return "too many arguments"
+	case code.OpArray, code.OpHash, code.OpInterpolate:
+		return "too many elements"
+	case code.OpGetGlobal, code.OpSetGlobal:
+		return "too many global variables"
+	case code.OpGetLocal, code.OpSetLocal, code.OpGetCell, code.OpSetCell, code.OpLoadCell:
+		return "too many local variables"
+	case code.OpGetFree, code.OpSetFree, code.OpLoadFreeCell:
+		return "too many captured variables"
+	case code.OpTryGetLocal, code.OpTrySetLocal:
+		if i == 1 {
+			return "too many local variables"
+		}
+		return "function too large"
+	case code.OpTryGetFree, code.OpTrySetFree:
+		if i == 1 {
+			return "too many captured variables"
+		}
+		return "function too large"
+	case code.OpClosure:
+		if i == 1 {
+			return "too many captured variables"
+		}
+		return "too many constants"
+	case code.OpConstant, code.OpError:
+		return "too many constants"
+	default:
+		return "function too large"
+	}
+}
+
+func (c *Compiler) enterScope(captured map[string]bool) {
+	c.scopes = append(c.scopes, CompilationScope{})
+	c.scopeIndex++
+
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+	c.symbolTable.captured = captured
+}
+
+func (c *Compiler) leaveScope() CompilationScope {
+	scope := c.scopes[c.scopeIndex]
+
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.scopeIndex--
+
+	c.symbolTable = c.symbolTable.Outer
+
+	return scope
+}
+
+func (c *Compiler) errorf(format string, a ...any) error {
+	return &Error{Pos: c.pos, Message: fmt.Sprintf(format, a...)}
+}
+
+// letNames returns the names bound by let statements, function
+// declarations and for-in loops in node, outside of nested function
+// literals.
+func letNames(node ast.Node) []string {
+	var names []string
+
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FunctionLiteral:
+			return false
+		case *ast.LetStatement:
+			names = append(names, n.Name.Value)
+		case *ast.FunctionStatement:
+			names = append(names, n.Name.Value)
+		case *ast.ForStatement:
+			if n.Key != nil {
+				names = append(names, n.Key.Value)
+			}
+			names = append(names, n.Value.Value)
+		}
+		return true
+	})
+
+	return names
+}
+
+// capturedNames returns every identifier used inside the function literals
+// nested in body. Locals with these names may be captured by a closure.
+func capturedNames(body *ast.BlockStatement) map[string]bool {
+	names := map[string]bool{}
+
+	ast.Inspect(body, func(n ast.Node) bool {
+		if fn, ok := n.(*ast.FunctionLiteral); ok {
+			ast.Inspect(fn, func(n ast.Node) bool {
+				if ident, ok := n.(*ast.Identifier); ok {
+					names[ident.Value] = true
+				}
+				return true
+			})
+			return false
+		}
+		return true
+	})
+
+	return names
+}
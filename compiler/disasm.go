@@ -0,0 +1,129 @@
+// compiler/disasm.go
+
+package compiler
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"mira/code"
+	"mira/object"
+	"strings"
+)
+
+// Disassemble writes a listing of b to w: the main program, then every
+// function constant, one instruction per line with its offset, source
+// position, operands and what the operands refer to. When source is not
+// empty, each run of instructions is preceded by the source line it was
+// compiled from.
+func Disassemble(w io.Writer, b *Bytecode, source string) error {
+	d := &disassembler{
+		out:       bufio.NewWriter(w),
+		bytecode:  b,
+		lines:     strings.Split(source, "\n"),
+		hasSource: source != "",
+	}
+
+	d.function("<main>", b.Main)
+	for i, c := range b.Constants {
+		if fn, ok := c.(*object.CompiledFunction); ok {
+			header := fmt.Sprintf("fn #%d: params %d, locals %d, free %d",
+				i, fn.NumParameters, fn.NumLocals, len(fn.FreeNames))
+			d.out.WriteString("\n")
+			d.function(header, fn)
+		}
+	}
+
+	return d.out.Flush()
+}
+
+type disassembler struct {
+	out       *bufio.Writer
+	bytecode  *Bytecode
+	lines     []string
+	hasSource bool
+}
+
+func (d *disassembler) function(header string, fn *object.CompiledFunction) {
+	fmt.Fprintf(d.out, "== %s ==\n", header)
+
+	line := 0
+	ins := fn.Instructions
+	for i := 0; i < len(ins); {
+		def, err := code.Lookup(ins[i])
+		if err != nil {
+			fmt.Fprintf(d.out, "%04d ERROR: %s\n", i, err)
+			return
+		}
+		operands, read := code.ReadOperands(def, ins[i+1:])
+
+		pos := fn.Positions.Lookup(i)
+		if d.hasSource && pos.Line != line && pos.Line > 0 && pos.Line <= len(d.lines) {
+			line = pos.Line
+			fmt.Fprintf(d.out, "%6d | %s\n", line, d.lines[line-1])
+		}
+
+		text := def.Name
+		for _, o := range operands {
+			text += fmt.Sprintf(" %d", o)
+		}
+
+		location := "-"
+		if pos.IsValid() {
+			location = fmt.Sprintf("%d:%d", pos.Line, pos.Column)
+		}
+
+		comment := d.describe(fn, code.Opcode(ins[i]), operands)
+		if comment != "" {
+			fmt.Fprintf(d.out, "%04d %-7s %-22s %s\n", i, location, text, comment)
+		} else {
+			fmt.Fprintf(d.out, "%04d %-7s %s\n", i, location, text)
+		}
+
+		i += 1 + read
+	}
+}
+
+// describe names what the operand of an instruction refers to.
+func (d *disassembler) describe(fn *object.CompiledFunction, op code.Opcode, operands []int) string {
+	name := func(names []string, i int) string {
+		if i < len(names) {
+			return names[i]
+		}
+		return "?"
+	}
+
+	switch op {
+	case code.OpConstant, code.OpError:
+		if operands[0] >= len(d.bytecode.Constants) {
+			return "?"
+		}
+		switch c := d.bytecode.Constants[operands[0]].(type) {
+		case *object.String:
+			return fmt.Sprintf("%q", c.Value)
+		case *object.CompiledFunction:
+			return fmt.Sprintf("fn #%d", operands[0])
+		default:
+			return c.Inspect()
+		}
+	case code.OpClosure:
+		return fmt.Sprintf("fn #%d", operands[0])
+	case code.OpGetGlobal, code.OpSetGlobal:
+		return name(d.bytecode.Globals, operands[0])
+	case code.OpGetLocal, code.OpSetLocal, code.OpGetCell, code.OpSetCell, code.OpLoadCell:
+		return name(fn.LocalNames, operands[0])
+	case code.OpGetFree, code.OpSetFree, code.OpLoadFreeCell:
+		return name(fn.FreeNames, operands[0])
+	case code.OpTryGetLocal, code.OpTrySetLocal:
+		return name(fn.LocalNames, operands[1])
+	case code.OpTryGetFree, code.OpTrySetFree:
+		return name(fn.FreeNames, operands[1])
+	case code.OpGetBuiltin:
+		if operands[0] < len(object.Builtins) {
+			return object.Builtins[operands[0]].Name
+		}
+		return "?"
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,649 @@
+// compiler/encoding.go
+
+package compiler
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"mira/code"
+	"mira/object"
+	"mira/token"
+)
+
+// A compiled module file starts with Magic followed by the format version.
+// The rest is a sequence of unsigned varints, zigzag varints for signed
+// integers, and length-prefixed strings:
+//
+//	magic version
+//	filename
+//	globals:   count name...
+//	constants: count (tag value)...
+//	main function
+//
+// A function is its name, parameter and local counts, instructions, the
+// position table as (offset line column byte-offset) entries, the names of
+// its locals and free variables, and its source text.
+const (
+	Magic   = "\x00MIRA"
+	Version = 1
+)
+
+const (
+	tagInteger byte = iota + 1
+	tagBigInteger
+	tagFloat
+	tagString
+	tagFunction
+)
+
+// maxLength bounds the counts and lengths read from a module, so that a
+// corrupt file fails to load instead of exhausting memory.
+const maxLength = 1 << 24
+
+// ErrNotBytecode is returned by ReadBytecode when the input does not start
+// with Magic.
+var ErrNotBytecode = errors.New("not a compiled mira module")
+
+// IsBytecode reports whether data starts like a compiled module.
+func IsBytecode(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(Magic))
+}
+
+// WriteTo encodes the bytecode in the module format. All positions must
+// refer to the same file.
+func (b *Bytecode) WriteTo(w io.Writer) (int64, error) {
+	e := &encoder{w: bufio.NewWriter(w)}
+
+	e.bytes([]byte(Magic))
+	e.uint(Version)
+	e.string(b.Main.Positions.Filename())
+
+	e.uint(uint64(len(b.Globals)))
+	for _, name := range b.Globals {
+		e.string(name)
+	}
+
+	e.uint(uint64(len(b.Constants)))
+	for _, c := range b.Constants {
+		e.constant(c)
+	}
+
+	e.function(b.Main)
+
+	if e.err == nil {
+		e.err = e.w.Flush()
+	}
+	return e.n, e.err
+}
+
+// ReadBytecode decodes a module written by WriteTo.
+func ReadBytecode(r io.Reader) (*Bytecode, error) {
+	d := &decoder{r: bufio.NewReader(r)}
+
+	magic := make([]byte, len(Magic))
+	if _, err := io.ReadFull(d.r, magic); err != nil || string(magic) != Magic {
+		return nil, ErrNotBytecode
+	}
+	if version := d.uint(); d.err == nil && version != Version {
+		return nil, fmt.Errorf("unsupported bytecode version %d, want %d", version, Version)
+	}
+	d.filename = d.string()
+
+	b := &Bytecode{}
+
+	b.Globals = make([]string, d.length())
+	for i := range b.Globals {
+		b.Globals[i] = d.string()
+	}
+
+	b.Constants = make([]object.Object, d.length())
+	for i := range b.Constants {
+		b.Constants[i] = d.constant()
+	}
+
+	b.Main = d.function()
+
+	if d.err == nil {
+		d.err = verifyBytecode(b)
+	}
+	if d.err != nil {
+		if d.err == io.EOF {
+			d.err = io.ErrUnexpectedEOF
+		}
+		return nil, fmt.Errorf("corrupt bytecode: %w", d.err)
+	}
+	return b, nil
+}
+
+type encoder struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (e *encoder) bytes(p []byte) {
+	if e.err != nil {
+		return
+	}
+	n, err := e.w.Write(p)
+	e.n += int64(n)
+	e.err = err
+}
+
+func (e *encoder) uint(v uint64) {
+	var buf [binary.MaxVarintLen64]byte
+	e.bytes(buf[:binary.PutUvarint(buf[:], v)])
+}
+
+func (e *encoder) int(v int64) {
+	var buf [binary.MaxVarintLen64]byte
+	e.bytes(buf[:binary.PutVarint(buf[:], v)])
+}
+
+func (e *encoder) string(s string) {
+	e.uint(uint64(len(s)))
+	e.bytes([]byte(s))
+}
+
+func (e *encoder) strings(s []string) {
+	e.uint(uint64(len(s)))
+	for _, str := range s {
+		e.string(str)
+	}
+}
+
+func (e *encoder) constant(obj object.Object) {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		e.bytes([]byte{tagInteger})
+		e.int(obj.Value)
+	case *object.BigInteger:
+		e.bytes([]byte{tagBigInteger})
+		e.string(obj.Value.String())
+	case *object.Float:
+		e.bytes([]byte{tagFloat})
+		e.uint(math.Float64bits(obj.Value))
+	case *object.String:
+		e.bytes([]byte{tagString})
+		e.string(obj.Value)
+	case *object.CompiledFunction:
+		e.bytes([]byte{tagFunction})
+		e.function(obj)
+	default:
+		if e.err == nil {
+			e.err = fmt.Errorf("cannot encode constant of type %s", obj.Type())
+		}
+	}
+}
+
+func (e *encoder) function(fn *object.CompiledFunction) {
+	e.string(fn.Name)
+	e.uint(uint64(fn.NumParameters))
+	e.uint(uint64(fn.NumLocals))
+	e.string(string(fn.Instructions))
+
+	e.uint(uint64(len(fn.Positions)))
+	for _, p := range fn.Positions {
+		e.uint(uint64(p.Offset))
+		e.uint(uint64(p.Pos.Line))
+		e.uint(uint64(p.Pos.Column))
+		e.uint(uint64(p.Pos.Offset))
+	}
+
+	e.strings(fn.LocalNames)
+	e.strings(fn.FreeNames)
+	e.string(fn.Source)
+}
+
+type decoder struct {
+	r        *bufio.Reader
+	filename string
+	err      error
+}
+
+func (d *decoder) uint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, err := binary.ReadUvarint(d.r)
+	d.err = err
+	return v
+}
+
+func (d *decoder) int() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, err := binary.ReadVarint(d.r)
+	d.err = err
+	return v
+}
+
+// length reads a count or length, failing on implausibly large values.
+func (d *decoder) length() int {
+	v := d.uint()
+	if v > maxLength {
+		d.err = fmt.Errorf("length %d out of range", v)
+		return 0
+	}
+	return int(v)
+}
+
+func (d *decoder) string() string {
+	n := d.length()
+	if d.err != nil {
+		return ""
+	}
+	buf := make([]byte, n)
+	_, d.err = io.ReadFull(d.r, buf)
+	return string(buf)
+}
+
+func (d *decoder) strings() []string {
+	s := make([]string, d.length())
+	for i := range s {
+		s[i] = d.string()
+	}
+	return s
+}
+
+func (d *decoder) constant() object.Object {
+	if d.err != nil {
+		return nil
+	}
+	tag, err := d.r.ReadByte()
+	if err != nil {
+		d.err = err
+		return nil
+	}
+
+	switch tag {
+	case tagInteger:
+		return &object.Integer{Value: d.int()}
+	case tagBigInteger:
+		s := d.string()
+		v, ok := new(big.Int).SetString(s, 10)
+		if !ok && d.err == nil {
+			d.err = fmt.Errorf("bad integer constant %q", s)
+		}
+		return &object.BigInteger{Value: v}
+	case tagFloat:
+		return &object.Float{Value: math.Float64frombits(d.uint())}
+	case tagString:
+		return &object.String{Value: d.string()}
+	case tagFunction:
+		return d.function()
+	default:
+		d.err = fmt.Errorf("unknown constant tag %d", tag)
+		return nil
+	}
+}
+
+func (d *decoder) function() *object.CompiledFunction {
+	fn := &object.CompiledFunction{
+		Name:          d.string(),
+		NumParameters: d.length(),
+		NumLocals:     d.length(),
+		Instructions:  code.Instructions(d.string()),
+	}
+
+	fn.Positions = make(code.PosTable, d.length())
+	for i := range fn.Positions {
+		fn.Positions[i] = code.PosEntry{
+			Offset: d.length(),
+			Pos: token.Position{
+				Filename: d.filename,
+				Line:     d.length(),
+				Column:   d.length(),
+				Offset:   d.length(),
+			},
+		}
+	}
+
+	fn.LocalNames = d.strings()
+	fn.FreeNames = d.strings()
+	fn.Source = d.string()
+
+	if d.err == nil {
+		d.err = verify(fn)
+	}
+	return fn
+}
+
+// verify checks that the instructions of fn decode and that its locals are
+// consistent. Operands are checked by verifyBytecode once the whole module
+// is read.
+func verify(fn *object.CompiledFunction) error {
+	if len(fn.LocalNames) != fn.NumLocals || fn.NumParameters > fn.NumLocals {
+		return fmt.Errorf("function %q has inconsistent locals", fn.Name)
+	}
+
+	ins := fn.Instructions
+	for i := 0; i < len(ins); {
+		def, err := code.Lookup(ins[i])
+		if err != nil {
+			return err
+		}
+
+		width := 0
+		for _, w := range def.OperandWidths {
+			width += w
+		}
+		if i+1+width > len(ins) {
+			return fmt.Errorf("truncated %s at %04d", def.Name, i)
+		}
+
+		i += 1 + width
+	}
+
+	return nil
+}
+
+// verifyBytecode checks every operand of the functions of b against what
+// it refers to, and how each function uses the stack, so that a damaged or
+// crafted module is rejected on load instead of making the VM index out of
+// range.
+func verifyBytecode(b *Bytecode) error {
+	if err := verifyFunction(b, b.Main); err != nil {
+		return err
+	}
+	for _, c := range b.Constants {
+		if fn, ok := c.(*object.CompiledFunction); ok {
+			if err := verifyFunction(b, fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func verifyFunction(b *Bytecode, fn *object.CompiledFunction) error {
+	ins := fn.Instructions
+
+	// Jumps must land on an instruction, so the offsets of all of them are
+	// collected first.
+	starts := map[int]bool{}
+	for i := 0; i < len(ins); {
+		starts[i] = true
+		def, _ := code.Lookup(ins[i])
+		_, read := code.ReadOperands(def, ins[i+1:])
+		i += 1 + read
+	}
+
+	for i := 0; i < len(ins); {
+		op := code.Opcode(ins[i])
+		def, _ := code.Lookup(ins[i])
+		operands, read := code.ReadOperands(def, ins[i+1:])
+
+		bad := func(what string) error {
+			return fmt.Errorf("%s at %04d in function %q refers to a missing %s", def.Name, i, fn.Name, what)
+		}
+
+		switch op {
+		case code.OpConstant:
+			if operands[0] >= len(b.Constants) {
+				return bad("constant")
+			}
+		case code.OpError:
+			if operands[0] >= len(b.Constants) {
+				return bad("constant")
+			}
+			if _, ok := b.Constants[operands[0]].(*object.String); !ok {
+				return bad("string constant")
+			}
+		case code.OpClosure:
+			if operands[0] >= len(b.Constants) {
+				return bad("constant")
+			}
+			callee, ok := b.Constants[operands[0]].(*object.CompiledFunction)
+			if !ok {
+				return bad("function constant")
+			}
+			if operands[1] != len(callee.FreeNames) {
+				return bad("free variable")
+			}
+		case code.OpJump, code.OpJumpNotTruthy, code.OpAnd, code.OpOr, code.OpNullish, code.OpIterNext:
+			if !starts[operands[0]] {
+				return bad("jump target")
+			}
+		case code.OpGetGlobal, code.OpSetGlobal:
+			if operands[0] >= len(b.Globals) {
+				return bad("global")
+			}
+		case code.OpGetLocal, code.OpSetLocal, code.OpGetCell, code.OpSetCell, code.OpLoadCell:
+			if operands[0] >= fn.NumLocals {
+				return bad("local")
+			}
+		case code.OpGetFree, code.OpSetFree, code.OpLoadFreeCell:
+			if operands[0] >= len(fn.FreeNames) {
+				return bad("free variable")
+			}
+		case code.OpGetBuiltin:
+			if operands[0] >= len(object.Builtins) {
+				return bad("builtin")
+			}
+		case code.OpTryGetLocal, code.OpTrySetLocal:
+			if !starts[operands[0]] {
+				return bad("jump target")
+			}
+			if operands[1] >= fn.NumLocals {
+				return bad("local")
+			}
+		case code.OpTryGetFree, code.OpTrySetFree:
+			if !starts[operands[0]] {
+				return bad("jump target")
+			}
+			if operands[1] >= len(fn.FreeNames) {
+				return bad("free variable")
+			}
+		}
+
+		i += 1 + read
+	}
+
+	return verifyStack(fn)
+}
+
+// slot is what verifyStack knows about a value on the stack. Iterators and
+// cells are internal to the VM and only used by the instructions made for
+// them.
+type slot byte
+
+const (
+	anySlot slot = iota
+	valueSlot
+	iteratorSlot
+	cellSlot
+)
+
+var slotNames = [...]string{anySlot: "a value", valueSlot: "a value", iteratorSlot: "an iterator", cellSlot: "a cell"}
+
+// verifyStack follows every path through fn, which must end in a return,
+// tracking what is on the stack. An instruction may not pop more than the
+// function pushed or take a value of the wrong kind, and the paths that
+// meet at an instruction must agree on the stack.
+func verifyStack(fn *object.CompiledFunction) error {
+	ins := fn.Instructions
+	if len(ins) == 0 {
+		return fmt.Errorf("function %q has no instructions", fn.Name)
+	}
+
+	stacks := map[int][]slot{0: {}}
+	work := []int{0}
+	for len(work) > 0 {
+		i := work[len(work)-1]
+		work = work[:len(work)-1]
+
+		op := code.Opcode(ins[i])
+		def, _ := code.Lookup(ins[i])
+		operands, read := code.ReadOperands(def, ins[i+1:])
+		next := i + 1 + read
+
+		fail := func(format string, args ...any) error {
+			return fmt.Errorf("%s at %04d in function %q %s", def.Name, i, fn.Name, fmt.Sprintf(format, args...))
+		}
+
+		stack := append([]slot(nil), stacks[i]...)
+		take := func(n int, kind slot) error {
+			if n > len(stack) {
+				return fail("pops an empty stack")
+			}
+			for _, s := range stack[len(stack)-n:] {
+				if kind != anySlot && s != kind {
+					return fail("expects %s, got %s", slotNames[kind], slotNames[s])
+				}
+			}
+			stack = stack[:len(stack)-n]
+			return nil
+		}
+		push := func(kinds ...slot) {
+			stack = append(stack, kinds...)
+		}
+		flow := func(to int) error {
+			if to == len(ins) {
+				return fail("runs past the end of the function")
+			}
+			seen, ok := stacks[to]
+			if !ok {
+				stacks[to] = append([]slot(nil), stack...)
+				work = append(work, to)
+				return nil
+			}
+			if len(seen) != len(stack) {
+				return fail("leaves %d values on the stack at %04d, where others leave %d", len(stack), to, len(seen))
+			}
+			for j := range seen {
+				if seen[j] != stack[j] {
+					return fail("leaves %s on the stack at %04d, where others leave %s", slotNames[stack[j]], to, slotNames[seen[j]])
+				}
+			}
+			return nil
+		}
+
+		var err error
+		switch op {
+		case code.OpConstant, code.OpTrue, code.OpFalse, code.OpNull,
+			code.OpGetGlobal, code.OpGetLocal, code.OpGetBuiltin, code.OpGetFree, code.OpGetCell:
+			push(valueSlot)
+		case code.OpLoadCell, code.OpLoadFreeCell:
+			push(cellSlot)
+		case code.OpPop:
+			err = take(1, anySlot)
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpMod,
+			code.OpPow, code.OpBitAnd, code.OpBitOr, code.OpBitXor, code.OpShl, code.OpShr,
+			code.OpEqual, code.OpNotEqual, code.OpLess, code.OpGreater,
+			code.OpLessEqual, code.OpGreaterEqual, code.OpIndex, code.OpGetIndexTarget:
+			err = take(2, valueSlot)
+			push(valueSlot)
+		case code.OpMinus, code.OpBang, code.OpBitNot, code.OpIncrement, code.OpDecrement:
+			err = take(1, valueSlot)
+			push(valueSlot)
+		case code.OpSetGlobal, code.OpSetLocal, code.OpSetFree, code.OpSetCell:
+			err = take(1, valueSlot)
+		case code.OpDup:
+			err = take(1, valueSlot)
+			push(valueSlot, valueSlot)
+		case code.OpDup2:
+			err = take(2, valueSlot)
+			push(valueSlot, valueSlot, valueSlot, valueSlot)
+		case code.OpCheckIndexTarget:
+			err = take(2, valueSlot)
+			push(valueSlot, valueSlot)
+		case code.OpSetIndex:
+			err = take(3, valueSlot)
+			push(valueSlot)
+		case code.OpHash:
+			if operands[0]%2 != 0 {
+				return fail("has a key without a value")
+			}
+			err = take(operands[0], valueSlot)
+			push(valueSlot)
+		case code.OpArray, code.OpInterpolate:
+			err = take(operands[0], valueSlot)
+			push(valueSlot)
+		case code.OpCall, code.OpTailCall:
+			err = take(operands[0]+1, valueSlot)
+			push(valueSlot)
+		case code.OpClosure:
+			err = take(operands[1], cellSlot)
+			push(valueSlot)
+		case code.OpIter:
+			err = take(1, valueSlot)
+			push(iteratorSlot)
+		case code.OpJump:
+			if err := flow(operands[0]); err != nil {
+				return err
+			}
+			continue
+		case code.OpJumpNotTruthy:
+			if err := take(1, valueSlot); err != nil {
+				return err
+			}
+			if err := flow(operands[0]); err != nil {
+				return err
+			}
+		case code.OpAnd, code.OpOr, code.OpNullish:
+			// The operand stays on the stack when it short-circuits.
+			if err := take(1, valueSlot); err != nil {
+				return err
+			}
+			push(valueSlot)
+			if err := flow(operands[0]); err != nil {
+				return err
+			}
+			stack = stack[:len(stack)-1]
+		case code.OpIterNext:
+			if err := take(1, iteratorSlot); err != nil {
+				return err
+			}
+			push(iteratorSlot)
+			if err := flow(operands[0]); err != nil {
+				return err
+			}
+			if operands[1] == 2 {
+				push(valueSlot)
+			}
+			push(valueSlot)
+		case code.OpTryGetLocal, code.OpTryGetFree:
+			// The value is pushed only when it jumps.
+			push(valueSlot)
+			if err := flow(operands[0]); err != nil {
+				return err
+			}
+			stack = stack[:len(stack)-1]
+		case code.OpTrySetLocal, code.OpTrySetFree:
+			// The value is popped only when it jumps.
+			if err := take(1, valueSlot); err != nil {
+				return err
+			}
+			if err := flow(operands[0]); err != nil {
+				return err
+			}
+			push(valueSlot)
+		case code.OpReturnValue:
+			if err := take(1, valueSlot); err != nil {
+				return err
+			}
+			continue
+		case code.OpReturn, code.OpError:
+			continue
+		default:
+			return fail("is not supported")
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := flow(next); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
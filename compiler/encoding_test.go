@@ -0,0 +1,239 @@
+package compiler
+
+import (
+	"bytes"
+	"errors"
+	"mira/code"
+	"mira/lexer"
+	"mira/object"
+	"mira/parser"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func compileFile(t *testing.T, filename, input string) *Bytecode {
+	t.Helper()
+	program := parser.New(lexer.NewFile(filename, input)).ParseProgram()
+	comp := New()
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	return comp.Bytecode()
+}
+
+func encode(t *testing.T, b *Bytecode) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	n, err := b.WriteTo(&buf)
+	if err != nil {
+		t.Fatalf("WriteTo failed: %s", err)
+	}
+	if n != int64(buf.Len()) {
+		t.Errorf("WriteTo returned %d, wrote %d bytes", n, buf.Len())
+	}
+	return buf.Bytes()
+}
+
+func TestBytecodeRoundTrip(t *testing.T) {
+	input := `let big = 123456789012345678901234567890;
+let add = fn(a, b) {
+  let sum = a + b;
+  fn() { sum * 2.5 }
+};
+let s = "x ${add(1, -2)()} y";
+[big, s, {"k": -7}]`
+
+	b := compileFile(t, "prog.mira", input)
+	data := encode(t, b)
+
+	if !IsBytecode(data) {
+		t.Fatalf("IsBytecode(%q...) = false", data[:8])
+	}
+
+	decoded, err := ReadBytecode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("ReadBytecode failed: %s", err)
+	}
+
+	if again := encode(t, decoded); !bytes.Equal(again, data) {
+		t.Errorf("decoded bytecode encodes differently.\nexpected=%q\ngot=%q", data, again)
+	}
+	if !reflect.DeepEqual(decoded.Globals, b.Globals) {
+		t.Errorf("wrong globals. expected=%q, got=%q", b.Globals, decoded.Globals)
+	}
+	if len(decoded.Constants) != len(b.Constants) {
+		t.Fatalf("wrong number of constants. expected=%d, got=%d", len(b.Constants), len(decoded.Constants))
+	}
+	for i, c := range b.Constants {
+		if got := decoded.Constants[i]; got.Type() != c.Type() || got.Inspect() != c.Inspect() {
+			t.Errorf("constant %d wrong. expected=%s %q, got=%s %q", i, c.Type(), c.Inspect(), got.Type(), got.Inspect())
+		}
+	}
+	if got := decoded.Main.Positions.Filename(); got != "prog.mira" {
+		t.Errorf("wrong filename. expected=%q, got=%q", "prog.mira", got)
+	}
+}
+
+func TestReadBytecodeErrors(t *testing.T) {
+	data := encode(t, compileFile(t, "prog.mira", "let f = fn(x) { x + 1 }; f(2)"))
+
+	badVersion := append([]byte(Magic), 99)
+	broken := compileFile(t, "prog.mira", "1")
+	broken.Main.Instructions = append(broken.Main.Instructions, 0xff)
+	badOpcode := encode(t, broken)
+	broken.Main.Instructions = code.Make(code.OpClosure, 0, 0)[:2]
+	truncated := encode(t, broken)
+	longLength := append([]byte(Magic), 1, 0, 0xff, 0xff, 0xff, 0xff, 0x0f)
+
+	tests := []struct {
+		data     []byte
+		expected string
+	}{
+		{[]byte("let x = 1;"), ErrNotBytecode.Error()},
+		{badVersion, "unsupported bytecode version 99, want 1"},
+		{data[:len(data)/2], "corrupt bytecode: unexpected EOF"},
+		{longLength, "corrupt bytecode: length 4294967295 out of range"},
+		{badOpcode, "corrupt bytecode: opcode 255 undefined"},
+		{truncated, "corrupt bytecode: truncated OpClosure at 0000"},
+	}
+
+	for _, tt := range tests {
+		_, err := ReadBytecode(bytes.NewReader(tt.data))
+		if err == nil {
+			t.Errorf("%q: expected an error", tt.data)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("wrong error. expected=%q, got=%q", tt.expected, err)
+		}
+	}
+
+	if _, err := ReadBytecode(strings.NewReader("")); !errors.Is(err, ErrNotBytecode) {
+		t.Errorf("empty input: expected ErrNotBytecode, got %v", err)
+	}
+}
+
+func TestReadBytecodeBadOperands(t *testing.T) {
+	ret := code.Make(code.OpReturnValue)
+	concat := func(ins ...[]byte) code.Instructions {
+		var out code.Instructions
+		for _, in := range ins {
+			out = append(out, in...)
+		}
+		return out
+	}
+
+	tests := []struct {
+		instructions code.Instructions
+		expected     string
+	}{
+		{concat(code.Make(code.OpConstant, 5), ret), "OpConstant at 0000 in function \"<main>\" refers to a missing constant"},
+		{concat(code.Make(code.OpClosure, 0, 0), ret), "OpClosure at 0000 in function \"<main>\" refers to a missing function constant"},
+		{concat(code.Make(code.OpError, 0), ret), "OpError at 0000 in function \"<main>\" refers to a missing string constant"},
+		{concat(code.Make(code.OpJump, 1), ret), "OpJump at 0000 in function \"<main>\" refers to a missing jump target"},
+		{concat(code.Make(code.OpTrue), code.Make(code.OpJumpNotTruthy, 99), ret), "OpJumpNotTruthy at 0001 in function \"<main>\" refers to a missing jump target"},
+		{concat(code.Make(code.OpGetGlobal, 3), ret), "OpGetGlobal at 0000 in function \"<main>\" refers to a missing global"},
+		{concat(code.Make(code.OpGetLocal, 0), ret), "OpGetLocal at 0000 in function \"<main>\" refers to a missing local"},
+		{concat(code.Make(code.OpGetFree, 0), ret), "OpGetFree at 0000 in function \"<main>\" refers to a missing free variable"},
+		{concat(code.Make(code.OpGetBuiltin, 200), ret), "OpGetBuiltin at 0000 in function \"<main>\" refers to a missing builtin"},
+	}
+
+	for _, tt := range tests {
+		broken := compileFile(t, "prog.mira", "1")
+		broken.Main.Instructions = tt.instructions
+		_, err := ReadBytecode(bytes.NewReader(encode(t, broken)))
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("wrong error. expected=%q, got=%v", tt.expected, err)
+		}
+	}
+
+	// A closure must capture as many variables as its function uses.
+	b := compileFile(t, "prog.mira", "let f = fn(a) { fn() { a } }; f(1)()")
+	inner := b.Constants[0].(*object.CompiledFunction)
+	outer := b.Constants[1].(*object.CompiledFunction)
+	if len(inner.FreeNames) != 1 {
+		t.Fatalf("unexpected constants: %v", b.Constants)
+	}
+	outer.Instructions = concat(code.Make(code.OpClosure, 0, 0), ret)
+	_, err := ReadBytecode(bytes.NewReader(encode(t, b)))
+	if err == nil || !strings.Contains(err.Error(), "OpClosure at") || !strings.Contains(err.Error(), "missing free variable") {
+		t.Errorf("wrong error for a closure. got=%v", err)
+	}
+}
+
+func TestReadBytecodeBadStack(t *testing.T) {
+	ret := code.Make(code.OpReturnValue)
+	concat := func(ins ...[]byte) code.Instructions {
+		var out code.Instructions
+		for _, in := range ins {
+			out = append(out, in...)
+		}
+		return out
+	}
+
+	tests := []struct {
+		instructions code.Instructions
+		expected     string
+	}{
+		{code.Make(code.OpPop), "OpPop at 0000 in function \"<main>\" pops an empty stack"},
+		{code.Make(code.OpTrue), "OpTrue at 0000 in function \"<main>\" runs past the end of the function"},
+		{code.Instructions{}, "function \"<main>\" has no instructions"},
+		{
+			concat(code.Make(code.OpTrue), code.Make(code.OpIterNext, 5, 1), ret),
+			"OpIterNext at 0001 in function \"<main>\" expects an iterator, got a value",
+		},
+		{
+			concat(code.Make(code.OpTrue), code.Make(code.OpJumpNotTruthy, 6), code.Make(code.OpTrue), code.Make(code.OpTrue), ret),
+			"OpTrue at 0005 in function \"<main>\" leaves 2 values on the stack at 0006, where others leave 0",
+		},
+	}
+
+	for _, tt := range tests {
+		broken := compileFile(t, "prog.mira", "1")
+		broken.Main.Instructions = tt.instructions
+		_, err := ReadBytecode(bytes.NewReader(encode(t, broken)))
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("wrong error. expected=%q, got=%v", tt.expected, err)
+		}
+	}
+
+	// A closure captures cells, not values.
+	b := compileFile(t, "prog.mira", "let f = fn(a) { fn() { a } }; f(1)()")
+	outer := b.Constants[1].(*object.CompiledFunction)
+	outer.Instructions = concat(code.Make(code.OpTrue), code.Make(code.OpClosure, 0, 1), ret)
+	_, err := ReadBytecode(bytes.NewReader(encode(t, b)))
+	if err == nil || !strings.Contains(err.Error(), "OpClosure at 0001") || !strings.Contains(err.Error(), "expects a cell, got a value") {
+		t.Errorf("wrong error for a closure. got=%v", err)
+	}
+}
+
+func TestDisassemble(t *testing.T) {
+	source := "let x = 1;\nlet f = fn(a) { a + x };\nprint(f(2))"
+	b := compileFile(t, "prog.mira", source)
+
+	var out bytes.Buffer
+	if err := Disassemble(&out, b, source); err != nil {
+		t.Fatal(err)
+	}
+	got := out.String()
+
+	expected := []string{
+		"== <main> ==\n",
+		"     1 | let x = 1;\n",
+		"0000 1:9     OpConstant 0           1\n",
+		"OpSetGlobal 0          x\n",
+		"     3 | print(f(2))\n",
+		"OpGetBuiltin",
+		"print\n",
+		"== fn #1: params 1, locals 1, free 0 ==\n",
+		"     2 | let f = fn(a) { a + x };\n",
+		"OpGetLocal 0           a\n",
+		"OpGetGlobal 0          x\n",
+	}
+	for _, want := range expected {
+		if !strings.Contains(got, want) {
+			t.Errorf("listing missing %q. got:\n%s", want, got)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+// compiler/symbol_table.go
+
+package compiler
+
+import (
+	"mira/object"
+	"sort"
+)
+
+type SymbolScope string
+
+const (
+	GlobalScope  SymbolScope = "GLOBAL"
+	LocalScope   SymbolScope = "LOCAL"
+	CellScope    SymbolScope = "CELL"
+	BuiltinScope SymbolScope = "BUILTIN"
+	FreeScope    SymbolScope = "FREE"
+)
+
+// Symbol is a resolved name. Locals captured by a nested function use
+// CellScope; the free variables of a function always refer to cells.
+type Symbol struct {
+	Name  string
+	Scope SymbolScope
+	Index int
+}
+
+type SymbolTable struct {
+	Outer *SymbolTable
+
+	store          map[string]Symbol
+	numDefinitions int
+	names          []string // Names of the definitions, by index
+
+	// FreeSymbols holds, for each free variable of the function, the
+	// symbol it resolves to in the enclosing function.
+	FreeSymbols []Symbol
+
+	captured map[string]bool    // Locals used by nested functions
+	captures map[capture]Symbol // Free variables made by capture
+}
+
+// capture identifies the variable name defined in table.
+type capture struct {
+	table *SymbolTable
+	name  string
+}
+
+func NewSymbolTable() *SymbolTable {
+	return &SymbolTable{store: make(map[string]Symbol), captures: make(map[capture]Symbol)}
+}
+
+// NewGlobalSymbolTable returns a symbol table for a program, holding the
+// builtins.
+func NewGlobalSymbolTable() *SymbolTable {
+	s := NewSymbolTable()
+	for i, v := range object.Builtins {
+		s.DefineBuiltin(i, v.Name)
+	}
+	return s
+}
+
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.Outer = outer
+	return s
+}
+
+// Define binds name in this table. A name already defined in the same table
+// keeps its slot, as a second let in the evaluator overwrites the binding.
+func (s *SymbolTable) Define(name string) Symbol {
+	if symbol, ok := s.store[name]; ok {
+		switch symbol.Scope {
+		case GlobalScope, LocalScope, CellScope:
+			return symbol
+		}
+	}
+
+	return s.define(name)
+}
+
+// define always allocates a new slot for name.
+func (s *SymbolTable) define(name string) Symbol {
+	symbol := Symbol{Name: name, Index: s.numDefinitions}
+	switch {
+	case s.Outer == nil:
+		symbol.Scope = GlobalScope
+	case s.captured[name]:
+		symbol.Scope = CellScope
+	default:
+		symbol.Scope = LocalScope
+	}
+
+	s.store[name] = symbol
+	s.names = append(s.names, name)
+	s.numDefinitions++
+	return symbol
+}
+
+func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
+	symbol := Symbol{Name: name, Index: index, Scope: BuiltinScope}
+	s.store[name] = symbol
+	return symbol
+}
+
+func (s *SymbolTable) defineFree(original Symbol) Symbol {
+	s.FreeSymbols = append(s.FreeSymbols, original)
+
+	symbol := Symbol{Name: original.Name, Index: len(s.FreeSymbols) - 1}
+	symbol.Scope = FreeScope
+
+	s.store[original.Name] = symbol
+	return symbol
+}
+
+// Resolve looks name up in this table and its enclosing tables. A local of
+// an enclosing function becomes a free variable of this one.
+func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
+	symbol, ok := s.store[name]
+	if !ok && s.Outer != nil {
+		symbol, ok = s.Outer.Resolve(name)
+		if !ok {
+			return symbol, ok
+		}
+
+		if symbol.Scope == GlobalScope || symbol.Scope == BuiltinScope {
+			return symbol, ok
+		}
+
+		free := s.defineFree(symbol)
+		return free, true
+	}
+
+	return symbol, ok
+}
+
+// capture returns the variable name of owner, which is this table or an
+// enclosing one, defining it in owner if needed. Unlike Resolve, it reaches
+// past any other binding of name in the tables in between, and does not
+// change what name resolves to in them.
+func (s *SymbolTable) capture(owner *SymbolTable, name string) Symbol {
+	if s == owner {
+		return s.Define(name)
+	}
+
+	key := capture{owner, name}
+	if symbol, ok := s.captures[key]; ok {
+		return symbol
+	}
+
+	s.FreeSymbols = append(s.FreeSymbols, s.Outer.capture(owner, name))
+	symbol := Symbol{Name: name, Scope: FreeScope, Index: len(s.FreeSymbols) - 1}
+	s.captures[key] = symbol
+	return symbol
+}
+
+// Global returns the outermost table, which holds the globals.
+func (s *SymbolTable) Global() *SymbolTable {
+	for s.Outer != nil {
+		s = s.Outer
+	}
+	return s
+}
+
+// Names returns the names of the definitions in this table, indexed by
+// their slot.
+func (s *SymbolTable) Names() []string {
+	return append([]string{}, s.names...)
+}
+
+// Bound returns the names currently defined in this table, sorted.
+func (s *SymbolTable) Bound() []string {
+	names := []string{}
+	for name, symbol := range s.store {
+		if symbol.Scope != BuiltinScope && symbol.Scope != FreeScope {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,86 @@
+package compiler
+
+import "testing"
+
+func TestDefine(t *testing.T) {
+	global := NewSymbolTable()
+	a := global.Define("a")
+	b := global.Define("b")
+
+	if a != (Symbol{Name: "a", Scope: GlobalScope, Index: 0}) {
+		t.Errorf("a wrong. got=%+v", a)
+	}
+	if b != (Symbol{Name: "b", Scope: GlobalScope, Index: 1}) {
+		t.Errorf("b wrong. got=%+v", b)
+	}
+	if again := global.Define("a"); again != a {
+		t.Errorf("redefining a should keep its slot. got=%+v", again)
+	}
+
+	local := NewEnclosedSymbolTable(global)
+	local.captured = map[string]bool{"d": true}
+	c := local.Define("c")
+	d := local.Define("d")
+
+	if c != (Symbol{Name: "c", Scope: LocalScope, Index: 0}) {
+		t.Errorf("c wrong. got=%+v", c)
+	}
+	if d != (Symbol{Name: "d", Scope: CellScope, Index: 1}) {
+		t.Errorf("d wrong. got=%+v", d)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	global := NewSymbolTable()
+	global.DefineBuiltin(0, "len")
+	global.Define("a")
+
+	first := NewEnclosedSymbolTable(global)
+	first.captured = map[string]bool{"c": true}
+	first.Define("b")
+	first.Define("c")
+
+	second := NewEnclosedSymbolTable(first)
+	second.Define("d")
+
+	tests := []struct {
+		table    *SymbolTable
+		name     string
+		expected Symbol
+	}{
+		{global, "len", Symbol{Name: "len", Scope: BuiltinScope, Index: 0}},
+		{first, "a", Symbol{Name: "a", Scope: GlobalScope, Index: 0}},
+		{first, "c", Symbol{Name: "c", Scope: CellScope, Index: 1}},
+		{second, "len", Symbol{Name: "len", Scope: BuiltinScope, Index: 0}},
+		{second, "c", Symbol{Name: "c", Scope: FreeScope, Index: 0}},
+		{second, "d", Symbol{Name: "d", Scope: LocalScope, Index: 0}},
+	}
+
+	for _, tt := range tests {
+		result, ok := tt.table.Resolve(tt.name)
+		if !ok {
+			t.Errorf("name %s not resolvable", tt.name)
+			continue
+		}
+		if result != tt.expected {
+			t.Errorf("expected %s to resolve to %+v, got=%+v", tt.name, tt.expected, result)
+		}
+	}
+
+	if len(second.FreeSymbols) != 1 || second.FreeSymbols[0] != (Symbol{Name: "c", Scope: CellScope, Index: 1}) {
+		t.Errorf("wrong free symbols. got=%+v", second.FreeSymbols)
+	}
+
+	if _, ok := second.Resolve("e"); ok {
+		t.Errorf("name e resolved, but was never defined")
+	}
+}
+
+func TestDefineShadowsBuiltin(t *testing.T) {
+	global := NewSymbolTable()
+	global.DefineBuiltin(0, "len")
+
+	if symbol := global.Define("len"); symbol.Scope != GlobalScope {
+		t.Errorf("len should be redefined as a global. got=%+v", symbol)
+	}
+}
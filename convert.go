@@ -0,0 +1,536 @@
+// convert.go
+
+package mira
+
+import (
+	"fmt"
+	"math/big"
+	"mira/object"
+	"reflect"
+	"strings"
+)
+
+var (
+	objectType = reflect.TypeOf((*object.Object)(nil)).Elem()
+	execType   = reflect.TypeOf((*object.ExecContext)(nil))
+	errorType  = reflect.TypeOf((*error)(nil)).Elem()
+	bigIntType = reflect.TypeOf((*big.Int)(nil))
+)
+
+// ToObject converts a Go value to a Mira object:
+//
+//   - nil and nil pointers, slices and maps become null
+//   - bools, integers, floats and strings become the matching Mira values;
+//     *big.Int and integers beyond int64 become big integers
+//   - slices and arrays become arrays, maps become hashes
+//   - structs become hashes keyed by field name, which a `mira:"name"` tag
+//     overrides; fields tagged `mira:"-"` and unexported fields are left out
+//   - funcs become builtins, see below
+//   - object.Object values are returned unchanged
+//
+// Values that contain themselves, through pointers, slices or maps, cannot
+// be converted.
+//
+// A func is called with its arguments converted by FromObject, preceded
+// by the *object.ExecContext if that is its first parameter. It may have
+// a result, an error, or both. A non-nil error is raised in Mira as an
+// error with the same message; the result is converted by ToObject, and
+// without one the builtin returns null.
+func ToObject(v any) (object.Object, error) {
+	if v == nil {
+		return object.NULL, nil
+	}
+	return toObject(reflect.ValueOf(v), make(map[visit]bool))
+}
+
+// visit identifies a pointer, slice or map that toObject is converting.
+// Slices are told apart by length too, as a slice and a shorter one of the
+// same array share a pointer.
+type visit struct {
+	ptr uintptr
+	typ reflect.Type
+	len int
+}
+
+// toObject converts v to a Mira object. seen holds the pointers, slices and
+// maps being converted, to detect values that contain themselves.
+func toObject(v reflect.Value, seen map[visit]bool) (object.Object, error) {
+	if v.Type().Implements(objectType) {
+		if v.Kind() == reflect.Interface || v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				return object.NULL, nil
+			}
+		}
+		return v.Interface().(object.Object), nil
+	}
+	if v.Type() == bigIntType {
+		if v.IsNil() {
+			return object.NULL, nil
+		}
+		return object.IntegerFromBig(new(big.Int).Set(v.Interface().(*big.Int))), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Slice, reflect.Map:
+		if !v.IsNil() {
+			key := visit{ptr: v.Pointer(), typ: v.Type()}
+			if v.Kind() == reflect.Slice {
+				key.len = v.Len()
+			}
+			if seen[key] {
+				return nil, fmt.Errorf("cannot convert cyclic %s to a Mira object", v.Type())
+			}
+			seen[key] = true
+			defer delete(seen, key)
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		return object.NativeBool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &object.Integer{Value: v.Int()}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return object.IntegerFromBig(new(big.Int).SetUint64(v.Uint())), nil
+	case reflect.Float32, reflect.Float64:
+		return &object.Float{Value: v.Float()}, nil
+	case reflect.String:
+		return &object.String{Value: v.String()}, nil
+	case reflect.Interface, reflect.Pointer:
+		if v.IsNil() {
+			return object.NULL, nil
+		}
+		return toObject(v.Elem(), seen)
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return object.NULL, nil
+		}
+		elements := make([]object.Object, v.Len())
+		for i := range elements {
+			el, err := toObject(v.Index(i), seen)
+			if err != nil {
+				return nil, fmt.Errorf("index %d: %w", i, err)
+			}
+			elements[i] = el
+		}
+		return &object.Array{Elements: elements}, nil
+	case reflect.Map:
+		if v.IsNil() {
+			return object.NULL, nil
+		}
+		hash := &object.Hash{Pairs: make(map[object.HashKey]object.HashPair, v.Len())}
+		iter := v.MapRange()
+		for iter.Next() {
+			key, err := toObject(iter.Key(), seen)
+			if err != nil {
+				return nil, fmt.Errorf("key %v: %w", iter.Key(), err)
+			}
+			hashable, ok := key.(object.Hashable)
+			if !ok {
+				return nil, fmt.Errorf("unusable as hash key: %s", key.Type())
+			}
+			value, err := toObject(iter.Value(), seen)
+			if err != nil {
+				return nil, fmt.Errorf("key %v: %w", iter.Key(), err)
+			}
+			hash.Pairs[hashable.HashKey()] = object.HashPair{Key: key, Value: value}
+		}
+		return hash, nil
+	case reflect.Struct:
+		hash := &object.Hash{Pairs: make(map[object.HashKey]object.HashPair)}
+		for _, f := range structFields(v.Type()) {
+			// Fields promoted through a nil embedded pointer are left out.
+			field, err := v.FieldByIndexErr(f.index)
+			if err != nil {
+				continue
+			}
+			value, err := toObject(field, seen)
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %w", f.goName, err)
+			}
+			key := &object.String{Value: f.name}
+			hash.Pairs[key.HashKey()] = object.HashPair{Key: key, Value: value}
+		}
+		return hash, nil
+	case reflect.Func:
+		if v.IsNil() {
+			return object.NULL, nil
+		}
+		if out := v.Type().NumOut(); out > 2 || out == 2 && v.Type().Out(1) != errorType {
+			return nil, fmt.Errorf("cannot convert %s to a Mira object: too many results", v.Type())
+		}
+		return wrapFunc(v), nil
+	default:
+		return nil, fmt.Errorf("cannot convert %s to a Mira object", v.Type())
+	}
+}
+
+// FromObject stores obj in the value target points to, converting it to
+// the target's type. It accepts what ToObject produces for that type, and
+// also integers for floats and null for pointers, slices, maps and
+// interfaces. Into an interface{}, obj is stored as the natural Go value:
+// int64, *big.Int, float64, bool, string, nil, []any, and map[string]any
+// for hashes with string keys or map[any]any for others. Functions are
+// stored as the object itself.
+//
+// Hash keys that match no field of a target struct are ignored, and fields
+// without a key are left as they are.
+func FromObject(obj object.Object, target any) error {
+	v := reflect.ValueOf(target)
+	if v.Kind() != reflect.Pointer || v.IsNil() {
+		return fmt.Errorf("FromObject: target must be a non-nil pointer, got %T", target)
+	}
+	return fromObject(obj, v.Elem())
+}
+
+func fromObject(obj object.Object, v reflect.Value) error {
+	t := v.Type()
+
+	if t == objectType {
+		v.Set(reflect.ValueOf(obj))
+		return nil
+	}
+	if obj == object.NULL {
+		switch v.Kind() {
+		case reflect.Pointer, reflect.Slice, reflect.Map, reflect.Interface:
+			v.SetZero()
+			return nil
+		}
+	}
+	if t == bigIntType {
+		switch obj := obj.(type) {
+		case *object.Integer:
+			v.Set(reflect.ValueOf(big.NewInt(obj.Value)))
+			return nil
+		case *object.BigInteger:
+			v.Set(reflect.ValueOf(new(big.Int).Set(obj.Value)))
+			return nil
+		}
+		return cannotConvert(obj, t)
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		b, ok := obj.(*object.Bool)
+		if !ok {
+			return cannotConvert(obj, t)
+		}
+		v.SetBool(b.Value)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, ok := obj.(*object.Integer)
+		if !ok {
+			return cannotConvert(obj, t)
+		}
+		if v.OverflowInt(i.Value) {
+			return fmt.Errorf("%d overflows %s", i.Value, t)
+		}
+		v.SetInt(i.Value)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		var u uint64
+		switch obj := obj.(type) {
+		case *object.Integer:
+			if obj.Value < 0 {
+				return fmt.Errorf("%d overflows %s", obj.Value, t)
+			}
+			u = uint64(obj.Value)
+		case *object.BigInteger:
+			if !obj.Value.IsUint64() {
+				return fmt.Errorf("%s overflows %s", obj.Value, t)
+			}
+			u = obj.Value.Uint64()
+		default:
+			return cannotConvert(obj, t)
+		}
+		if v.OverflowUint(u) {
+			return fmt.Errorf("%d overflows %s", u, t)
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		switch obj := obj.(type) {
+		case *object.Float:
+			v.SetFloat(obj.Value)
+		case *object.Integer:
+			v.SetFloat(float64(obj.Value))
+		case *object.BigInteger:
+			f, _ := new(big.Float).SetInt(obj.Value).Float64()
+			v.SetFloat(f)
+		default:
+			return cannotConvert(obj, t)
+		}
+	case reflect.String:
+		s, ok := obj.(*object.String)
+		if !ok {
+			return cannotConvert(obj, t)
+		}
+		v.SetString(s.Value)
+	case reflect.Pointer:
+		elem := reflect.New(t.Elem())
+		if err := fromObject(obj, elem.Elem()); err != nil {
+			return err
+		}
+		v.Set(elem)
+	case reflect.Slice, reflect.Array:
+		arr, ok := obj.(*object.Array)
+		if !ok {
+			return cannotConvert(obj, t)
+		}
+		if v.Kind() == reflect.Slice {
+			v.Set(reflect.MakeSlice(t, len(arr.Elements), len(arr.Elements)))
+		} else if v.Len() != len(arr.Elements) {
+			return fmt.Errorf("cannot convert ARRAY of length %d to %s", len(arr.Elements), t)
+		}
+		for i, el := range arr.Elements {
+			if err := fromObject(el, v.Index(i)); err != nil {
+				return fmt.Errorf("index %d: %w", i, err)
+			}
+		}
+	case reflect.Map:
+		hash, ok := obj.(*object.Hash)
+		if !ok {
+			return cannotConvert(obj, t)
+		}
+		m := reflect.MakeMapWithSize(t, len(hash.Pairs))
+		for _, pair := range hash.SortedPairs() {
+			key := reflect.New(t.Key()).Elem()
+			if err := fromObject(pair.Key, key); err != nil {
+				return fmt.Errorf("key %s: %w", pair.Key.Inspect(), err)
+			}
+			value := reflect.New(t.Elem()).Elem()
+			if err := fromObject(pair.Value, value); err != nil {
+				return fmt.Errorf("key %s: %w", pair.Key.Inspect(), err)
+			}
+			m.SetMapIndex(key, value)
+		}
+		v.Set(m)
+	case reflect.Struct:
+		hash, ok := obj.(*object.Hash)
+		if !ok {
+			return cannotConvert(obj, t)
+		}
+		for _, f := range structFields(t) {
+			key := &object.String{Value: f.name}
+			pair, ok := hash.Pairs[key.HashKey()]
+			if !ok {
+				continue
+			}
+			field, err := fieldByIndexAlloc(v, f.index)
+			if err != nil {
+				return fmt.Errorf("field %s: %w", f.goName, err)
+			}
+			if err := fromObject(pair.Value, field); err != nil {
+				return fmt.Errorf("field %s: %w", f.goName, err)
+			}
+		}
+	case reflect.Interface:
+		value, err := toGo(obj, map[object.Object]bool{})
+		if err != nil {
+			return err
+		}
+		if value == nil {
+			v.SetZero()
+			return nil
+		}
+		rv := reflect.ValueOf(value)
+		if !rv.Type().AssignableTo(t) {
+			return cannotConvert(obj, t)
+		}
+		v.Set(rv)
+	default:
+		return cannotConvert(obj, t)
+	}
+
+	return nil
+}
+
+// toGo returns the natural Go value of obj. seen holds the arrays and hashes
+// being converted, so that one that contains itself is an error rather
+// than endless recursion.
+func toGo(obj object.Object, seen map[object.Object]bool) (any, error) {
+	switch obj.(type) {
+	case *object.Array, *object.Hash:
+		if seen[obj] {
+			return nil, fmt.Errorf("cannot convert cyclic %s to a Go value", obj.Type())
+		}
+		seen[obj] = true
+		defer delete(seen, obj)
+	}
+
+	switch obj := obj.(type) {
+	case *object.Null:
+		return nil, nil
+	case *object.Integer:
+		return obj.Value, nil
+	case *object.BigInteger:
+		return new(big.Int).Set(obj.Value), nil
+	case *object.Float:
+		return obj.Value, nil
+	case *object.Bool:
+		return obj.Value, nil
+	case *object.String:
+		return obj.Value, nil
+	case *object.Array:
+		s := make([]any, len(obj.Elements))
+		for i, el := range obj.Elements {
+			value, err := toGo(el, seen)
+			if err != nil {
+				return nil, fmt.Errorf("index %d: %w", i, err)
+			}
+			s[i] = value
+		}
+		return s, nil
+	case *object.Hash:
+		pairs := obj.SortedPairs()
+		stringKeys := true
+		for _, pair := range pairs {
+			if _, ok := pair.Key.(*object.String); !ok {
+				stringKeys = false
+			}
+		}
+
+		m := make(map[any]any, len(pairs))
+		ms := make(map[string]any, len(pairs))
+		for _, pair := range pairs {
+			value, err := toGo(pair.Value, seen)
+			if err != nil {
+				return nil, fmt.Errorf("key %s: %w", pair.Key.Inspect(), err)
+			}
+			if stringKeys {
+				ms[pair.Key.(*object.String).Value] = value
+				continue
+			}
+			key, err := toGo(pair.Key, seen)
+			if err != nil {
+				return nil, err
+			}
+			if k, ok := key.(*big.Int); ok {
+				key = k.String()
+			}
+			m[key] = value
+		}
+		if stringKeys {
+			return ms, nil
+		}
+		return m, nil
+	case *object.Function, *object.Builtin, *object.Closure:
+		return obj, nil
+	default:
+		return nil, fmt.Errorf("cannot convert %s to a Go value", obj.Type())
+	}
+}
+
+func cannotConvert(obj object.Object, t reflect.Type) error {
+	return fmt.Errorf("cannot convert %s to %s", obj.Type(), t)
+}
+
+type structField struct {
+	name   string // Hash key
+	goName string
+	index  []int
+}
+
+// structFields lists the exported fields of t that are converted, with
+// the fields of embedded structs promoted as encoding/json does.
+func structFields(t reflect.Type) []structField {
+	var fields []structField
+	for _, f := range reflect.VisibleFields(t) {
+		if !f.IsExported() || f.Anonymous && isStruct(f.Type) {
+			continue
+		}
+
+		name := f.Name
+		if tag, ok := f.Tag.Lookup("mira"); ok {
+			tag, _, _ = strings.Cut(tag, ",")
+			if tag == "-" {
+				continue
+			}
+			if tag != "" {
+				name = tag
+			}
+		}
+		fields = append(fields, structField{name: name, goName: f.Name, index: f.Index})
+	}
+	return fields
+}
+
+// isStruct reports whether t is a struct or a pointer to one, the embedded
+// fields whose own fields are promoted.
+func isStruct(t reflect.Type) bool {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct
+}
+
+// fieldByIndexAlloc is reflect.Value.FieldByIndex, except that it allocates
+// the nil embedded pointers on the way to the field.
+func fieldByIndexAlloc(v reflect.Value, index []int) (reflect.Value, error) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				if !v.CanSet() {
+					return reflect.Value{}, fmt.Errorf("cannot set embedded pointer to unexported struct %s", v.Type().Elem())
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, nil
+}
+
+// wrapFunc exposes the Go func fn to Mira as a builtin.
+func wrapFunc(fn reflect.Value) *object.Builtin {
+	t := fn.Type()
+
+	numOut := t.NumOut()
+	returnsError := numOut > 0 && t.Out(numOut-1) == errorType
+	if returnsError {
+		numOut--
+	}
+
+	first := 0
+	if t.NumIn() > 0 && t.In(0) == execType {
+		first = 1
+	}
+
+	return &object.Builtin{Fn: func(ctx *object.ExecContext, args ...object.Object) object.Object {
+		numIn := t.NumIn() - first
+		if t.IsVariadic() && len(args) < numIn-1 || !t.IsVariadic() && len(args) != numIn {
+			return &object.Error{Message: fmt.Sprintf("wrong number of arguments: want=%d, got=%d", numIn, len(args))}
+		}
+
+		in := make([]reflect.Value, first, first+len(args))
+		if first == 1 {
+			in[0] = reflect.ValueOf(ctx)
+		}
+		for i, arg := range args {
+			var argType reflect.Type
+			if t.IsVariadic() && i >= numIn-1 {
+				argType = t.In(t.NumIn() - 1).Elem()
+			} else {
+				argType = t.In(first + i)
+			}
+
+			v := reflect.New(argType).Elem()
+			if err := fromObject(arg, v); err != nil {
+				return &object.Error{Message: fmt.Sprintf("argument %d: %s", i+1, err)}
+			}
+			in = append(in, v)
+		}
+
+		out := fn.Call(in)
+		if returnsError && !out[len(out)-1].IsNil() {
+			return &object.Error{Message: out[len(out)-1].Interface().(error).Error()}
+		}
+		if numOut == 0 {
+			return object.NULL
+		}
+
+		result, err := toObject(out[0], make(map[visit]bool))
+		if err != nil {
+			return &object.Error{Message: err.Error()}
+		}
+		return result
+	}}
+}
@@ -0,0 +1,283 @@
+package mira
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"mira/object"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type address struct {
+	City string `mira:"city"`
+	Zip  *int   `mira:"zip"`
+}
+
+type person struct {
+	Name    string   `mira:"name"`
+	Age     int      `mira:"age"`
+	Tags    []string `mira:"tags,omitempty"`
+	Home    address  `mira:"home"`
+	Secret  string   `mira:"-"`
+	private int
+	Score   float64
+}
+
+type Inner struct {
+	X int
+}
+
+type outer struct {
+	*Inner
+	Y int
+}
+
+type hidden struct {
+	X int
+}
+
+type outerHidden struct {
+	*hidden
+	Y int
+}
+
+type node struct {
+	Next *node
+	Prev *node
+}
+
+func TestToObject(t *testing.T) {
+	zip := 12345
+	shared := &node{}
+	loop := &node{}
+	loop.Next = loop
+	slice := []any{1}
+	slice[0] = slice
+	hash := map[string]any{}
+	hash["h"] = []any{hash}
+	tests := []struct {
+		input    any
+		expected string
+	}{
+		{nil, "null"},
+		{true, "true"},
+		{42, "42"},
+		{int8(-3), "-3"},
+		{uint64(math.MaxUint64), "18446744073709551615"},
+		{big.NewInt(7), "7"},
+		{1.5, "1.5"},
+		{"hi", "hi"},
+		{[]int{1, 2}, "[1, 2]"},
+		{[2]bool{true, false}, "[true, false]"},
+		{[]int(nil), "null"},
+		{map[string]int{"b": 2, "a": 1}, "{a: 1, b: 2}"},
+		{map[int][]string{1: {"x"}}, "{1: [x]}"},
+		{(*int)(nil), "null"},
+		{&zip, "12345"},
+		{[]any{1, "a", nil}, "[1, a, null]"},
+		{&object.Integer{Value: 9}, "9"},
+		{
+			person{Name: "Ann", Age: 30, Home: address{City: "Oslo", Zip: &zip}, Secret: "x", private: 1},
+			"{Score: 0.0, age: 30, home: {city: Oslo, zip: 12345}, name: Ann, tags: null}",
+		},
+		{outer{Inner: &Inner{X: 2}, Y: 1}, "{X: 2, Y: 1}"},
+		// Fields behind a nil embedded pointer are left out.
+		{outer{Y: 1}, "{Y: 1}"},
+		{outerHidden{Y: 1}, "{Y: 1}"},
+		// A value seen twice is only a cycle if it contains itself.
+		{node{Next: shared, Prev: shared}, "{Next: {Next: null, Prev: null}, Prev: {Next: null, Prev: null}}"},
+	}
+
+	for _, tt := range tests {
+		obj, err := ToObject(tt.input)
+		if err != nil {
+			t.Errorf("ToObject(%#v) failed: %s", tt.input, err)
+			continue
+		}
+		if obj.Inspect() != tt.expected {
+			t.Errorf("ToObject(%#v) wrong. expected=%q, got=%q", tt.input, tt.expected, obj.Inspect())
+		}
+	}
+
+	errorTests := []struct {
+		input    any
+		expected string
+	}{
+		{make(chan int), "cannot convert chan int to a Mira object"},
+		{[]any{1, complex(1, 2)}, "index 1: cannot convert complex128 to a Mira object"},
+		{map[[2]int]int{{1, 2}: 3}, "unusable as hash key: ARRAY"},
+		{func() (int, int) { return 1, 2 }, "too many results"},
+		{loop, "field Next: cannot convert cyclic *mira.node to a Mira object"},
+		{slice, "index 0: cannot convert cyclic []interface {} to a Mira object"},
+		{hash, "key h: index 0: cannot convert cyclic map[string]interface {} to a Mira object"},
+	}
+
+	for _, tt := range errorTests {
+		_, err := ToObject(tt.input)
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("ToObject(%T) wrong error. expected=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestFromObject(t *testing.T) {
+	interp := NewInterpreter(Options{})
+	eval := func(input string) object.Object {
+		t.Helper()
+		obj, err := interp.RunString(input)
+		if err != nil {
+			t.Fatalf("%q: %s", input, err)
+		}
+		return obj
+	}
+
+	var p person
+	p.Secret = "kept"
+	if err := FromObject(eval(`{"name": "Bo", "age": 4, "tags": ["a"], "home": {"city": "Rome", "zip": 1}, "extra": 1, "Score": 2}`), &p); err != nil {
+		t.Fatalf("FromObject failed: %s", err)
+	}
+	zip := 1
+	expected := person{Name: "Bo", Age: 4, Tags: []string{"a"}, Home: address{City: "Rome", Zip: &zip}, Secret: "kept", Score: 2}
+	if !reflect.DeepEqual(p, expected) {
+		t.Errorf("wrong struct. expected=%+v, got=%+v", expected, p)
+	}
+
+	var m map[string][]int
+	if err := FromObject(eval(`{"a": [1, 2], "b": []}`), &m); err != nil {
+		t.Fatalf("FromObject failed: %s", err)
+	}
+	if !reflect.DeepEqual(m, map[string][]int{"a": {1, 2}, "b": {}}) {
+		t.Errorf("wrong map. got=%v", m)
+	}
+
+	var v any
+	if err := FromObject(eval(`[1, 2.5, "s", true, if (false) { 1 }, {"k": [1]}, 100000000000000000000]`), &v); err != nil {
+		t.Fatalf("FromObject failed: %s", err)
+	}
+	large, _ := new(big.Int).SetString("100000000000000000000", 10)
+	expectedAny := []any{int64(1), 2.5, "s", true, nil, map[string]any{"k": []any{int64(1)}}, large}
+	if !reflect.DeepEqual(v, expectedAny) {
+		t.Errorf("wrong value. expected=%#v, got=%#v", expectedAny, v)
+	}
+
+	var keyed any
+	if err := FromObject(eval(`{1: "a"}`), &keyed); err != nil {
+		t.Fatalf("FromObject failed: %s", err)
+	}
+	if !reflect.DeepEqual(keyed, map[any]any{int64(1): "a"}) {
+		t.Errorf("wrong value. got=%#v", keyed)
+	}
+
+	var o outer
+	if err := FromObject(eval(`{"Y": 4}`), &o); err != nil || o.Inner != nil || o.Y != 4 {
+		t.Errorf("wrong struct. got=%+v (err %v)", o, err)
+	}
+	// A nil embedded pointer is allocated to set the fields behind it.
+	if err := FromObject(eval(`{"X": 3, "Y": 4}`), &o); err != nil || o.Inner == nil || o.X != 3 || o.Y != 4 {
+		t.Errorf("wrong struct. got=%+v (err %v)", o, err)
+	}
+
+	var obj object.Object
+	if err := FromObject(eval(`[1]`), &obj); err != nil || obj.Inspect() != "[1]" {
+		t.Errorf("wrong object. got=%v (err %v)", obj, err)
+	}
+
+	errorTests := []struct {
+		input    string
+		target   any
+		expected string
+	}{
+		{`"a"`, new(int), "cannot convert STRING to int"},
+		{`300`, new(int8), "300 overflows int8"},
+		{`-1`, new(uint), "-1 overflows uint"},
+		{`[1, "a"]`, new([]int), "index 1: cannot convert STRING to int"},
+		{`[1, 2]`, new([3]int), "cannot convert ARRAY of length 2 to [3]int"},
+		{`{"age": "old"}`, new(person), "field Age: cannot convert STRING to int"},
+		{`{"a": 1}`, new(map[int]int), "key a: cannot convert STRING to int"},
+		{`1`, 0, "target must be a non-nil pointer, got int"},
+		{`{"X": 1}`, new(outerHidden), "field X: cannot set embedded pointer to unexported struct mira.hidden"},
+		{`let a = [1]; a[0] = a; a`, new(any), "index 0: cannot convert cyclic ARRAY to a Go value"},
+		{`let h = {}; h["h"] = [h]; h`, new(any), "cannot convert cyclic HASH to a Go value"},
+	}
+
+	for _, tt := range errorTests {
+		err := FromObject(eval(tt.input), tt.target)
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("%q: wrong error. expected=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestFuncBuiltins(t *testing.T) {
+	var out bytes.Buffer
+	interp := NewInterpreter(Options{Stdout: &out})
+
+	funcs := map[string]any{
+		"add":  func(a, b int) int { return a + b },
+		"join": func(sep string, parts ...string) string { return strings.Join(parts, sep) },
+		"div": func(a, b float64) (float64, error) {
+			if b == 0 {
+				return 0, errors.New("division by zero")
+			}
+			return a / b, nil
+		},
+		"greet": func(p person) string { return "hi " + p.Name },
+		"noop":  func() {},
+		"shout": func(ctx *object.ExecContext, s string) { fmt.Fprint(ctx.Stdout, strings.ToUpper(s)) },
+	}
+	for name, fn := range funcs {
+		obj, err := ToObject(fn)
+		if err != nil {
+			t.Fatalf("ToObject(%s) failed: %s", name, err)
+		}
+		interp.Set(name, obj)
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`add(1, 2)`, "3"},
+		{`join("-", "a", "b", "c")`, "a-b-c"},
+		{`join(",")`, ""},
+		{`div(1, 4)`, "0.25"},
+		{`greet({"name": "Al"})`, "hi Al"},
+		{`noop()`, "null"},
+		{`shout("hey")`, "null"},
+	}
+
+	for _, tt := range tests {
+		result, err := interp.RunString(tt.input)
+		if err != nil {
+			t.Errorf("%q: %s", tt.input, err)
+			continue
+		}
+		if result.Inspect() != tt.expected {
+			t.Errorf("%q: wrong result. expected=%q, got=%q", tt.input, tt.expected, result.Inspect())
+		}
+	}
+
+	if out.String() != "HEY" {
+		t.Errorf("wrong output. expected=%q, got=%q", "HEY", out.String())
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{`div(1, 0)`, "ERROR: 1:1: division by zero"},
+		{`add(1)`, "ERROR: 1:1: wrong number of arguments: want=2, got=1"},
+		{`add(1, "2")`, "ERROR: 1:1: argument 2: cannot convert STRING to int"},
+	}
+
+	for _, tt := range errorTests {
+		_, err := interp.RunString(tt.input)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%q: wrong error. expected=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package evaluator
+
+import (
+	"context"
+	"mira/object"
+	"mira/token"
+)
+
+// Context holds the state of a single evaluation. Every call to a Mira
+// function pushes a frame onto its call stack, which is captured into the
+// stack trace of any error raised while the call is active.
+//
+// A Context also bounds the evaluation: it is aborted with an error once
+// its context.Context is done or it exceeds its Limits.
+type Context struct {
+	frames []frame
+
+	ctx    context.Context
+	done   <-chan struct{}
+	limits Limits
+	steps  int
+	memory int64
+
+	exec *object.ExecContext
+}
+
+// Limits bound the resources an evaluation may use. Zero means no limit.
+type Limits = object.Limits
+
+// DefaultMaxDepth is the call depth NewContext allows, well within what
+// the Go stack can hold.
+const DefaultMaxDepth = 10000
+
+type frame struct {
+	function string         // Name of the function being executed
+	callSite token.Position // Where it was called from
+}
+
+// NewContext returns a Context that limits the call depth to
+// DefaultMaxDepth and is never cancelled.
+func NewContext() *Context {
+	return NewContextWithLimits(context.Background(), Limits{MaxDepth: DefaultMaxDepth})
+}
+
+// NewContextWithLimits returns a Context that is cancelled with ctx and
+// bounded by limits. Without a MaxDepth, deep recursion can overflow the
+// Go stack.
+func NewContextWithLimits(ctx context.Context, limits Limits) *Context {
+	return &Context{ctx: ctx, done: ctx.Done(), limits: limits, exec: object.Stdio()}
+}
+
+// SetExecContext sets the streams builtins use, which are the process's
+// standard streams by default.
+func (c *Context) SetExecContext(exec *object.ExecContext) {
+	c.exec = exec
+}
+
+// Steps returns the number of syntax tree nodes evaluated so far.
+func (c *Context) Steps() int {
+	return c.steps
+}
+
+// step counts the evaluation of a node, failing once the step budget is
+// spent or the context is done.
+func (c *Context) step() *object.Error {
+	c.steps++
+	if c.limits.MaxSteps > 0 && c.steps > c.limits.MaxSteps {
+		return limitError(object.ErrStepLimit)
+	}
+
+	if c.done != nil {
+		select {
+		case <-c.done:
+			return limitError(c.ctx.Err())
+		default:
+		}
+	}
+	return nil
+}
+
+// Memory returns the approximate number of bytes allocated so far for
+// strings, arrays and hashes. Memory is counted when an object is created
+// and never given back, so this is the total ever allocated rather than
+// what is still in use.
+func (c *Context) Memory() int64 {
+	return c.memory
+}
+
+// allocate charges obj, which has just been created, against the memory
+// limit. It returns obj, or an error once the limit is exceeded.
+func (c *Context) allocate(obj object.Object) object.Object {
+	size := object.Size(obj)
+	if size == 0 {
+		return obj
+	}
+
+	if err := c.charge(size); err != nil {
+		return err
+	}
+	return obj
+}
+
+// charge counts size more bytes as allocated, returning an error once the
+// memory limit is exceeded.
+func (c *Context) charge(size int64) *object.Error {
+	c.memory += size
+	if c.limits.MaxMemory > 0 && c.memory > c.limits.MaxMemory {
+		return limitError(object.ErrMemoryLimit)
+	}
+	return nil
+}
+
+func (c *Context) push(function string, callSite token.Position) *object.Error {
+	if c.limits.MaxDepth > 0 && len(c.frames) >= c.limits.MaxDepth {
+		return limitError(object.ErrStackDepth)
+	}
+
+	c.frames = append(c.frames, frame{function: function, callSite: callSite})
+	return nil
+}
+
+func (c *Context) pop() {
+	c.frames = c.frames[:len(c.frames)-1]
+}
+
+// stackTrace snapshots the call stack for an error raised at pos. Frames
+// are ordered innermost first, each holding the position execution had
+// reached in that function.
+func (c *Context) stackTrace(pos token.Position) []object.Frame {
+	trace := make([]object.Frame, 0, len(c.frames)+1)
+
+	for i := len(c.frames) - 1; i >= 0; i-- {
+		trace = append(trace, object.Frame{Function: c.frames[i].function, Pos: pos})
+		pos = c.frames[i].callSite
+	}
+
+	return append(trace, object.Frame{Function: "<main>", Pos: pos})
+}
+
+// tailCall is a call in tail position, made by the trampoline in
+// applyFunction after the calling function has returned it.
+type tailCall struct {
+	fn   *object.Function
+	args []object.Object
+}
+
+func (tc *tailCall) Type() object.ObjectType { return "TAIL_CALL" }
+func (tc *tailCall) Inspect() string         { return "tail call to " + functionName(tc.fn) }
+
+func limitError(cause error) *object.Error {
+	return &object.Error{Message: cause.Error(), Cause: cause}
+}
+
+func functionName(fn *object.Function) string {
+	if fn.Name == "" {
+		return "<anonymous>"
+	}
+	return fn.Name
+}
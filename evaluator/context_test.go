@@ -0,0 +1,173 @@
+package evaluator
+
+import (
+	"context"
+	"errors"
+	"mira/compiler"
+	"mira/lexer"
+	"mira/object"
+	"mira/parser"
+	"mira/vm"
+	"strings"
+	"testing"
+	"time"
+)
+
+func evalWithContext(c *Context, input string) object.Object {
+	program := parser.New(lexer.New(input)).ParseProgram()
+	return c.Eval(program, object.NewEnv())
+}
+
+// runWithLimits runs input on a VM with the given limits.
+func runWithLimits(t *testing.T, ctx context.Context, limits Limits, input string) (object.Object, *vm.VM) {
+	t.Helper()
+
+	program := parser.New(lexer.New(input)).ParseProgram()
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("%q: compiler error: %s", input, err)
+	}
+	machine := vm.New(comp.Bytecode())
+	machine.SetLimits(ctx, limits)
+	return machine.Run(), machine
+}
+
+func TestLimits(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	timeout, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		limits   Limits
+		input    string
+		expected error
+		message  string
+	}{
+		{"depth", context.Background(), Limits{MaxDepth: 100},
+			"let f = fn(n) { 1 + f(n + 1) }; f(0)", object.ErrStackDepth, "ERROR: 1:21: stack depth exceeded"},
+		{"steps", context.Background(), Limits{MaxSteps: 1000},
+			"let loop = fn() { loop() }; loop()", object.ErrStepLimit, "ERROR: 1:19: step limit exceeded"},
+		{"loop steps", context.Background(), Limits{MaxSteps: 1000},
+			"while (true) {}", object.ErrStepLimit, "ERROR: 1:8: step limit exceeded"},
+		{"cancelled", cancelled, Limits{},
+			"1 + 2", context.Canceled, "ERROR: 1:1: context canceled"},
+		{"deadline", timeout, Limits{},
+			"let loop = fn() { loop() }; loop()", context.DeadlineExceeded, "context deadline exceeded"},
+	}
+
+	for _, tt := range tests {
+		evaluated := evalWithContext(NewContextWithLimits(tt.ctx, tt.limits), tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%s: no error object returned, got=%T(%+v)", tt.name, evaluated, evaluated)
+			continue
+		}
+		if !errors.Is(errObj, tt.expected) {
+			t.Errorf("%s: wrong cause. expected=%v, got=%v", tt.name, tt.expected, errObj.Cause)
+		}
+		if !strings.HasSuffix(errObj.Inspect(), tt.message) {
+			t.Errorf("%s: wrong error. expected=%q, got=%q", tt.name, tt.message, errObj.Inspect())
+		}
+
+		// The VM counts steps differently, so it may stop elsewhere, but
+		// with the same error.
+		executed, _ := runWithLimits(t, tt.ctx, tt.limits, tt.input)
+		vmErr, ok := executed.(*object.Error)
+		if !ok {
+			t.Errorf("%s: no error object returned by the vm, got=%T(%+v)", tt.name, executed, executed)
+			continue
+		}
+		if !errors.Is(vmErr, tt.expected) || vmErr.Message != errObj.Message {
+			t.Errorf("%s: vm and evaluator differ. evaluator=%q, vm=%q (cause %v)", tt.name, errObj.Message, vmErr.Message, vmErr.Cause)
+		}
+	}
+}
+
+func TestDefaultMaxDepth(t *testing.T) {
+	c := NewContext()
+	evaluated := evalWithContext(c, "let f = fn(n) { 1 + f(n + 1) }; f(0)")
+
+	errObj, ok := evaluated.(*object.Error)
+	if !ok || !errors.Is(errObj, object.ErrStackDepth) {
+		t.Fatalf("expected a stack depth error, got=%T(%+v)", evaluated, evaluated)
+	}
+	if len(errObj.Stack) != DefaultMaxDepth+1 {
+		t.Errorf("wrong stack depth. expected=%d, got=%d", DefaultMaxDepth+1, len(errObj.Stack))
+	}
+	if c.Steps() == 0 {
+		t.Errorf("no steps counted")
+	}
+
+	// Errors in the program itself have no cause.
+	if errObj := evalWithContext(NewContext(), "-true").(*object.Error); errObj.Cause != nil {
+		t.Errorf("unexpected cause %v", errObj.Cause)
+	}
+}
+
+func TestMemory(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{`1 + 2`, 0},
+		{`"abc"`, 19},
+		{`"a" + "b"`, 17 + 17 + 18},
+		{`"x${1}"`, 17 + 18},
+		{`[1, 2]`, 56},
+		{`{"a": 1}`, 17 + 112},
+		{`first([[1]])`, 40 + 40},
+		{`let a = [[1], [2]]; last(a); last(a)`, 40 + 40 + 56},
+		{`push([], 1)`, 24 + 40},
+		{`let s = "a"; s += "b"`, 17 + 17 + 18},
+		{`let h = {}; h[1] = 2; h[1] = 3; h[1] += 1`, 48 + 64},
+		{`for (c in "ab") {}`, 18 + 17 + 17},
+		{`for (x in range(100)) {}`, 0},
+	}
+
+	for _, tt := range tests {
+		c := NewContext()
+		evalWithContext(c, tt.input)
+		if c.Memory() != tt.expected {
+			t.Errorf("%q: wrong memory. expected=%d, got=%d", tt.input, tt.expected, c.Memory())
+		}
+		if _, machine := runWithLimits(t, context.Background(), Limits{}, tt.input); machine.Memory() != tt.expected {
+			t.Errorf("%q: wrong memory on the vm. expected=%d, got=%d", tt.input, tt.expected, machine.Memory())
+		}
+	}
+}
+
+func TestMemoryLimit(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let grow = fn(arr) { grow(push(arr, 1)) }; grow([])`, "ERROR: 1:27: memory limit exceeded"},
+		{`let grow = fn(s) { grow(s + s) }; grow("x")`, "ERROR: 1:25: memory limit exceeded"},
+		{`let h = {}; let fill = fn(i) { h[i] = i; fill(i + 1) }; fill(0)`, "ERROR: 1:32: memory limit exceeded"},
+	}
+
+	for _, tt := range tests {
+		c := NewContextWithLimits(context.Background(), Limits{MaxMemory: 1 << 20})
+		evaluated := evalWithContext(c, tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok || !errors.Is(errObj, object.ErrMemoryLimit) {
+			t.Errorf("%q: expected a memory limit error, got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Inspect() != tt.expected {
+			t.Errorf("%q: wrong error. expected=%q, got=%q", tt.input, tt.expected, errObj.Inspect())
+		}
+		if c.Memory() <= 1<<20 {
+			t.Errorf("%q: memory within the limit: %d", tt.input, c.Memory())
+		}
+
+		executed, _ := runWithLimits(t, context.Background(), Limits{MaxMemory: 1 << 20}, tt.input)
+		if vmErr, ok := executed.(*object.Error); !ok || !errors.Is(vmErr, object.ErrMemoryLimit) {
+			t.Errorf("%q: expected a memory limit error from the vm, got=%T(%+v)", tt.input, executed, executed)
+		}
+	}
+}
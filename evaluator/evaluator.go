@@ -4,146 +4,273 @@ import (
 	"fmt"
 	"mira/ast"
 	"mira/object"
+	"mira/token"
+	"strings"
 )
 
 var (
-	NULL  = &object.Null{}
-	TRUE  = &object.Bool{Value: true}
-	FALSE = &object.Bool{Value: false}
+	NULL  = object.NULL
+	TRUE  = object.TRUE
+	FALSE = object.FALSE
 )
 
+// Eval evaluates node in env with a fresh Context from NewContext.
 func Eval(node ast.Node, env *object.Env) object.Object {
+	return NewContext().Eval(node, env)
+}
+
+// Eval evaluates node in env. Errors raised while evaluating node are
+// stamped with the position of the innermost node that produced them and
+// with the call stack at that point.
+func (c *Context) Eval(node ast.Node, env *object.Env) object.Object {
+	return c.locate(node, c.eval(node, env, false))
+}
+
+// evalTail is Eval for a node in tail position of a function body. Calls
+// to Mira functions there are not made but returned as a *tailCall, for
+// applyFunction to make once the current call has been left.
+func (c *Context) evalTail(node ast.Node, env *object.Env) object.Object {
+	return c.locate(node, c.eval(node, env, true))
+}
+
+// locate stamps an error that does not have a position yet with the
+// position of node and the current call stack.
+func (c *Context) locate(node ast.Node, result object.Object) object.Object {
+	if err, ok := result.(*object.Error); ok && !err.Pos.IsValid() && node != nil {
+		err.Pos = node.Pos()
+		err.Stack = c.stackTrace(err.Pos)
+	}
+
+	return result
+}
+
+func (c *Context) eval(node ast.Node, env *object.Env, tail bool) object.Object {
+	if err := c.step(); err != nil {
+		return err
+	}
+
 	switch node := node.(type) {
 	case *ast.Program:
-		return evalProgram(node, env)
+		return c.evalProgram(node, env)
 	case *ast.FunctionLiteral:
 		params := node.Parameters
 		body := node.Body
 		return &object.Function{Parameters: params, Body: body, Env: env}
 	case *ast.CallExpression:
 		if node.Function.String() == "quote" {
-			return quote(node.Arguments[0], env)
+			return c.quote(node.Arguments[0], env)
 		}
-		fn := Eval(node.Function, env)
-		if isError(fn) {
+		fn := c.Eval(node.Function, env)
+		if isAbrupt(fn) {
 			return fn
 		}
 
-		args := evalExpressions(node.Arguments, env)
-		if len(args) == 1 && isError(args[0]) {
+		args := c.evalExpressions(node.Arguments, env)
+		if len(args) == 1 && isAbrupt(args[0]) {
 			return args[0]
 		}
 
-		return applyFunction(fn, args)
+		if fn, ok := fn.(*object.Function); ok && tail && len(args) == len(fn.Parameters) {
+			return &tailCall{fn: fn, args: args}
+		}
+		return c.applyFunction(fn, args, node.Pos())
 	case *ast.ExpressionStatement:
-		return Eval(node.Expression, env)
+		if tail {
+			return c.evalTail(node.Expression, env)
+		}
+		return c.Eval(node.Expression, env)
 	case *ast.PrefixExpression:
-		right := Eval(node.Right, env)
-		if isError(right) {
+		if node.Operator == "++" || node.Operator == "--" {
+			return c.evalIncDecExpression(node, env)
+		}
+
+		right := c.Eval(node.Right, env)
+		if isAbrupt(right) {
 			return right
 		}
-		return evalPrefixExpression(node.Operator, right)
+		return object.Prefix(node.Operator, right)
 	case *ast.InfixExpression:
-		left := Eval(node.Left, env)
-		if isError(left) {
+		if object.IsLogical(node.Operator) {
+			return c.evalLogicalExpression(node, env, tail)
+		}
+
+		left := c.Eval(node.Left, env)
+		if isAbrupt(left) {
 			return left
 		}
 
-		right := Eval(node.Right, env)
-		if isError(right) {
+		right := c.Eval(node.Right, env)
+		if isAbrupt(right) {
 			return right
 		}
-		return evalInfixExpression(left, node.Operator, right)
+		result := object.Infix(left, node.Operator, right)
+		if result == left || result == right {
+			return result
+		}
+		return c.allocate(result)
 	case *ast.ReturnStatement:
-		val := Eval(node.ReturnValue, env)
-		if isError(val) {
+		// Whatever a function returns is in tail position.
+		var val object.Object
+		if len(c.frames) > 0 {
+			val = c.evalTail(node.ReturnValue, env)
+		} else {
+			val = c.Eval(node.ReturnValue, env)
+		}
+		if isAbrupt(val) {
 			return val
 		}
 		return &object.ReturnValue{Value: val}
 	case *ast.LetStatement:
-		val := Eval(node.Value, env)
-		if isError(val) {
+		val := c.Eval(node.Value, env)
+		if isAbrupt(val) {
 			return val
 		}
-		env.Set(node.Name.Value, val)
+		env.Set(node.Name.Value, bindName(val, node.Name.Value))
+	case *ast.FunctionStatement:
+		// Bound by declareFunctions when the enclosing block started.
+	case *ast.AssignStatement:
+		return c.evalAssignStatement(node, env)
+	case *ast.WhileStatement:
+		return c.evalWhileStatement(node, env)
+	case *ast.ForStatement:
+		return c.evalForStatement(node, env)
+	case *ast.BreakStatement:
+		return object.BREAK
+	case *ast.ContinueStatement:
+		return object.CONTINUE
 	case *ast.Identifier:
 		return evalIdentifier(node, env)
 	case *ast.BlockStatement:
-		return evalBlockStatements(node, env)
+		return c.evalBlockStatements(node, env, tail)
 	case *ast.IfExpression:
-		return evalIfExpression(node, env)
+		return c.evalIfExpression(node, env, tail)
 	case *ast.IntegerLiteral:
+		if node.Big != nil {
+			return &object.BigInteger{Value: node.Big}
+		}
 		return &object.Integer{Value: node.Value}
+	case *ast.FloatLiteral:
+		return &object.Float{Value: node.Value}
 	case *ast.StringLiteral:
-		return &object.String{Value: node.Value}
+		return c.allocate(&object.String{Value: node.Value})
+	case *ast.InterpolatedString:
+		return c.evalInterpolatedString(node, env)
 	case *ast.ArrayLiteral:
-		elements := evalExpressions(node.Elements, env)
-		if len(elements) == 1 && isError(elements[0]) {
+		elements := c.evalExpressions(node.Elements, env)
+		if len(elements) == 1 && isAbrupt(elements[0]) {
 			return elements[0]
 		}
 
-		return &object.Array{Elements: elements}
+		return c.allocate(&object.Array{Elements: elements})
 	case *ast.HashLiteral:
-		return evalHashLiteral(node, env)
+		return c.evalHashLiteral(node, env)
 	case *ast.IndexExpression:
-		left := Eval(node.Left, env)
-		if isError(left) {
+		left := c.Eval(node.Left, env)
+		if isAbrupt(left) {
 			return left
 		}
 
-		index := Eval(node.Index, env)
-		if isError(index) {
+		index := c.Eval(node.Index, env)
+		if isAbrupt(index) {
 			return index
 		}
 
-		return evalIndexExpression(left, index)
+		return object.Index(left, index)
 	case *ast.Bool:
-		return nativeBooleanToBooleanObject(node.Value)
+		return object.NativeBool(node.Value)
 	}
 
 	return nil
 }
 
-func evalProgram(program *ast.Program, env *object.Env) object.Object {
+func (c *Context) evalProgram(program *ast.Program, env *object.Env) object.Object {
+	declareFunctions(program.Statements, env)
+
 	var result object.Object
 	for _, statement := range program.Statements {
-		result = Eval(statement, env)
+		result = c.Eval(statement, env)
 
 		switch result := result.(type) {
 		case *object.ReturnValue:
 			return result.Value
 		case *object.Error:
 			return result
+		case *object.Break, *object.Continue:
+			return outsideLoop(result)
 		}
 	}
 
 	return result
 }
 
-func evalBlockStatements(block *ast.BlockStatement, env *object.Env) object.Object {
+// evalBlockStatements evaluates block. If the block is in tail position,
+// so is its last statement.
+func (c *Context) evalBlockStatements(block *ast.BlockStatement, env *object.Env, tail bool) object.Object {
+	declareFunctions(block.Statements, env)
+
 	var result object.Object
-	for _, statement := range block.Statements {
-		result = Eval(statement, env)
+	for i, statement := range block.Statements {
+		if tail && i == len(block.Statements)-1 {
+			result = c.evalTail(statement, env)
+		} else {
+			result = c.Eval(statement, env)
+		}
 
-		if result != nil {
-			rt := result.Type()
-			if rt == object.RETURN_VALUE || rt == object.ERROR_TYPE {
-				return result
-			}
+		if isAbrupt(result) {
+			return result
 		}
 	}
 
 	return result
 }
 
-func applyFunction(fn object.Object, args []object.Object) object.Object {
+// declareFunctions binds the functions declared among statements before
+// any of them runs, so that they can call each other whatever their order.
+func declareFunctions(statements []ast.Statement, env *object.Env) {
+	for _, s := range statements {
+		if decl, ok := s.(*ast.FunctionStatement); ok {
+			env.Set(decl.Name.Value, &object.Function{
+				Name:       decl.Name.Value,
+				Declared:   true,
+				Parameters: decl.Function.Parameters,
+				Body:       decl.Function.Body,
+				Env:        env,
+			})
+		}
+	}
+}
+
+func (c *Context) applyFunction(fn object.Object, args []object.Object, callSite token.Position) object.Object {
 	switch fn := fn.(type) {
 	case *object.Function:
-		extendedEnv := extendFunctionEnv(fn, args)
-		evaluated := Eval(fn.Body, extendedEnv)
-		return unwrapReturnValue(evaluated)
+		if len(args) != len(fn.Parameters) {
+			return newError("wrong number of arguments: want=%d, got=%d", len(fn.Parameters), len(args))
+		}
+
+		// Calls in tail position come back as a tailCall, which replaces
+		// the current call, so that they run in constant Go stack. The
+		// stack trace shows the callee in place of the caller.
+		if err := c.push(functionName(fn), callSite); err != nil {
+			return err
+		}
+		for {
+			result := unwrapReturnValue(c.evalTail(fn.Body, extendFunctionEnv(fn, args)))
+
+			call, ok := result.(*tailCall)
+			if !ok {
+				c.pop()
+				return outsideLoop(result)
+			}
+
+			fn, args = call.fn, call.args
+			c.frames[len(c.frames)-1].function = functionName(fn)
+		}
 	case *object.Builtin:
-		return fn.Fn(args...)
+		result := fn.Fn(c.exec, args...)
+		if fn.Borrows {
+			return result
+		}
+		return c.allocate(result)
 	default:
 		return newError("not a function: %s", fn.Type())
 	}
@@ -159,138 +286,80 @@ func extendFunctionEnv(fn *object.Function, args []object.Object) *object.Env {
 	return env
 }
 
+// unwrapReturnValue returns the value a function call evaluates to. A body
+// that ends without a value, such as one ending in a let, yields null.
 func unwrapReturnValue(obj object.Object) object.Object {
 	if returnValue, ok := obj.(*object.ReturnValue); ok {
 		return returnValue.Value
 	}
+	if obj == nil {
+		return NULL
+	}
 
 	return obj
 }
 
-func nativeBooleanToBooleanObject(input bool) *object.Bool {
-	if input {
-		return TRUE
-	}
-	return FALSE
-}
+func (c *Context) evalInterpolatedString(node *ast.InterpolatedString, env *object.Env) object.Object {
+	var out strings.Builder
 
-func evalPrefixExpression(operator string, right object.Object) object.Object {
-	switch operator {
-	case "!":
-		return evalBangOperatorExpression(right)
-	case "-":
-		return evalMinusPrefixOperatorExpression(right)
-	default:
-		return newError("unknown operator: %s%s", operator, right.Type())
+	for _, part := range node.Parts {
+		value := c.Eval(part, env)
+		if isAbrupt(value) {
+			return value
+		}
+		out.WriteString(value.Inspect())
 	}
-}
 
-func evalBangOperatorExpression(right object.Object) object.Object {
-	switch right {
-	case TRUE:
-		return FALSE
-	case FALSE:
-		return TRUE
-	case NULL:
-		return TRUE
-	default:
-		return FALSE
-	}
+	return c.allocate(&object.String{Value: out.String()})
 }
 
-func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
-	if right.Type() != object.INTEGER_TYPE {
-		return newError("unknown operator: -%s", right.Type())
+// evalIfExpression evaluates ie. If it is in tail position, so are its
+// branches.
+func (c *Context) evalIfExpression(ie *ast.IfExpression, env *object.Env, tail bool) object.Object {
+	condition := c.Eval(ie.Condition, env)
+	if isAbrupt(condition) {
+		return condition
 	}
-	value := right.(*object.Integer).Value
-	return &object.Integer{Value: -value}
-}
 
-func evalInfixExpression(left object.Object, operator string, right object.Object) object.Object {
-	switch {
-	case left.Type() == object.INTEGER_TYPE && right.Type() == object.INTEGER_TYPE:
-		return evalIntegerInfixExpression(left, operator, right)
-	case left.Type() == object.STRING_TYPE && right.Type() == object.STRING_TYPE:
-		return evalStringConcatenation(left, operator, right)
-	case operator == "==":
-		return nativeBooleanToBooleanObject(left == right)
-	case operator == "!=":
-		return nativeBooleanToBooleanObject(left != right)
-	case left.Type() != right.Type():
-		return newError("type mismatch: %s %s %s", left.Type(), operator, right.Type())
-	default:
-		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	var result object.Object
+	if object.IsTruthy(condition) {
+		result = c.evalBranch(ie.Then, env, tail)
+	} else if ie.Else != nil {
+		result = c.evalBranch(ie.Else, env, tail)
 	}
-}
 
-func evalStringConcatenation(
-	left object.Object,
-	operator string,
-	right object.Object,
-) object.Object {
-	if operator != "+" {
-		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	// A branch without a value, including a missing else, yields null.
+	if result == nil {
+		return NULL
 	}
-	leftVal := left.(*object.String).Value
-	rightVal := right.(*object.String).Value
-	return &object.String{Value: leftVal + rightVal}
+	return result
 }
 
-func evalIntegerInfixExpression(
-	left object.Object,
-	operator string,
-	right object.Object,
-) object.Object {
-	leftVal := left.(*object.Integer).Value
-	rightVal := right.(*object.Integer).Value
-	switch operator {
-	case "+":
-		return &object.Integer{Value: leftVal + rightVal}
-	case "-":
-		return &object.Integer{Value: leftVal - rightVal}
-	case "*":
-		return &object.Integer{Value: leftVal * rightVal}
-	case "/":
-		return &object.Integer{Value: leftVal / rightVal}
-	case "<":
-		return nativeBooleanToBooleanObject(leftVal < rightVal)
-	case ">":
-		return nativeBooleanToBooleanObject(leftVal > rightVal)
-	case "==":
-		return nativeBooleanToBooleanObject(leftVal == rightVal)
-	case "!=":
-		return nativeBooleanToBooleanObject(leftVal != rightVal)
-	default:
-		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+// evalLogicalExpression evaluates &&, || or ??, which yield their left
+// operand when it decides the result and their right operand otherwise.
+// The right operand is only evaluated when it is needed, in tail position
+// if the expression is.
+func (c *Context) evalLogicalExpression(node *ast.InfixExpression, env *object.Env, tail bool) object.Object {
+	left := c.Eval(node.Left, env)
+	if isAbrupt(left) {
+		return left
 	}
-}
 
-func evalIfExpression(ie *ast.IfExpression, env *object.Env) object.Object {
-	condition := Eval(ie.Condition, env)
-	if isError(condition) {
-		return condition
+	if object.ShortCircuits(node.Operator, left) {
+		return left
 	}
 
-	if isTruthy(condition) {
-		return Eval(ie.Then, env)
-	} else if ie.Else != nil {
-		return Eval(ie.Else, env)
-	} else {
-		return NULL
+	if tail {
+		return c.evalTail(node.Right, env)
 	}
+	return c.Eval(node.Right, env)
 }
 
-func isTruthy(obj object.Object) bool {
-	switch obj {
-	case NULL:
-		return false
-	case TRUE:
-		return true
-	case FALSE:
-		return false
-	default:
-		return true
+func (c *Context) evalBranch(branch *ast.BlockStatement, env *object.Env, tail bool) object.Object {
+	if tail {
+		return c.evalTail(branch, env)
 	}
+	return c.Eval(branch, env)
 }
 
 func newError(format string, a ...any) *object.Error {
@@ -305,24 +374,44 @@ func isError(obj object.Object) bool {
 	return false
 }
 
+// isAbrupt reports whether obj ends the evaluation of the statements
+// around it: an error, or the signal of a return, break or continue.
+func isAbrupt(obj object.Object) bool {
+	switch obj.(type) {
+	case *object.Error, *object.ReturnValue, *object.Break, *object.Continue:
+		return true
+	}
+
+	return false
+}
+
+// bindName names an anonymous function after the variable it is first
+// bound to, which is how stack traces report it.
+func bindName(val object.Object, name string) object.Object {
+	if fn, ok := val.(*object.Function); ok && fn.Name == "" {
+		fn.Name = name
+	}
+	return val
+}
+
 func evalIdentifier(node *ast.Identifier, env *object.Env) object.Object {
 	if val, ok := env.Get(node.Value); ok {
 		return val
 	}
 
-	if builtin, ok := builtins[node.Value]; ok {
+	if builtin := object.GetBuiltinByName(node.Value); builtin != nil {
 		return builtin
 	}
 
 	return newError("identifier not found: " + node.Value)
 }
 
-func evalExpressions(args []ast.Expression, env *object.Env) []object.Object {
+func (c *Context) evalExpressions(args []ast.Expression, env *object.Env) []object.Object {
 	var result []object.Object
 
 	for _, e := range args {
-		evaluated := Eval(e, env)
-		if isError(evaluated) {
+		evaluated := c.Eval(e, env)
+		if isAbrupt(evaluated) {
 			return []object.Object{evaluated}
 		}
 		result = append(result, evaluated)
@@ -331,12 +420,13 @@ func evalExpressions(args []ast.Expression, env *object.Env) []object.Object {
 	return result
 }
 
-func evalHashLiteral(node *ast.HashLiteral, env *object.Env) object.Object {
+func (c *Context) evalHashLiteral(node *ast.HashLiteral, env *object.Env) object.Object {
 	pairs := make(map[object.HashKey]object.HashPair)
 
-	for keyNode, valueNode := range node.Pairs {
-		key := Eval(keyNode, env)
-		if isError(key) {
+	for _, keyNode := range node.Keys() {
+		valueNode := node.Pairs[keyNode]
+		key := c.Eval(keyNode, env)
+		if isAbrupt(key) {
 			return key
 		}
 
@@ -345,8 +435,8 @@ func evalHashLiteral(node *ast.HashLiteral, env *object.Env) object.Object {
 			return newError("unusable as hashkey: %s", key.Type())
 		}
 
-		value := Eval(valueNode, env)
-		if isError(value) {
+		value := c.Eval(valueNode, env)
+		if isAbrupt(value) {
 			return value
 		}
 
@@ -354,44 +444,5 @@ func evalHashLiteral(node *ast.HashLiteral, env *object.Env) object.Object {
 		pairs[hashed] = object.HashPair{Key: key, Value: value}
 	}
 
-	return &object.Hash{Pairs: pairs}
-}
-
-func evalIndexExpression(left, index object.Object) object.Object {
-	switch {
-	case left.Type() == object.ARRAY_TYPE && index.Type() == object.INTEGER_TYPE:
-		return evalArrayIndexExpression(left, index)
-	case left.Type() == object.HASH_TYPE:
-		return evalHashIndexExpression(left, index)
-	default:
-		return newError("index operator not supported: %s", left.Type())
-	}
-}
-
-func evalArrayIndexExpression(array, index object.Object) object.Object {
-	arrayObject := array.(*object.Array)
-	idx := index.(*object.Integer).Value
-
-	max := int64(len(arrayObject.Elements) - 1)
-	if idx < 0 || idx > max {
-		return NULL
-	}
-
-	return arrayObject.Elements[idx]
-}
-
-func evalHashIndexExpression(hash, index object.Object) object.Object {
-	hashObject := hash.(*object.Hash)
-
-	key, ok := index.(object.Hashable)
-	if !ok {
-		return newError("unusable as hashkey: %s", index.Type())
-	}
-
-	pair, ok := hashObject.Pairs[key.HashKey()]
-	if !ok {
-		return NULL
-	}
-
-	return pair.Value
+	return c.allocate(&object.Hash{Pairs: pairs})
 }
@@ -1,9 +1,14 @@
 package evaluator
 
 import (
+	"errors"
+	"fmt"
+	"mira/compiler"
 	"mira/lexer"
 	"mira/object"
 	"mira/parser"
+	"mira/vm"
+	"strings"
 	"testing"
 )
 
@@ -30,7 +35,7 @@ func TestEvalIntegerExpression(t *testing.T) {
 	}
 
 	for _, tt := range tests {
-		evaluated := testEval(tt.input)
+		evaluated := testEval(t, tt.input)
 		testIntegerObject(t, evaluated, tt.expected)
 	}
 }
@@ -62,12 +67,36 @@ func TestEvalBoolExpression(t *testing.T) {
 	}
 
 	for _, tt := range tests {
-		evaluated := testEval(tt.input)
+		evaluated := testEval(t, tt.input)
 		testBoolObject(t, evaluated, tt.expected)
 	}
 }
 
-func testEval(input string) object.Object {
+// testEval evaluates input with the evaluator and also runs it on the VM,
+// failing the test if the two engines disagree. Every test using it is
+// thereby a conformance test for the compiler.
+func testEval(t *testing.T, input string) object.Object {
+	t.Helper()
+
+	evaluated := testEvalTree(input)
+
+	program := parser.New(lexer.New(input)).ParseProgram()
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		t.Errorf("%q: compiler error: %s", input, err)
+		return evaluated
+	}
+	executed := vm.New(comp.Bytecode()).Run()
+
+	if msg := compareResults(evaluated, executed); msg != "" {
+		t.Errorf("%q: vm and evaluator differ: %s", input, msg)
+	}
+
+	return evaluated
+}
+
+// testEvalTree evaluates input with the evaluator only.
+func testEvalTree(input string) object.Object {
 	lex := lexer.New(input)
 	p := parser.New(lex)
 	program := p.ParseProgram()
@@ -76,6 +105,28 @@ func testEval(input string) object.Object {
 	return Eval(program, env)
 }
 
+func compareResults(evaluated, executed object.Object) string {
+	if evaluated == nil || executed == nil {
+		if evaluated != executed {
+			return fmt.Sprintf("evaluator=%v, vm=%v", evaluated, executed)
+		}
+		return ""
+	}
+
+	if evaluated.Type() != executed.Type() || evaluated.Inspect() != executed.Inspect() {
+		return fmt.Sprintf("evaluator=%s(%s), vm=%s(%s)",
+			evaluated.Type(), evaluated.Inspect(), executed.Type(), executed.Inspect())
+	}
+
+	if err, ok := evaluated.(*object.Error); ok {
+		if trace := executed.(*object.Error).StackTrace(); trace != err.StackTrace() {
+			return fmt.Sprintf("evaluator stack=%q, vm stack=%q", err.StackTrace(), trace)
+		}
+	}
+
+	return ""
+}
+
 func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
 	result, ok := obj.(*object.Integer)
 	if !ok {
@@ -109,7 +160,7 @@ func testBoolObject(t *testing.T, obj object.Object, expected bool) bool {
 func TestStringLiteral(t *testing.T) {
 	input := `"hello world"`
 
-	evaluated := testEval(input)
+	evaluated := testEval(t, input)
 	str, ok := evaluated.(*object.String)
 	if !ok {
 		t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
@@ -123,7 +174,7 @@ func TestStringLiteral(t *testing.T) {
 func TestStringConcatenation(t *testing.T) {
 	input := `"Hello" + " " + "World!"`
 
-	evaluated := testEval(input)
+	evaluated := testEval(t, input)
 	str, ok := evaluated.(*object.String)
 	if !ok {
 		t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
@@ -147,7 +198,7 @@ func TestBangOperator(t *testing.T) {
 		{"!!5", true},
 	}
 	for _, tt := range tests {
-		evaluated := testEval(tt.input)
+		evaluated := testEval(t, tt.input)
 		testBoolObject(t, evaluated, tt.expected)
 	}
 }
@@ -164,10 +215,13 @@ func TestIfElseExpressions(t *testing.T) {
 		{"if (1 > 2) { 10 }", nil},
 		{"if (1 > 2) { 10 } else { 20 }", 20},
 		{"if (1 < 2) { 10 } else { 20 }", 10},
+		{"if (true) { let x = 1 }", nil},
+		{"if (true) { }", nil},
+		{"fn() { let x = 1 }()", nil},
 	}
 
 	for _, tt := range tests {
-		evaluated := testEval(tt.input)
+		evaluated := testEval(t, tt.input)
 		integer, ok := tt.expected.(int)
 		if ok {
 			testIntegerObject(t, evaluated, int64(integer))
@@ -210,7 +264,7 @@ if (10 > 1) {
 	}
 
 	for _, tt := range tests {
-		evaluated := testEval(tt.input)
+		evaluated := testEval(t, tt.input)
 		testIntegerObject(t, evaluated, tt.expected)
 	}
 }
@@ -262,10 +316,18 @@ if (10 > 1) {
 			`{"name": "Monkey"}[fn(x) { x }];`,
 			"unusable as hashkey: FUNCTION",
 		},
+		{
+			"fn(a, b) { a }(1)",
+			"wrong number of arguments: want=2, got=1",
+		},
+		{
+			"let f = 5; f()",
+			"not a function: INTEGER",
+		},
 	}
 
 	for _, tt := range tests {
-		evaluated := testEval(tt.input)
+		evaluated := testEval(t, tt.input)
 
 		errObj, ok := evaluated.(*object.Error)
 		if !ok {
@@ -291,14 +353,14 @@ func TestLetStatements(t *testing.T) {
 	}
 
 	for _, tt := range tests {
-		testIntegerObject(t, testEval(tt.input), tt.expected)
+		testIntegerObject(t, testEval(t, tt.input), tt.expected)
 	}
 }
 
 func TestFunctionObject(t *testing.T) {
 	input := "fn(x) { x + 2; };"
 
-	evaluated := testEval(input)
+	evaluated := testEval(t, input)
 	fn, ok := evaluated.(*object.Function)
 	if !ok {
 		t.Fatalf("object is not Function. got=%T (%+v)", evaluated, evaluated)
@@ -332,7 +394,7 @@ func TestFunctionApplication(t *testing.T) {
 	}
 
 	for _, tt := range tests {
-		testIntegerObject(t, testEval(tt.input), tt.expected)
+		testIntegerObject(t, testEval(t, tt.input), tt.expected)
 	}
 }
 
@@ -346,7 +408,57 @@ let addTwo = newAdder(2);
 addTwo(2);
   `
 
-	testIntegerObject(t, testEval(input), 4)
+	testIntegerObject(t, testEval(t, input), 4)
+}
+
+func TestCapturedShadowing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// Until a captured local is bound, its name refers to the outer
+		// variable or builtin.
+		{"let x = 1; let f = fn() { let y = x; let x = 2; let g = fn() { x }; [y, g()] }; f()", "[1, 2]"},
+		{"let f = fn() { let n = len([1, 2]); let len = fn(a) { 0 }; let g = fn() { len([]) }; [n, g()] }; f()", "[2, 0]"},
+		{"let f = fn(a) { let y = a; let x = 2; fn() { x + y } }; f(1)()", "3"},
+		// A function that refers to a later local captures it.
+		{"let f = fn() { let g = fn() { h() }; let h = fn() { 5 }; g() }; f()", "5"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%s: wrong result. got=%s, want=%s", tt.input, evaluated.Inspect(), tt.expected)
+		}
+	}
+}
+
+func TestConditionalShadowing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// A let in a branch or a loop shadows the outer variable only
+		// once it has run.
+		{"let x = 1; let f = fn(c) { if (c) { let x = 2 } x }; [f(false), f(true)]", "[1, 2]"},
+		{"let x = 100; let f = fn() { let r = []; for (i in range(2)) { r = push(r, x); let x = i; } r }; f()", "[100, 0]"},
+		{"let x = 100; let f = fn() { let r = []; let i = 0; while (i < 2) { r = push(r, x); let x = i; i += 1 } r }; f()", "[100, 0]"},
+		{"let f = fn() { let r = []; for (i in range(2)) { r = push(r, len); let len = 5; } r }; f()", "[builtin function, 5]"},
+		{"let f = fn(c) { if (c) { let y = 2 } y }; f(false)", "ERROR: 1:38: identifier not found: y"},
+		// Assignments store into the variable that a read would find.
+		{"let x = 1; let f = fn(c) { if (c) { let x = 2 } x += 1; x }; [f(false), x, f(true), x]", "[2, 2, 3, 2]"},
+		{"let f = fn(c) { if (c) { let len = 2 } len = 3 }; f(false)", "ERROR: 1:40: identifier not found: len"},
+		// So do closures that may run before the let.
+		{"let x = 1; let f = fn() { let g = fn() { x }; let a = g(); let x = 2; [a, g()] }; f()", "[1, 2]"},
+		{"let x = 1; let f = fn() { let g = fn() { x = 9 }; g(); let x = 2; g(); x }; [f(), x]", "[9, 9]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%s: wrong result. got=%s, want=%s", tt.input, evaluated.Inspect(), tt.expected)
+		}
+	}
 }
 
 func TestBuiltinFunctions(t *testing.T) {
@@ -357,12 +469,16 @@ func TestBuiltinFunctions(t *testing.T) {
 		{`len("")`, 0},
 		{`len("four")`, 4},
 		{`len("hello world")`, 11},
+		{`len("héllo, 世界")`, 9},
+		{`bytelen("héllo, 世界")`, 14},
+		{`bytelen("")`, 0},
+		{`bytelen([1])`, "argument to `bytelen()` must be STRING, got ARRAY"},
 		{`len(1)`, "argument to `len()` not supported, got INTEGER"},
 		{`len("one", "two")`, "wrong number of arguments. got=2, want=1"},
 	}
 
 	for _, tt := range tests {
-		evaluated := testEval(tt.input)
+		evaluated := testEval(t, tt.input)
 		switch expected := tt.expected.(type) {
 		case int:
 			testIntegerObject(t, evaluated, int64(expected))
@@ -382,7 +498,7 @@ func TestBuiltinFunctions(t *testing.T) {
 func TestArrayLiterals(t *testing.T) {
 	input := "[1, 2 * 2, 4 / 2]"
 
-	evaluated := testEval(input)
+	evaluated := testEval(t, input)
 	result, ok := evaluated.(*object.Array)
 	if !ok {
 		t.Fatalf("object is not Array. got=%T (+%v)", evaluated, evaluated)
@@ -414,7 +530,7 @@ func TestArrayIndexExpressions(t *testing.T) {
 		{"[1, 2, 3][-1]", nil},
 	}
 	for _, tt := range tests {
-		evaluated := testEval(tt.input)
+		evaluated := testEval(t, tt.input)
 		switch expected := tt.expected.(type) {
 		case int:
 			testIntegerObject(t, evaluated, int64(expected))
@@ -435,7 +551,7 @@ func TestHashLiterals(t *testing.T) {
   false: 6
 }
 `
-	evaluated := testEval(input)
+	evaluated := testEval(t, input)
 	result, ok := evaluated.(*object.Hash)
 	if !ok {
 		t.Fatalf("Eval didn't return Hash. got=%T (%+v)", evaluated, evaluated)
@@ -478,7 +594,7 @@ func TestHashIndexExpressions(t *testing.T) {
 	}
 
 	for _, tt := range tests {
-		evaluated := testEval(tt.input)
+		evaluated := testEval(t, tt.input)
 		integer, ok := tt.expected.(int)
 		if ok {
 			testIntegerObject(t, evaluated, int64(integer))
@@ -487,3 +603,784 @@ func TestHashIndexExpressions(t *testing.T) {
 		}
 	}
 }
+
+func TestErrorPositions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"5 + true;", "ERROR: 1:1: type mismatch: INTEGER + BOOL"},
+		{"let x = 1;\nlet y = x + z;", "ERROR: 2:13: identifier not found: z"},
+		{"let f = fn() {\n  -true\n};\nf();", "ERROR: 2:3: unknown operator: -BOOL"},
+		{`len(1)`, "ERROR: 1:1: argument to `len()` not supported, got INTEGER"},
+		{"let n = 1;\nfor (x in n) {}", "ERROR: 2:11: not iterable: INTEGER"},
+		{"let i = 0;\nwhile (i < 3) {\n  i += 1;\n  i / (2 - i);\n}", "ERROR: 4:3: division by zero"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned, got=%T(%+v)", evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Inspect() != tt.expected {
+			t.Errorf("wrong error, got=%q, want=%q", errObj.Inspect(), tt.expected)
+		}
+	}
+}
+
+func TestErrorStackTraces(t *testing.T) {
+	input := `let inner = fn(x) {
+  -x
+};
+let outer = fn() {
+  inner(true) + 1;
+};
+let run = fn(f) { [f()] };
+run(outer);`
+
+	evaluated := testEval(t, input)
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned, got=%T(%+v)", evaluated, evaluated)
+	}
+
+	expected := []string{"inner 2:3", "outer 5:3", "run 7:20", "<main> 8:1"}
+	if len(errObj.Stack) != len(expected) {
+		t.Fatalf("wrong stack depth. got=%d (%+v)", len(errObj.Stack), errObj.Stack)
+	}
+
+	for i, want := range expected {
+		frame := errObj.Stack[i]
+		if got := frame.Function + " " + frame.Pos.String(); got != want {
+			t.Errorf("wrong frame %d. got=%q, want=%q", i, got, want)
+		}
+	}
+
+	trace := "inner\n\t2:3\nouter\n\t5:3\nrun\n\t7:20\n<main>\n\t8:1\n"
+	if errObj.StackTrace() != trace {
+		t.Errorf("wrong stack trace. got=%q, want=%q", errObj.StackTrace(), trace)
+	}
+}
+
+func TestTailCalls(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{`let count = fn(n, acc) { if (n == 0) { acc } else { count(n - 1, acc + 1) } };
+count(100000, 0)`, 100000},
+		{`let count = fn(n) { if (n == 0) { return 0; } return count(n - 1); };
+count(100000)`, 0},
+		{`let even = fn(n) { if (n == 0) { true } else { odd(n - 1) } };
+let odd = fn(n) { if (n == 0) { false } else { even(n - 1) } };
+if (even(100001)) { 1 } else { 2 }`, 2},
+		{`let sum = fn(arr, acc) {
+  if (len(arr) == 0) { return acc; }
+  sum(tail(arr), acc + first(arr))
+};
+sum([1, 2, 3, 4], 0)`, 10},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestDeepTailRecursion(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping ten million calls in short mode")
+	}
+
+	input := `let count = fn(n, acc) { if (n == 0) { acc } else { count(n - 1, acc + 1) } };
+count(10000000, 0)`
+	testIntegerObject(t, testEvalTree(input), 10000000)
+}
+
+func TestTailCallStackTraces(t *testing.T) {
+	input := `let fail = fn(x) { -x };
+let loop = fn(n) { if (n == 0) { fail(true) } else { loop(n - 1) } };
+let run = fn() { loop(3) + 1 };
+run()`
+
+	errObj, ok := testEval(t, input).(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned")
+	}
+
+	// The frames of loop have been replaced by the call to fail.
+	trace := "fail\n\t1:20\nrun\n\t3:18\n<main>\n\t4:1\n"
+	if errObj.StackTrace() != trace {
+		t.Errorf("wrong stack trace. got=%q, want=%q", errObj.StackTrace(), trace)
+	}
+}
+
+func TestFunctionDeclarations(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"fn add(a, b) { a + b } add(1, 2)", "3"},
+		{"fn fact(n) { if (n < 2) { 1 } else { n * fact(n - 1) } } fact(5)", "120"},
+		// Declarations are bound when their block starts.
+		{"let r = even(10); fn even(n) { n == 0 || odd(n - 1) } fn odd(n) { n != 0 && even(n - 1) } r", "true"},
+		{`let parity = fn(n) {
+  fn even(n) { n == 0 || odd(n - 1) }
+  fn odd(n) { n != 0 && even(n - 1) }
+  even(n)
+};
+parity(100001)`, "false"},
+		{"let f = fn() { g() + 1; fn g() { 1 } }; f()", "null"},
+		{"let f = fn() { fn g() { 1 } }; f()", "null"},
+		{"if (true) { fn g() { 2 } g() }", "2"},
+		{"let n = 0; for (x in [1, 2, 3]) { fn add() { n += x } add() } n", "6"},
+		{"let f = fn() { fn g() { 1 } g }; f()", "fn g() {\n1\n}"},
+		{"fn add(a, b) { a + b } let plus = add; plus", "fn add(a, b) {\n(a + b)\n}"},
+		{"let f = fn(x) { x }; f", "fn(x) {\nx\n}"},
+		{"fn f() { 1 } fn f() { 2 } f()", "2"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%s: wrong result. got=%q, want=%q", tt.input, evaluated.Inspect(), tt.expected)
+		}
+	}
+}
+
+func TestFunctionDeclarationStackTraces(t *testing.T) {
+	input := `fn outer() {
+  fn inner(x) { -x }
+  inner(true) + 1
+}
+outer()`
+
+	errObj, ok := testEval(t, input).(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned")
+	}
+
+	trace := "inner\n\t2:17\nouter\n\t3:3\n<main>\n\t5:1\n"
+	if errObj.StackTrace() != trace {
+		t.Errorf("wrong stack trace. got=%q, want=%q", errObj.StackTrace(), trace)
+	}
+}
+
+func TestStackDepthError(t *testing.T) {
+	input := "let f = fn(n) { 1 + f(n + 1) }; f(0)"
+
+	program := parser.New(lexer.New(input)).ParseProgram()
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	// The engines run out at different depths, but report it alike.
+	for _, result := range []object.Object{testEvalTree(input), vm.New(comp.Bytecode()).Run()} {
+		errObj, ok := result.(*object.Error)
+		if !ok {
+			t.Fatalf("no error object returned, got=%T(%+v)", result, result)
+		}
+		if errObj.Inspect() != "ERROR: 1:21: stack depth exceeded" || !errors.Is(errObj, object.ErrStackDepth) {
+			t.Errorf("wrong error. got=%s (cause %v)", errObj.Inspect(), errObj.Cause)
+		}
+		if !strings.Contains(errObj.StackTrace(), " more frames\n") {
+			t.Errorf("stack trace not shortened")
+		}
+	}
+}
+
+func TestAnonymousFunctionNames(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"fn() { 1 + true }()", "<anonymous>"},
+		// Loop variables leave the functions of the iterable unnamed.
+		{"let fs = [fn() { 1 + true }]; for (g in fs) {}; fs[0]()", "<anonymous>"},
+		{"let run = fn(fs) { for (g in fs) {}; fs[0]() }; run([fn() { 1 + true }])", "<anonymous>"},
+		{"for (i, g in [fn() { 1 + true }]) { g() }", "<anonymous>"},
+		{"for (g in [fn() { 1 + true }]) { let h = g; h() }", "h"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Fatalf("%q: no error object returned, got=%T(%+v)", tt.input, evaluated, evaluated)
+		}
+
+		if errObj.Stack[0].Function != tt.expected {
+			t.Errorf("%q: wrong function name. expected=%q, got=%q", tt.input, tt.expected, errObj.Stack[0].Function)
+		}
+	}
+}
+
+func TestComparisonOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"1 <= 2", true},
+		{"2 <= 2", true},
+		{"3 <= 2", false},
+		{"1 >= 2", false},
+		{"2 >= 2", true},
+		{"3 >= 2", true},
+		{`"a" < "b"`, true},
+		{`"b" < "a"`, false},
+		{`"a" > "b"`, false},
+		{`"abc" <= "abc"`, true},
+		{`"abd" <= "abc"`, false},
+		{`"abc" >= "abd"`, false},
+		{`"b" >= "abc"`, true},
+		{`"mira" == "mira"`, true},
+		{`"mira" != "mira"`, false},
+		{`"mira" != "monkey"`, true},
+	}
+
+	for _, tt := range tests {
+		testBoolObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestIncrementDecrement(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{"let x = 5; ++x;", 6},
+		{"let x = 5; --x;", 4},
+		{"let x = 5; ++x; ++x; x", 7},
+		{"let x = 5; --x; --x; x", 3},
+		{"let x = 5; ++x + x", 12},
+		{"let arr = [1, 2, 3]; ++arr[1]; arr[1]", 3},
+		{"let arr = [1, 2, 3]; --arr[0] + arr[0]", 0},
+		{"let arr = [1, 2, 3]; let i = 2; ++arr[i]; arr", "[1, 2, 4]"},
+		{`let h = {"a": 1}; ++h["a"]; h["a"]`, 2},
+		{`let h = {"a": 1}; --h["a"]; --h["a"]`, -1},
+		{"let count = 0; let inc = fn() { ++count }; inc(); inc(); count", 2},
+		{"let n = 10; let f = fn() { let n = 1; ++n }; f() + n", 12},
+		{"++x", "identifier not found: x"},
+		{"++5", "cannot assign to 5"},
+		{`let s = "a"; ++s`, "unknown operator: ++STRING"},
+		{"let arr = [1]; ++arr[1]", "index out of range: 1"},
+		{`let h = {}; ++h["a"]`, "key not found: a"},
+		{`let h = {}; ++h[fn(x) { x }]`, "unusable as hashkey: FUNCTION"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			if errObj, ok := evaluated.(*object.Error); ok {
+				if errObj.Message != expected {
+					t.Errorf("wrong error message. got=%q, want=%q", errObj.Message, expected)
+				}
+			} else if evaluated.Inspect() != expected {
+				t.Errorf("wrong result. got=%q, want=%q", evaluated.Inspect(), expected)
+			}
+		}
+	}
+}
+
+func TestAssignment(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{"let x = 5; x = 6; x", 6},
+		{"let x = 5; x += 2; x", 7},
+		{"let x = 5; x -= 2; x", 3},
+		{"let x = 5; x *= 2; x", 10},
+		{"let x = 7; x /= 2; x", 3},
+		{"let x = 7; x %= 4; x", 3},
+		{"let x = 1.5; x += 1; x", "2.5"},
+		{`let s = "a"; s += "b"; s`, "ab"},
+		{"let x = 1; x = 2;", nil},
+		{"let x = 1; if (true) { x = 2 }", nil},
+		{"let x = 1; let f = fn() { x = x + 1 }; f(); f(); x", 3},
+		{"let counter = fn() { let n = 0; fn() { n += 1; n } }; let c = counter(); c(); c(); c()", 3},
+		{"let n = 10; let f = fn() { let n = 1; n += 1; n }; f() + n", 12},
+		{"let f = fn(x) { x = x * 2; x }; f(4)", 8},
+		{"let arr = [1, 2, 3]; arr[1] = 20; arr", "[1, 20, 3]"},
+		{"let arr = [1, 2, 3]; arr[2] *= 5; arr", "[1, 2, 15]"},
+		{`let h = {}; h["a"] = 1; h["a"] += 1; h`, "{a: 2}"},
+		{"let a = [1, 2]; let b = a; b[0] = 9; a", "[9, 2]"},
+		{"let a = [1, 2]; let b = push(a, 3); b[0] = 9; a", "[1, 2]"},
+		{`let grid = [[0, 0], [0, 0]]; grid[1][0] = 1; grid`, "[[0, 0], [1, 0]]"},
+		{"let f = 0; f = fn() { 1 }; f", "fn() {\n1\n}"},
+		// Assigning a container into itself makes a cycle, printed as [...].
+		{"let a = [1]; a[0] = a; a", "[[...]]"},
+		{`let a = [1]; a[0] = a; "${a}"`, "[[...]]"},
+		{`let h = {}; h["h"] = h; h["a"] = [h]; h`, "{a: [{...}], h: {...}}"},
+		{"let a = [1, 2]; let b = [a, a]; b", "[[1, 2], [1, 2]]"},
+		{"x = 1", "identifier not found: x"},
+		{"x += 1", "identifier not found: x"},
+		{"len = 1", "identifier not found: len"},
+		{"5 = 1", "cannot assign to 5"},
+		{"let x = 1; x += true", "type mismatch: INTEGER + BOOL"},
+		{"let x = 1; x /= 0", "division by zero"},
+		{"let arr = [1]; arr[1] = 2", "index out of range: 1"},
+		{`let arr = [1]; arr["a"] = 2`, "index operator not supported: ARRAY[STRING]"},
+		{`let h = {}; h["a"] += 1`, "key not found: a"},
+		{`let h = {}; h[[1]] = 1`, "unusable as hashkey: ARRAY"},
+		{`let s = "ab"; s[0] = "c"`, "index operator not supported: STRING"},
+		{"let x = 1; x = -true", "unknown operator: -BOOL"},
+		// The target is checked before the value is evaluated.
+		{"y = -true", "identifier not found: y"},
+		{"let arr = [1]; arr[1] = -true", "index out of range: 1"},
+		{`let h = {}; h["a"] += -true`, "key not found: a"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case nil:
+			if evaluated != nil && evaluated != NULL {
+				t.Errorf("%q: expected no value, got=%s", tt.input, evaluated.Inspect())
+			}
+		case string:
+			if errObj, ok := evaluated.(*object.Error); ok {
+				if errObj.Message != expected {
+					t.Errorf("wrong error message. got=%q, want=%q", errObj.Message, expected)
+				}
+			} else if evaluated.Inspect() != expected {
+				t.Errorf("wrong result. got=%q, want=%q", evaluated.Inspect(), expected)
+			}
+		}
+	}
+}
+
+func TestLoops(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{"let i = 0; while (i < 5) { i += 1 }; i", 5},
+		{"let i = 0; while (false) { i += 1 }; i", 0},
+		{"let i = 0; while (i < 5) { i += 1 }", nil},
+		{"let i = 0; while (true) { i += 1; if (i == 3) { break } }; i", 3},
+		{"let i = 0; let n = 0; while (i < 10) { i += 1; if (i % 2 == 0) { continue } n += i }; n", 25},
+		{"let s = 0; for (x in [1, 2, 3]) { s += x }; s", 6},
+		{"let s = 0; for (i, x in [10, 20, 30]) { s += i * x }; s", 80},
+		{"let s = 0; for (x in []) { s += 1 }; s", 0},
+		{`let out = ""; for (c in "héllo") { out = c + out }; out`, "olléh"},
+		{`let out = []; for (i, c in "ab") { out = push(out, [i, c]) }; out`, `[[0, a], [1, b]]`},
+		{`let out = []; for (k in {"b": 1, "a": 2, 3: 0, true: 0, false: 0, 1.5: 0}) { out = push(out, k) }; out`,
+			"[false, true, 1.5, 3, a, b]"},
+		{`let s = ""; for (k, v in {"a": 1, "b": 2}) { s += "${k}${v}" }; s`, "a1b2"},
+		{"let s = 0; for (x in range(5)) { s += x }; s", 10},
+		{"let out = []; for (x in range(2, 5)) { out = push(out, x) }; out", "[2, 3, 4]"},
+		{"let out = []; for (i, x in range(10, 0, -4)) { out = push(out, [i, x]) }; out", "[[0, 10], [1, 6], [2, 2]]"},
+		{"let n = 0; for (x in range(9223372036854775806, 9223372036854775807 + 0, 5)) { n += 1 }; n", 1},
+		{"range(1, 4, 2)", "range(1, 4, 2)"},
+		{"let out = []; for (x in range(3)) { for (y in range(3)) { if (y > x) { break } out = push(out, [x, y]) } }; len(out)", 6},
+		{"let s = 0; for (x in [1, 2, 3, 4]) { if (x == 2) { continue } if (x == 4) { break } s += x }; s", 4},
+		{"let x = 0; for (x in [1, 2]) {}; x", 2},
+		// Arrays are read as the loop goes; hashes are not.
+		{"let a = [1]; let n = 0; for (x in a) { n += 1; if (n < 3) { a = push(a, 0) } }; n", 1},
+		{"let a = [1, 2, 3]; let s = 0; for (x in a) { a[2] = 10; s += x }; s", 13},
+		{`let h = {"a": 1, "b": 2}; let s = 0; for (k, v in h) { h["b"] = 5; h["c"] = 100; s += v }; s`, 6},
+		// A break or continue inside an expression leaves it.
+		{"let out = []; for (x in [1, 2, 3]) { out = push(out, [x, if (x == 2) { continue } else { x }]) }; out", "[[1, 1], [3, 3]]"},
+		{"let n = 0; for (x in [1, 2, 3]) { n = n + if (x == 3) { break } else { x } }; n", 3},
+		{`let s = ""; for (x in [1, 2]) { s = "${s}${if (x == 2) { break } else { x }}" }; s`, "1"},
+		{"let n = 0; while (true) { n += 1; let a = [1, 2, if (n > 2) { break } else { 3 }]; }; n", 3},
+		{"let f = fn() { for (x in [1, 2, 3]) { if (x == 2) { return x * 10 } }; 0 }; f()", 20},
+		{"let f = fn() { let i = 0; while (true) { i += 1; if (i == 4) { return i } } }; f()", 4},
+		{"let f = fn() { for (x in [1]) {} }; f()", nil},
+		{"let f = fn(n) { let s = 0; for (x in range(n)) { s += x }; s }; f(4) + f(5)", 16},
+		{"let fns = []; for (x in [1, 2]) { fns = push(fns, fn() { x }) }; fns[0]() + fns[1]()", 4},
+		{"let f = fn() { let fns = []; for (x in [1, 2]) { fns = push(fns, fn() { x }) }; fns[0]() }; f()", 2},
+		{"let count = fn(n) { let i = 0; while (i < n) { let g = fn() { i += 1 }; g() }; i }; count(3)", 3},
+		{"for (x in 5) {}", "not iterable: INTEGER"},
+		{"for (x in fn() {}) {}", "not iterable: FUNCTION"},
+		{"for (x in y) {}", "identifier not found: y"},
+		{"while (y) {}", "identifier not found: y"},
+		{"range()", "wrong number of arguments. got=0, want=1 to 3"},
+		{`range("a")`, "argument to `range()` must be INTEGER, got STRING"},
+		{"range(1, 2, 0)", "range step must not be zero"},
+		{"range(99999999999999999999)", "argument to `range()` out of range: 99999999999999999999"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case nil:
+			if evaluated != nil && evaluated != NULL {
+				t.Errorf("%q: expected no value, got=%s", tt.input, evaluated.Inspect())
+			}
+		case string:
+			if errObj, ok := evaluated.(*object.Error); ok {
+				if errObj.Message != expected {
+					t.Errorf("wrong error message. got=%q, want=%q", errObj.Message, expected)
+				}
+			} else if evaluated.Inspect() != expected {
+				t.Errorf("wrong result. got=%q, want=%q", evaluated.Inspect(), expected)
+			}
+		}
+	}
+}
+
+func TestLogicalOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{"true && false", "false"},
+		{"true && 5", 5},
+		{"0 && 5", 5},
+		{`"" || 5`, ""},
+		{"false && 5", "false"},
+		{"false || 5", 5},
+		{"first([]) || 7", 7},
+		{"first([]) && 7", "null"},
+		{"first([]) ?? 7", 7},
+		{"false ?? 7", "false"},
+		{"1 ?? 7", 1},
+		{`let h = {"a": 1}; h["b"] ?? h["a"] ?? 0`, 1},
+		{"1 < 2 && 2 < 3", "true"},
+		{"true || false && false", "true"},
+		{"(true || false) && false", "false"},
+		// The right operand is only evaluated when it is needed.
+		{"let n = 0; let f = fn() { n += 1; true }; false && f(); true || f(); 1 ?? f(); n", 0},
+		{"let n = 0; let f = fn() { n += 1; true }; true && f(); false || f(); first([]) ?? f(); n", 3},
+		{"false && -true", "false"},
+		{"true || -true", "true"},
+		{"1 ?? -true", 1},
+		{"true && -true", "unknown operator: -BOOL"},
+		{"-true || 1", "unknown operator: -BOOL"},
+		{"let n = 0; for (x in [1, 2, 3]) { n += x == 2 && if (true) { break } || x }; n", 1},
+		// Calls on the right are in tail position.
+		{`let even = fn(n) { n == 0 || odd(n - 1) };
+let odd = fn(n) { n != 0 && even(n - 1) };
+even(100001)`, "false"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			if errObj, ok := evaluated.(*object.Error); ok {
+				if errObj.Message != expected {
+					t.Errorf("wrong error message. got=%q, want=%q", errObj.Message, expected)
+				}
+			} else if evaluated.Inspect() != expected {
+				t.Errorf("wrong result. got=%q, want=%q", evaluated.Inspect(), expected)
+			}
+		}
+	}
+}
+
+func TestLoopStackTraces(t *testing.T) {
+	input := `let check = fn(x) { if (x > 1) { -true } else { x } };
+let run = fn(xs) {
+  for (x in xs) { check(x) }
+};
+run([1, 2]);`
+
+	errObj, ok := testEval(t, input).(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned")
+	}
+
+	// Calls in a loop body are never in tail position.
+	trace := "check\n\t1:34\nrun\n\t3:19\n<main>\n\t5:1\n"
+	if errObj.StackTrace() != trace {
+		t.Errorf("wrong stack trace. got=%q, want=%q", errObj.StackTrace(), trace)
+	}
+}
+
+func TestEvalFloatExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"3.5", 3.5},
+		{"-2.5", -2.5},
+		{"1.5 + 1.5", 3},
+		{"1 + 0.5", 1.5},
+		{"0.5 + 1", 1.5},
+		{"10 / 4.0", 2.5},
+		{"2 * 1.25 - 1", 1.5},
+		{"1e3 / 8", 125},
+		{"let x = 1.5; ++x", 2.5},
+		{"let avg = fn(a, b) { (a + b) / 2.0 }; avg(3, 4)", 3.5},
+	}
+
+	for _, tt := range tests {
+		testFloatObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestFloatComparison(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"1.5 < 2", true},
+		{"2 > 1.5", true},
+		{"1.0 == 1", true},
+		{"1 != 1.0", false},
+		{"0.1 + 0.2 == 0.3", false},
+		{"2.5 <= 2.5", true},
+		{"2.5 >= 3", false},
+	}
+
+	for _, tt := range tests {
+		testBoolObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestNumberConversionBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected any
+	}{
+		{"int(3.9)", 3},
+		{"int(-3.9)", -3},
+		{"int(7)", 7},
+		{`int("42")`, 42},
+		{"float(2)", 2.0},
+		{`float("0.25")`, 0.25},
+		{"round(2.5)", 3},
+		{"round(-2.5)", -3},
+		{"round(2.4)", 2},
+		{"floor(2.7)", 2},
+		{"floor(-2.2)", -3},
+		{"floor(5)", 5},
+		{`int("abc")`, `cannot convert "abc" to INTEGER`},
+		{"int(1e300) == int(1e300) + 0", true},
+		{"int(0.0 / 0.0)", "cannot convert NaN to INTEGER"},
+		{"round(true)", "argument to `round()` must be a number, got BOOL"},
+		{"float([])", "argument to `float()` not supported, got ARRAY"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case float64:
+			testFloatObject(t, evaluated, expected)
+		case bool:
+			testBoolObject(t, evaluated, expected)
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. got=%q, want=%q", errObj.Message, expected)
+			}
+		}
+	}
+}
+
+func TestFloatHashKeys(t *testing.T) {
+	testIntegerObject(t, testEval(t, `{1: 10, 2.5: 20}[1.0]`), 10)
+	testIntegerObject(t, testEval(t, `{1: 10, 2.5: 20}[2.5]`), 20)
+}
+
+func testFloatObject(t *testing.T, obj object.Object, expected float64) bool {
+	result, ok := obj.(*object.Float)
+	if !ok {
+		t.Errorf("object is not Float. got=%T (%+v)", obj, obj)
+		return false
+	}
+
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%g, want=%g", result.Value, expected)
+		return false
+	}
+
+	return true
+}
+
+func TestBigIntegers(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"9223372036854775807 + 1", "9223372036854775808"},
+		{"-9223372036854775807 - 2", "-9223372036854775809"},
+		{"4294967296 * 4294967296", "18446744073709551616"},
+		{"99999999999999999999999", "99999999999999999999999"},
+		{"-9223372036854775807 - 1", "-9223372036854775808"},
+		{"let min = -9223372036854775807 - 1; -min", "9223372036854775808"},
+		{"let min = -9223372036854775807 - 1; min / -1", "9223372036854775808"},
+		{"100000000000000000000 / 3", "33333333333333333333"},
+		{"-100000000000000000000 / 3", "-33333333333333333333"},
+		{"let x = 9223372036854775807; ++x", "9223372036854775808"},
+		{"let x = 9223372036854775808; --x; x", "9223372036854775807"},
+		{"int(\"123456789012345678901234567890\")", "123456789012345678901234567890"},
+		{"18446744073709551616 > 9223372036854775807", "true"},
+		{"18446744073709551616 == 18446744073709551616", "true"},
+		{"18446744073709551616 * 1.0", "1.8446744073709552e+19"},
+		{"[1, 2][18446744073709551616]", "null"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%s: wrong result. got=%s, want=%s", tt.input, evaluated.Inspect(), tt.expected)
+		}
+	}
+}
+
+func TestBigIntegerDemotion(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"9223372036854775808 - 1", 9223372036854775807},
+		{"18446744073709551616 / 4294967296", 4294967296},
+		{"(9223372036854775807 + 1) - (9223372036854775807 + 1)", 0},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestBigIntegerHashKeys(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"{4294967296: 1}[18446744073709551616 / 4294967296]", 1},
+		{"{18446744073709551616: 2}[4294967296 * 4294967296]", 2},
+		{"{18446744073709551616: 3}[18446744073709551616.0]", 3},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestModuloPowerAndBitwise(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"7 % 3", "1"},
+		{"-7 % 3", "-1"},
+		{"7 % -3", "1"},
+		{"18446744073709551617 % 10", "7"},
+		{"-18446744073709551617 % 10", "-7"},
+		{"7.5 % 2", "1.5"},
+		{"-7.5 % 2", "-1.5"},
+		{"1.0 % 0", "NaN"},
+		{"1 % 0", "modulo by zero"},
+		{"18446744073709551616 % 0", "modulo by zero"},
+		{"2 ** 10", "1024"},
+		{"2 ** 3 ** 2", "512"},
+		{"-2 ** 2", "-4"},
+		{"(-2) ** 3", "-8"},
+		{"2 ** 0", "1"},
+		{"2 ** 64", "18446744073709551616"},
+		{"3 ** 40", "12157665459056928801"},
+		{"2 ** -1", "0.5"},
+		{"4 ** 0.5", "2.0"},
+		{"2.0 ** 3", "8.0"},
+		{"0 ** -1", "division by zero"},
+		{"2 ** 2000000", "integer too large"},
+		{"6 & 3", "2"},
+		{"6 | 3", "7"},
+		{"6 ^ 3", "5"},
+		{"~5", "-6"},
+		{"~-1", "0"},
+		{"-6 & 3", "2"},
+		{"-6 | 3", "-5"},
+		{"-6 ^ 3", "-7"},
+		{"18446744073709551616 | 1", "18446744073709551617"},
+		{"-18446744073709551616 & 18446744073709551615", "0"},
+		{"~18446744073709551616", "-18446744073709551617"},
+		{"1 << 10", "1024"},
+		{"1 << 64", "18446744073709551616"},
+		{"-1 << 63", "-9223372036854775808"},
+		{"1024 >> 3", "128"},
+		{"-1024 >> 3", "-128"},
+		{"-1 >> 100", "-1"},
+		{"5 >> 100", "0"},
+		{"18446744073709551616 >> 60", "16"},
+		{"-18446744073709551617 >> 64", "-2"},
+		{"1 << -1", "negative shift count: -1"},
+		{"1 >> -1", "negative shift count: -1"},
+		{"1 << 2000000", "integer too large"},
+		{"1.0 & 1", "unknown operator: FLOAT & INTEGER"},
+		{"1 << 1.0", "unknown operator: INTEGER << FLOAT"},
+		{"~1.0", "unknown operator: ~FLOAT"},
+		{"~true", "unknown operator: ~BOOL"},
+		{"let x = 3; x %= 2; x", "1"},
+		{"255 & 1 << 4 | 1", "17"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		actual := evaluated.Inspect()
+		if errObj, ok := evaluated.(*object.Error); ok {
+			actual = errObj.Message
+		}
+		if actual != tt.expected {
+			t.Errorf("%s: wrong result. got=%s, want=%s", tt.input, actual, tt.expected)
+		}
+	}
+}
+
+func TestDivisionByZero(t *testing.T) {
+	tests := []string{"1 / 0", "let x = 0; 10 / x", "18446744073709551616 / 0"}
+
+	for _, input := range tests {
+		errObj, ok := testEval(t, input).(*object.Error)
+		if !ok {
+			t.Errorf("%s: no error object returned", input)
+			continue
+		}
+		if errObj.Message != "division by zero" {
+			t.Errorf("%s: wrong error message. got=%q", input, errObj.Message)
+		}
+	}
+}
+
+func TestInterpolatedStrings(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let name = "mira"; "hello ${name}"`, "hello mira"},
+		{`let items = [1, 2]; "${len(items)} items: ${items}"`, "2 items: [1, 2]"},
+		{`"${1 + 2} ${2.5} ${true} ${"nested ${"deep"}"}"`, "3 2.5 true nested deep"},
+		{`"cost: \${x}"`, "cost: ${x}"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		str, ok := evaluated.(*object.String)
+		if !ok {
+			t.Errorf("object is not String. got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+		if str.Value != tt.expected {
+			t.Errorf("String has wrong value. got=%q, want=%q", str.Value, tt.expected)
+		}
+	}
+
+	errObj, ok := testEval(t, `"a ${missing} b"`).(*object.Error)
+	if !ok || errObj.Message != "identifier not found: missing" {
+		t.Errorf("expected identifier error. got=%v", errObj)
+	}
+}
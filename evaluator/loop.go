@@ -0,0 +1,92 @@
+package evaluator
+
+import (
+	"mira/ast"
+	"mira/object"
+)
+
+// evalWhileStatement runs the body of node for as long as its condition is
+// truthy. Like other statements, a loop has no value.
+func (c *Context) evalWhileStatement(node *ast.WhileStatement, env *object.Env) object.Object {
+	for {
+		condition := c.Eval(node.Condition, env)
+		if isAbrupt(condition) {
+			return condition
+		}
+		if !object.IsTruthy(condition) {
+			return nil
+		}
+
+		if result, done := c.evalLoopBody(node.Body, env); done {
+			return result
+		}
+	}
+}
+
+// evalForStatement runs the body of node once for each element of its
+// iterable, binding the loop variables in env as a let would, except that
+// the functions they are bound to keep their names.
+func (c *Context) evalForStatement(node *ast.ForStatement, env *object.Env) object.Object {
+	iterable := c.Eval(node.Iterable, env)
+	if isAbrupt(iterable) {
+		return iterable
+	}
+
+	it, err := object.Iterate(iterable)
+	if err != nil {
+		return c.locate(node.Iterable, err)
+	}
+
+	for {
+		key, value, ok := it.Next()
+		if !ok {
+			return nil
+		}
+
+		// Each character of a string is a new string.
+		if it.Fresh() {
+			if value = c.allocate(value); isError(value) {
+				return value
+			}
+		}
+
+		if node.Key != nil {
+			env.Set(node.Key.Value, key)
+			env.Set(node.Value.Value, value)
+		} else {
+			env.Set(node.Value.Value, it.Single(key, value))
+		}
+
+		if result, done := c.evalLoopBody(node.Body, env); done {
+			return result
+		}
+	}
+}
+
+// evalLoopBody runs one iteration of a loop. It reports whether the loop
+// is done, and with what: nil after a break, or the error or return value
+// that ends it.
+func (c *Context) evalLoopBody(body *ast.BlockStatement, env *object.Env) (object.Object, bool) {
+	switch result := c.Eval(body, env).(type) {
+	case *object.Break:
+		return nil, true
+	case *object.Error, *object.ReturnValue:
+		return result, true
+	}
+
+	return nil, false
+}
+
+// outsideLoop turns a break or continue that reached the end of a function
+// or the program into an error. The parser rejects these, but syntax trees
+// can also be built by hand.
+func outsideLoop(result object.Object) object.Object {
+	switch result.(type) {
+	case *object.Break:
+		return newError("break outside of a loop")
+	case *object.Continue:
+		return newError("continue outside of a loop")
+	}
+
+	return result
+}
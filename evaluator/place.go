@@ -0,0 +1,145 @@
+package evaluator
+
+import (
+	"mira/ast"
+	"mira/object"
+	"strings"
+)
+
+// place is an assignable location: a variable, an array element or a hash
+// entry. get returns nil when the location does not hold a value yet.
+type place interface {
+	get() object.Object
+	set(val object.Object)
+}
+
+type variablePlace struct {
+	env  *object.Env
+	name string
+}
+
+func (v *variablePlace) get() object.Object {
+	val, _ := v.env.Get(v.name)
+	return val
+}
+
+func (v *variablePlace) set(val object.Object) { v.env.Assign(v.name, val) }
+
+// indexPlace is an element of an array or an entry of a hash.
+type indexPlace struct {
+	container object.Object
+	index     object.Object
+}
+
+func (i *indexPlace) get() object.Object {
+	return object.GetIndexTarget(i.container, i.index)
+}
+
+func (i *indexPlace) set(val object.Object) {
+	object.SetIndexTarget(i.container, i.index, val)
+}
+
+// evalPlace resolves node to the location it names. Only identifiers bound
+// in env and index expressions on arrays and hashes are assignable. Array
+// elements must already exist; hash entries may be missing.
+func (c *Context) evalPlace(node ast.Expression, env *object.Env) (place, object.Object) {
+	switch node := node.(type) {
+	case *ast.Identifier:
+		if _, ok := env.Get(node.Value); !ok {
+			return nil, newError("identifier not found: " + node.Value)
+		}
+		return &variablePlace{env: env, name: node.Value}, nil
+
+	case *ast.IndexExpression:
+		left := c.Eval(node.Left, env)
+		if isAbrupt(left) {
+			return nil, left
+		}
+
+		index := c.Eval(node.Index, env)
+		if isAbrupt(index) {
+			return nil, index
+		}
+
+		if err := object.CheckIndexTarget(left, index); err != nil {
+			return nil, err
+		}
+		return &indexPlace{container: left, index: index}, nil
+
+	default:
+		return nil, newError("cannot assign to %s", node.String())
+	}
+}
+
+// evalIncDecExpression applies ++ or -- to the place named by node, stores
+// the result back and returns the new value.
+func (c *Context) evalIncDecExpression(node *ast.PrefixExpression, env *object.Env) object.Object {
+	target, err := c.evalPlace(node.Right, env)
+	if err != nil {
+		return err
+	}
+
+	current := target.get()
+	if current == nil {
+		// Only hash entries can be missing.
+		return newError("key not found: %s", target.(*indexPlace).index.Inspect())
+	}
+
+	result := object.IncDec(node.Operator, current)
+	if isError(result) {
+		return result
+	}
+
+	target.set(result)
+	return result
+}
+
+// evalAssignStatement stores the value of node in its target. The target
+// is resolved before the value is evaluated; a compound assignment such as
+// x += 1 also reads it then, and stores the result of the operator.
+func (c *Context) evalAssignStatement(node *ast.AssignStatement, env *object.Env) object.Object {
+	target, err := c.evalPlace(node.Target, env)
+	if err != nil {
+		return err
+	}
+
+	var current object.Object
+	if node.Operator != "=" {
+		if current = target.get(); current == nil {
+			return newError("key not found: %s", target.(*indexPlace).index.Inspect())
+		}
+	}
+
+	val := c.Eval(node.Value, env)
+	if isAbrupt(val) {
+		return val
+	}
+
+	if current != nil {
+		result := object.Infix(current, strings.TrimSuffix(node.Operator, "="), val)
+		if isError(result) {
+			return result
+		}
+		if result != current && result != val {
+			result = c.allocate(result)
+			if isError(result) {
+				return result
+			}
+		}
+		val = result
+	}
+
+	switch target := target.(type) {
+	case *variablePlace:
+		val = bindName(val, target.name)
+	case *indexPlace:
+		if target.get() == nil {
+			if err := c.charge(object.PairSize); err != nil {
+				return err
+			}
+		}
+	}
+
+	target.set(val)
+	return nil
+}
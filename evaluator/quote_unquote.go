@@ -7,12 +7,12 @@ import (
 	"mira/token"
 )
 
-func quote(node ast.Node, env *object.Env) object.Object {
-	node = evalUnquoteCalls(node, env)
+func (c *Context) quote(node ast.Node, env *object.Env) object.Object {
+	node = c.evalUnquoteCalls(node, env)
 	return &object.Quote{Node: node}
 }
 
-func evalUnquoteCalls(quoted ast.Node, env *object.Env) ast.Node {
+func (c *Context) evalUnquoteCalls(quoted ast.Node, env *object.Env) ast.Node {
 	return ast.Modify(quoted, func(node ast.Node) ast.Node {
 		if !isUnquoteCall(node) {
 			return node
@@ -27,7 +27,7 @@ func evalUnquoteCalls(quoted ast.Node, env *object.Env) ast.Node {
 			return node
 		}
 
-		unquoted := Eval(call.Arguments[0], env)
+		unquoted := c.Eval(call.Arguments[0], env)
 		return convertToASTNode(unquoted)
 	})
 }
@@ -48,6 +48,18 @@ func convertToASTNode(obj object.Object) ast.Node {
 			Literal: fmt.Sprintf("%d", obj.Value),
 		}
 		return &ast.IntegerLiteral{Token: t, Value: obj.Value}
+	case *object.BigInteger:
+		t := token.Token{
+			Type:    token.INT,
+			Literal: obj.Value.String(),
+		}
+		return &ast.IntegerLiteral{Token: t, Big: obj.Value}
+	case *object.Float:
+		t := token.Token{
+			Type:    token.FLOAT,
+			Literal: obj.Inspect(),
+		}
+		return &ast.FloatLiteral{Token: t, Value: obj.Value}
 	case *object.Bool:
 		var t token.Token
 		if obj.Value {
@@ -17,7 +17,7 @@ func TestQuote(t *testing.T) {
 	}
 
 	for _, tt := range tests {
-		evaluated := testEval(tt.input)
+		evaluated := testEvalTree(tt.input)
 		quote, ok := evaluated.(*object.Quote)
 		if !ok {
 			t.Fatalf("object is not Quote. got=%T (%+v)", evaluated, evaluated)
@@ -45,6 +45,7 @@ func TestQuoteUnquote(t *testing.T) {
 		{"quote(unquote(true))", "true"},
 		{"quote(unquote(true == false))", "false"},
 		{"quote(unquote(quote(4 + 4)))", "(4 + 4)"},
+		{`let x = 8; quote("x is ${unquote(x)}")`, `"x is ${8}"`},
 		{
 			"let quotedInfixExpression = quote(4 + 4); quote(unquote(4 + 4) + unquote(quotedInfixExpression));",
 			"(8 + (4 + 4))",
@@ -52,7 +53,7 @@ func TestQuoteUnquote(t *testing.T) {
 	}
 
 	for _, tt := range tests {
-		evaluated := testEval(tt.input)
+		evaluated := testEvalTree(tt.input)
 		quote, ok := evaluated.(*object.Quote)
 		if !ok {
 			t.Fatalf("object is not Quote. got=%T (%+v)", evaluated, evaluated)
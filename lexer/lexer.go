@@ -2,36 +2,130 @@
 
 package lexer
 
-import "mira/token"
+import (
+	"fmt"
+	"mira/token"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// An ErrorHandler is called with the position and a message for every
+// malformed token the lexer encounters, e.g. an unterminated string.
+type ErrorHandler func(pos token.Position, msg string)
+
+// A Mode controls optional lexer behavior.
+type Mode uint
+
+const (
+	ScanComments Mode = 1 << iota // Return comments as COMMENT tokens instead of skipping them
+)
 
 type Lexer struct {
 	input        string
+	filename     string
 	position     int  // Current position in input
 	readPosition int  // Current reading position (after current char)
-	ch           byte // Current character
+	ch           rune // Current character
+	line         int  // Line of the current character
+	column       int  // Column of the current character, counted in runes
+	onError      ErrorHandler
+	mode         Mode
+	interp       []int // Brace depth inside each open ${...}, innermost last
 }
 
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	return NewFile("", input)
+}
+
+// NewFile returns a lexer whose token positions carry the given file name.
+func NewFile(filename, input string) *Lexer {
+	l := &Lexer{input: input, filename: filename, line: 1}
 	l.readChar()
+
+	// Skip a "#!" interpreter line so scripts can be executed directly.
+	if l.ch == '#' && l.peekChar() == '!' {
+		for l.ch != '\n' && l.ch != 0 {
+			l.readChar()
+		}
+	}
+
 	return l
 }
 
-// Only supports ASCII for now
+// OnError installs a handler for lexical errors. Without one, errors are
+// only visible as ILLEGAL tokens.
+func (l *Lexer) OnError(h ErrorHandler) {
+	l.onError = h
+}
+
+// SetMode changes the lexer mode for subsequent tokens.
+func (l *Lexer) SetMode(mode Mode) {
+	l.mode = mode
+}
+
+func (l *Lexer) error(pos token.Position, format string, a ...any) {
+	if l.onError != nil {
+		l.onError(pos, fmt.Sprintf(format, a...))
+	}
+}
+
+// readChar advances to the next UTF-8 encoded rune. Invalid encodings are
+// read as utf8.RuneError.
 func (l *Lexer) readChar() {
+	if l.readPosition > len(l.input) {
+		return
+	}
+
+	if l.ch == '\n' {
+		l.line++
+		l.column = 0
+	}
+
+	width := 1
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
 	} else {
-		l.ch = l.input[l.readPosition]
+		l.ch, width = utf8.DecodeRuneInString(l.input[l.readPosition:])
 	}
 	l.position = l.readPosition
-	l.readPosition++
+	l.readPosition += width
+	l.column++
+}
+
+// pos returns the position of the current character.
+func (l *Lexer) pos() token.Position {
+	return token.Position{
+		Filename: l.filename,
+		Offset:   l.position,
+		Line:     l.line,
+		Column:   l.column,
+	}
 }
 
 func (l *Lexer) NextToken() token.Token {
-	var tok token.Token
+	for {
+		l.skipWhiteSpace()
 
-	l.skipWhiteSpace()
+		pos := l.pos()
+		var tok token.Token
+		if l.ch == '/' && (l.peekChar() == '/' || l.peekChar() == '*') {
+			tok = l.readComment()
+			if l.mode&ScanComments == 0 {
+				continue
+			}
+		} else {
+			tok = l.scanToken()
+		}
+		tok.Pos = pos
+		tok.End = l.pos()
+
+		return tok
+	}
+}
+
+func (l *Lexer) scanToken() token.Token {
+	var tok token.Token
 
 	switch l.ch {
 	case '=':
@@ -45,6 +139,9 @@ func (l *Lexer) NextToken() token.Token {
 		if l.peekChar() == '+' {
 			l.readChar()
 			tok = token.Token{Type: token.INC, Literal: "++"}
+		} else if l.peekChar() == '=' {
+			l.readChar()
+			tok = token.Token{Type: token.PLUS_ASSIGN, Literal: "+="}
 		} else {
 			tok = newToken(token.PLUS, l.ch)
 		}
@@ -52,13 +149,36 @@ func (l *Lexer) NextToken() token.Token {
 		if l.peekChar() == '-' {
 			l.readChar()
 			tok = token.Token{Type: token.DEC, Literal: "--"}
+		} else if l.peekChar() == '=' {
+			l.readChar()
+			tok = token.Token{Type: token.MINUS_ASSIGN, Literal: "-="}
 		} else {
 			tok = newToken(token.MINUS, l.ch)
 		}
 	case '*':
-		tok = newToken(token.ASTERISK, l.ch)
+		if l.peekChar() == '*' {
+			l.readChar()
+			tok = token.Token{Type: token.POWER, Literal: "**"}
+		} else if l.peekChar() == '=' {
+			l.readChar()
+			tok = token.Token{Type: token.ASTERISK_ASSIGN, Literal: "*="}
+		} else {
+			tok = newToken(token.ASTERISK, l.ch)
+		}
 	case '/':
-		tok = newToken(token.SLASH, l.ch)
+		if l.peekChar() == '=' {
+			l.readChar()
+			tok = token.Token{Type: token.SLASH_ASSIGN, Literal: "/="}
+		} else {
+			tok = newToken(token.SLASH, l.ch)
+		}
+	case '%':
+		if l.peekChar() == '=' {
+			l.readChar()
+			tok = token.Token{Type: token.PERCENT_ASSIGN, Literal: "%="}
+		} else {
+			tok = newToken(token.PERCENT, l.ch)
+		}
 	case '!':
 		if l.peekChar() == '=' {
 			l.readChar()
@@ -70,6 +190,9 @@ func (l *Lexer) NextToken() token.Token {
 		if l.peekChar() == '=' {
 			l.readChar()
 			tok = token.Token{Type: token.LE, Literal: "<="}
+		} else if l.peekChar() == '<' {
+			l.readChar()
+			tok = token.Token{Type: token.SHL, Literal: "<<"}
 		} else {
 			tok = newToken(token.LT, l.ch)
 		}
@@ -77,9 +200,37 @@ func (l *Lexer) NextToken() token.Token {
 		if l.peekChar() == '=' {
 			l.readChar()
 			tok = token.Token{Type: token.GE, Literal: ">="}
+		} else if l.peekChar() == '>' {
+			l.readChar()
+			tok = token.Token{Type: token.SHR, Literal: ">>"}
 		} else {
 			tok = newToken(token.GT, l.ch)
 		}
+	case '&':
+		if l.peekChar() == '&' {
+			l.readChar()
+			tok = token.Token{Type: token.AND, Literal: "&&"}
+		} else {
+			tok = newToken(token.BIT_AND, l.ch)
+		}
+	case '|':
+		if l.peekChar() == '|' {
+			l.readChar()
+			tok = token.Token{Type: token.OR, Literal: "||"}
+		} else {
+			tok = newToken(token.BIT_OR, l.ch)
+		}
+	case '^':
+		tok = newToken(token.BIT_XOR, l.ch)
+	case '~':
+		tok = newToken(token.BIT_NOT, l.ch)
+	case '?':
+		if l.peekChar() == '?' {
+			l.readChar()
+			tok = token.Token{Type: token.NULLISH, Literal: "??"}
+		} else {
+			tok = newToken(token.ILLEGAL, l.ch)
+		}
 	case ';':
 		tok = newToken(token.SEMICOLON, l.ch)
 	case ':':
@@ -89,14 +240,26 @@ func (l *Lexer) NextToken() token.Token {
 	case ')':
 		tok = newToken(token.RPAREN, l.ch)
 	case '{':
+		if n := len(l.interp); n > 0 {
+			l.interp[n-1]++
+		}
 		tok = newToken(token.LBRACE, l.ch)
 	case '}':
+		if n := len(l.interp); n > 0 && l.interp[n-1] == 0 {
+			l.interp = l.interp[:n-1]
+			tok = l.readString(false)
+			break
+		}
+		if n := len(l.interp); n > 0 {
+			l.interp[n-1]--
+		}
 		tok = newToken(token.RBRACE, l.ch)
 	case ',':
 		tok = newToken(token.COMMA, l.ch)
 	case '"':
-		tok.Type = token.STRING
-		tok.Literal = l.readString()
+		tok = l.readString(true)
+	case '`':
+		tok = l.readRawString()
 	case '[':
 		tok = newToken(token.LBRACKET, l.ch)
 	case ']':
@@ -110,10 +273,12 @@ func (l *Lexer) NextToken() token.Token {
 			tok.Type = token.LookupIdentifier(tok.Literal)
 			return tok
 		} else if isDigit(l.ch) {
-			tok.Literal = l.readNum()
-			tok.Type = token.INT
+			tok.Literal, tok.Type = l.readNum()
 			return tok
 		} else {
+			if l.ch == utf8.RuneError {
+				l.error(l.pos(), "invalid UTF-8 encoding")
+			}
 			tok = newToken(token.ILLEGAL, l.ch)
 		}
 	}
@@ -122,7 +287,7 @@ func (l *Lexer) NextToken() token.Token {
 	return tok
 }
 
-func newToken(tokenType token.TokenType, ch byte) token.Token {
+func newToken(tokenType token.TokenType, ch rune) token.Token {
 	return token.Token{Type: tokenType, Literal: string(ch)}
 }
 
@@ -134,30 +299,227 @@ func (l *Lexer) readIdentifier() string {
 	return l.input[position:l.position]
 }
 
-func (l *Lexer) readNum() string {
+// readNum reads an integer, or a float when the digits are followed by a
+// fractional part and/or an exponent, e.g. 3.14, 1e9 or 2.5E-3.
+func (l *Lexer) readNum() (string, token.TokenType) {
 	position := l.position
+	tokenType := token.TokenType(token.INT)
+
+	l.readDigits()
+
+	if l.ch == '.' && isDigit(l.peekChar()) {
+		tokenType = token.FLOAT
+		l.readChar()
+		l.readDigits()
+	}
+
+	if l.ch == 'e' || l.ch == 'E' {
+		next := l.peekChar()
+		if (next == '+' || next == '-') && l.readPosition+1 < len(l.input) {
+			next = rune(l.input[l.readPosition+1])
+		}
+
+		if isDigit(next) {
+			tokenType = token.FLOAT
+			l.readChar()
+			if l.ch == '+' || l.ch == '-' {
+				l.readChar()
+			}
+			l.readDigits()
+		}
+	}
+
+	return l.input[position:l.position], tokenType
+}
+
+func (l *Lexer) readDigits() {
 	for isDigit(l.ch) {
 		l.readChar()
 	}
-	return l.input[position:l.position]
 }
 
-func (l *Lexer) readString() string {
-	position := l.position + 1
+// readString reads a double-quoted string, decoding escape sequences into
+// the token's literal. When it meets a `${`, it stops and returns the text
+// so far as an INTERP_HEAD, or as an INTERP_MID when continuing a string
+// after an interpolated expression (head is false). A string missing its
+// closing quote becomes an ILLEGAL token holding the raw text.
+func (l *Lexer) readString(head bool) token.Token {
+	start := l.pos()
+	var out strings.Builder
+
 	for {
 		l.readChar()
-		if l.ch == '"' {
-			break
+
+		switch l.ch {
+		case '"':
+			if head {
+				return token.Token{Type: token.STRING, Literal: out.String()}
+			}
+			return token.Token{Type: token.INTERP_TAIL, Literal: out.String()}
+		case '$':
+			if l.peekChar() != '{' {
+				out.WriteRune(l.ch)
+				break
+			}
+			l.readChar()
+			l.interp = append(l.interp, 0)
+			if head {
+				return token.Token{Type: token.INTERP_HEAD, Literal: out.String()}
+			}
+			return token.Token{Type: token.INTERP_MID, Literal: out.String()}
+		case 0:
+			if l.position >= len(l.input) {
+				l.error(start, "unterminated string literal")
+				return token.Token{Type: token.ILLEGAL, Literal: l.input[start.Offset:]}
+			}
+			out.WriteRune(l.ch)
+		case '\\':
+			l.readEscape(&out)
+		default:
+			out.WriteRune(l.ch)
 		}
 	}
-	return l.input[position:l.position]
 }
 
-func isLetter(ch byte) bool {
-	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
+var escapes = map[rune]rune{
+	'n':  '\n',
+	't':  '\t',
+	'r':  '\r',
+	'0':  0,
+	'"':  '"',
+	'$':  '$',
+	'\\': '\\',
+}
+
+// readEscape decodes the escape sequence starting at the current backslash.
+// Unknown escapes are reported and kept verbatim.
+func (l *Lexer) readEscape(out *strings.Builder) {
+	pos := l.pos()
+
+	if l.readPosition >= len(l.input) {
+		return
+	}
+	l.readChar()
+
+	if ch, ok := escapes[l.ch]; ok {
+		out.WriteRune(ch)
+		return
+	}
+
+	if l.ch != 'u' {
+		l.error(pos, "unknown escape sequence \\%c", l.ch)
+		out.WriteRune('\\')
+		out.WriteRune(l.ch)
+		return
+	}
+
+	if l.peekChar() != '{' {
+		l.error(pos, "expected { after \\u")
+		return
+	}
+	l.readChar()
+
+	digits := 0
+	var code rune
+	for isHexDigit(l.peekChar()) {
+		l.readChar()
+		if digits < 7 {
+			code = code*16 + hexValue(l.ch)
+		}
+		digits++
+	}
+
+	if l.peekChar() != '}' {
+		l.error(pos, "malformed \\u{...} escape")
+		return
+	}
+	l.readChar()
+
+	if digits == 0 {
+		l.error(pos, "malformed \\u{...} escape")
+		return
+	}
+
+	if digits > 6 || code > unicode.MaxRune || 0xD800 <= code && code < 0xE000 {
+		l.error(pos, "escape sequence is invalid Unicode code point")
+		return
+	}
+
+	out.WriteRune(code)
+}
+
+// readRawString reads a backtick-delimited string. Raw strings may span
+// several lines and contain no escape sequences.
+func (l *Lexer) readRawString() token.Token {
+	start := l.pos()
+
+	for {
+		l.readChar()
+
+		if l.ch == '`' {
+			return token.Token{Type: token.STRING, Literal: l.input[start.Offset+1 : l.position]}
+		}
+		if l.ch == 0 && l.position >= len(l.input) {
+			l.error(start, "unterminated raw string literal")
+			return token.Token{Type: token.ILLEGAL, Literal: l.input[start.Offset:]}
+		}
+	}
 }
 
-func isDigit(ch byte) bool {
+// readComment reads a `//` comment up to the end of the line, or a
+// `/* */` comment, which may nest.
+func (l *Lexer) readComment() token.Token {
+	start := l.pos()
+
+	if l.peekChar() == '/' {
+		for l.ch != '\n' && l.ch != 0 {
+			l.readChar()
+		}
+		return token.Token{Type: token.COMMENT, Literal: l.input[start.Offset:l.position]}
+	}
+
+	l.readChar()
+	l.readChar()
+	depth := 1
+	for depth > 0 {
+		switch {
+		case l.ch == 0 && l.position >= len(l.input):
+			l.error(start, "unterminated block comment")
+			return token.Token{Type: token.COMMENT, Literal: l.input[start.Offset:]}
+		case l.ch == '/' && l.peekChar() == '*':
+			depth++
+			l.readChar()
+		case l.ch == '*' && l.peekChar() == '/':
+			depth--
+			l.readChar()
+		}
+		l.readChar()
+	}
+
+	return token.Token{Type: token.COMMENT, Literal: l.input[start.Offset:l.position]}
+}
+
+func isLetter(ch rune) bool {
+	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_' ||
+		ch >= utf8.RuneSelf && unicode.IsLetter(ch)
+}
+
+func isHexDigit(ch rune) bool {
+	return isDigit(ch) || 'a' <= ch && ch <= 'f' || 'A' <= ch && ch <= 'F'
+}
+
+func hexValue(ch rune) rune {
+	switch {
+	case isDigit(ch):
+		return ch - '0'
+	case 'a' <= ch && ch <= 'f':
+		return ch - 'a' + 10
+	default:
+		return ch - 'A' + 10
+	}
+}
+
+func isDigit(ch rune) bool {
 	return '0' <= ch && ch <= '9'
 }
 
@@ -167,10 +529,10 @@ func (l *Lexer) skipWhiteSpace() {
 	}
 }
 
-func (l *Lexer) peekChar() byte {
+func (l *Lexer) peekChar() rune {
 	if l.readPosition >= len(l.input) {
 		return 0
-	} else {
-		return l.input[l.readPosition]
 	}
+	ch, _ := utf8.DecodeRuneInString(l.input[l.readPosition:])
+	return ch
 }
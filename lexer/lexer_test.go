@@ -17,7 +17,7 @@ let add = fn(x, y) {
 };
 
 let result = add(five, ten);
-!-/*5;
+!-/ *5;
 5 < 10 > 5;
 
 if (5 < 10) {
@@ -37,6 +37,10 @@ if (5 < 10) {
 [1, 2];
 {"foo": "bar"};
 macro(x, y) { x + y; };
+x += 1 -= 2 *= 3 /= 4 %= 5 % 6;
+while for in break continue;
+a && b || c ?? d;
+a ** b & c | d ^ ~e << f >> g;
 `
 
 	tests := []struct {
@@ -158,6 +162,49 @@ macro(x, y) { x + y; };
 		{token.SEMICOLON, ";"},
 		{token.RBRACE, "}"},
 		{token.SEMICOLON, ";"},
+		{token.IDENTIFIER, "x"},
+		{token.PLUS_ASSIGN, "+="},
+		{token.INT, "1"},
+		{token.MINUS_ASSIGN, "-="},
+		{token.INT, "2"},
+		{token.ASTERISK_ASSIGN, "*="},
+		{token.INT, "3"},
+		{token.SLASH_ASSIGN, "/="},
+		{token.INT, "4"},
+		{token.PERCENT_ASSIGN, "%="},
+		{token.INT, "5"},
+		{token.PERCENT, "%"},
+		{token.INT, "6"},
+		{token.SEMICOLON, ";"},
+		{token.WHILE, "while"},
+		{token.FOR, "for"},
+		{token.IN, "in"},
+		{token.BREAK, "break"},
+		{token.CONTINUE, "continue"},
+		{token.SEMICOLON, ";"},
+		{token.IDENTIFIER, "a"},
+		{token.AND, "&&"},
+		{token.IDENTIFIER, "b"},
+		{token.OR, "||"},
+		{token.IDENTIFIER, "c"},
+		{token.NULLISH, "??"},
+		{token.IDENTIFIER, "d"},
+		{token.SEMICOLON, ";"},
+		{token.IDENTIFIER, "a"},
+		{token.POWER, "**"},
+		{token.IDENTIFIER, "b"},
+		{token.BIT_AND, "&"},
+		{token.IDENTIFIER, "c"},
+		{token.BIT_OR, "|"},
+		{token.IDENTIFIER, "d"},
+		{token.BIT_XOR, "^"},
+		{token.BIT_NOT, "~"},
+		{token.IDENTIFIER, "e"},
+		{token.SHL, "<<"},
+		{token.IDENTIFIER, "f"},
+		{token.SHR, ">>"},
+		{token.IDENTIFIER, "g"},
+		{token.SEMICOLON, ";"},
 		{token.EOF, ""},
 	}
 
@@ -177,3 +224,304 @@ macro(x, y) { x + y; };
 		}
 	}
 }
+
+func TestTokenPositions(t *testing.T) {
+	input := `let x = 5;
+  x + "ab";`
+
+	pos := func(offset, line, column int) token.Position {
+		return token.Position{Filename: "test.mira", Offset: offset, Line: line, Column: column}
+	}
+
+	tests := []struct {
+		expectedType token.TokenType
+		pos          token.Position
+		end          token.Position
+	}{
+		{token.LET, pos(0, 1, 1), pos(3, 1, 4)},
+		{token.IDENTIFIER, pos(4, 1, 5), pos(5, 1, 6)},
+		{token.ASSIGN, pos(6, 1, 7), pos(7, 1, 8)},
+		{token.INT, pos(8, 1, 9), pos(9, 1, 10)},
+		{token.SEMICOLON, pos(9, 1, 10), pos(10, 1, 11)},
+		{token.IDENTIFIER, pos(13, 2, 3), pos(14, 2, 4)},
+		{token.PLUS, pos(15, 2, 5), pos(16, 2, 6)},
+		{token.STRING, pos(17, 2, 7), pos(21, 2, 11)},
+		{token.SEMICOLON, pos(21, 2, 11), pos(22, 2, 12)},
+		{token.EOF, pos(22, 2, 12), pos(22, 2, 12)},
+	}
+
+	l := NewFile("test.mira", input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Pos != tt.pos {
+			t.Errorf("tests[%d] - pos wrong. expected=%+v, got=%+v", i, tt.pos, tok.Pos)
+		}
+
+		if tok.End != tt.end {
+			t.Errorf("tests[%d] - end wrong. expected=%+v, got=%+v", i, tt.end, tok.End)
+		}
+	}
+}
+
+func TestNumbers(t *testing.T) {
+	input := `5 3.14 0.5 1e9 2.5E-3 7e+2 1.x 4e 8.e3`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.INT, "5"},
+		{token.FLOAT, "3.14"},
+		{token.FLOAT, "0.5"},
+		{token.FLOAT, "1e9"},
+		{token.FLOAT, "2.5E-3"},
+		{token.FLOAT, "7e+2"},
+		{token.INT, "1"},
+		{token.ILLEGAL, "."},
+		{token.IDENTIFIER, "x"},
+		{token.INT, "4"},
+		{token.IDENTIFIER, "e"},
+		{token.INT, "8"},
+		{token.ILLEGAL, "."},
+		{token.IDENTIFIER, "e"},
+		{token.INT, "3"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestStrings(t *testing.T) {
+	input := `"a\nb" "tab\there" "say \"hi\"" "back\\slash" "\u{48}\u{e9}\u{1F600}" ` +
+		"`raw \\n ${x}\nline`" + ` "héllo 世界"`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.STRING, "a\nb"},
+		{token.STRING, "tab\there"},
+		{token.STRING, `say "hi"`},
+		{token.STRING, `back\slash`},
+		{token.STRING, "Hé😀"},
+		{token.STRING, "raw \\n ${x}\nline"},
+		{token.STRING, "héllo 世界"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+	l.OnError(func(pos token.Position, msg string) {
+		t.Errorf("unexpected error at %s: %s", pos, msg)
+	})
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestStringErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedError   string
+	}{
+		{`"abc`, token.ILLEGAL, `"abc`, "1:1: unterminated string literal"},
+		{"x = `abc", token.IDENTIFIER, "x", "1:5: unterminated raw string literal"},
+		{`"a\qb"`, token.STRING, `a\qb`, `1:3: unknown escape sequence \q`},
+		{`"\u{110000}"`, token.STRING, "", "1:2: escape sequence is invalid Unicode code point"},
+		{`"\u{d800}"`, token.STRING, "", "1:2: escape sequence is invalid Unicode code point"},
+		{`"\u{}"`, token.STRING, "", `1:2: malformed \u{...} escape`},
+		{`"\u41"`, token.STRING, "41", `1:2: expected { after \u`},
+		{"\xff", token.ILLEGAL, "�", "1:1: invalid UTF-8 encoding"},
+	}
+
+	for _, tt := range tests {
+		var errs []string
+		l := New(tt.input)
+		l.OnError(func(pos token.Position, msg string) {
+			errs = append(errs, pos.String()+": "+msg)
+		})
+
+		tok := l.NextToken()
+		for l.NextToken().Type != token.EOF {
+		}
+
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Errorf("%q: wrong token. expected=%s %q, got=%s %q",
+				tt.input, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+
+		if len(errs) != 1 || errs[0] != tt.expectedError {
+			t.Errorf("%q: wrong errors. expected=%q, got=%q", tt.input, tt.expectedError, errs)
+		}
+	}
+}
+
+func TestUnicodeIdentifiers(t *testing.T) {
+	input := `let größe = "ü"; größe`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		column          int
+	}{
+		{token.LET, "let", 1},
+		{token.IDENTIFIER, "größe", 5},
+		{token.ASSIGN, "=", 11},
+		{token.STRING, "ü", 13},
+		{token.SEMICOLON, ";", 16},
+		{token.IDENTIFIER, "größe", 18},
+		{token.EOF, "", 23},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - wrong token. expected=%s %q, got=%s %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+
+		if tok.Pos.Column != tt.column {
+			t.Errorf("tests[%d] - column wrong. expected=%d, got=%d", i, tt.column, tok.Pos.Column)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `let x = 1; // trailing
+/* block /* nested */ still comment */ x / 2
+// last`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.LET, "let"},
+		{token.IDENTIFIER, "x"},
+		{token.ASSIGN, "="},
+		{token.INT, "1"},
+		{token.SEMICOLON, ";"},
+		{token.COMMENT, "// trailing"},
+		{token.COMMENT, "/* block /* nested */ still comment */"},
+		{token.IDENTIFIER, "x"},
+		{token.SLASH, "/"},
+		{token.INT, "2"},
+		{token.COMMENT, "// last"},
+		{token.EOF, ""},
+	}
+
+	for _, mode := range []Mode{0, ScanComments} {
+		l := New(input)
+		l.SetMode(mode)
+
+		for i, tt := range tests {
+			if tt.expectedType == token.COMMENT && mode&ScanComments == 0 {
+				continue
+			}
+
+			tok := l.NextToken()
+
+			if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+				t.Fatalf("mode %d, tests[%d] - wrong token. expected=%s %q, got=%s %q",
+					mode, i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+			}
+		}
+	}
+}
+
+func TestUnterminatedComment(t *testing.T) {
+	var errs []string
+	l := New("1 /* a /* b */")
+	l.OnError(func(pos token.Position, msg string) {
+		errs = append(errs, pos.String()+": "+msg)
+	})
+
+	for l.NextToken().Type != token.EOF {
+	}
+
+	if len(errs) != 1 || errs[0] != "1:3: unterminated block comment" {
+		t.Errorf("wrong errors. got=%q", errs)
+	}
+}
+
+func TestInterpolation(t *testing.T) {
+	input := `"hi ${name}, ${ {"a": 1}["a"] } \${x} ${"in ${n}"}!"`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.INTERP_HEAD, "hi "},
+		{token.IDENTIFIER, "name"},
+		{token.INTERP_MID, ", "},
+		{token.LBRACE, "{"},
+		{token.STRING, "a"},
+		{token.COLON, ":"},
+		{token.INT, "1"},
+		{token.RBRACE, "}"},
+		{token.LBRACKET, "["},
+		{token.STRING, "a"},
+		{token.RBRACKET, "]"},
+		{token.INTERP_MID, " ${x} "},
+		{token.INTERP_HEAD, "in "},
+		{token.IDENTIFIER, "n"},
+		{token.INTERP_TAIL, ""},
+		{token.INTERP_TAIL, "!"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - wrong token. expected=%s %q, got=%s %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestShebang(t *testing.T) {
+	l := New("#!/usr/bin/env mira\nlet x = 1;")
+
+	tok := l.NextToken()
+	if tok.Type != token.LET || tok.Pos.Line != 2 || tok.Pos.Column != 1 {
+		t.Fatalf("wrong first token. got=%s at %s", tok.Type, tok.Pos)
+	}
+}
@@ -0,0 +1,169 @@
+// mira.go
+
+// Package mira embeds the Mira interpreter in Go programs.
+//
+//	interp := mira.NewInterpreter(mira.Options{Stdout: &out})
+//	interp.Set("limit", &object.Integer{Value: 10})
+//	result, err := interp.RunString(`limit * 2`)
+//
+// An Interpreter keeps its globals and macros between runs, so a host can
+// load a script once and then call into it.
+package mira
+
+import (
+	"context"
+	"io"
+	"mira/evaluator"
+	"mira/lexer"
+	"mira/object"
+	"mira/parser"
+	"os"
+	"strings"
+)
+
+// Options configure an Interpreter. The zero value gives an interpreter
+// that writes to the process's standard streams and is never cancelled.
+type Options struct {
+	Stdin  io.Reader // Where input and readline read; os.Stdin if nil
+	Stdout io.Writer // Where print and println write; os.Stdout if nil
+	Stderr io.Writer // Where eprint writes; os.Stderr if nil
+
+	// Context cancels running scripts once it is done.
+	Context context.Context
+
+	// Limits bound the resources scripts may use, in total over all
+	// runs. A zero MaxDepth means evaluator.DefaultMaxDepth.
+	Limits evaluator.Limits
+}
+
+// Interpreter runs Mira programs on the tree-walking evaluator.
+type Interpreter struct {
+	exec     *object.ExecContext
+	env      *object.Env
+	macroEnv *object.Env
+	eval     *evaluator.Context
+}
+
+// NewInterpreter returns an Interpreter configured by opts.
+func NewInterpreter(opts Options) *Interpreter {
+	stdio := object.Stdio()
+	if opts.Stdin == nil {
+		opts.Stdin = stdio.Stdin
+	}
+	if opts.Stdout == nil {
+		opts.Stdout = stdio.Stdout
+	}
+	if opts.Stderr == nil {
+		opts.Stderr = stdio.Stderr
+	}
+	if opts.Context == nil {
+		opts.Context = context.Background()
+	}
+	if opts.Limits.MaxDepth == 0 {
+		opts.Limits.MaxDepth = evaluator.DefaultMaxDepth
+	}
+
+	i := &Interpreter{
+		exec:     object.NewExecContext(opts.Stdin, opts.Stdout, opts.Stderr),
+		env:      object.NewEnv(),
+		macroEnv: object.NewEnv(),
+		eval:     evaluator.NewContextWithLimits(opts.Context, opts.Limits),
+	}
+	i.eval.SetExecContext(i.exec)
+
+	return i
+}
+
+// RunString runs source and returns the value of its last expression, or
+// null if it has none. A program that fails to parse gives a *SyntaxError
+// and one that raises an error gives the *object.Error.
+func (i *Interpreter) RunString(source string) (object.Object, error) {
+	return i.run("", source)
+}
+
+// RunFile runs the program in filename, as RunString does. Positions in
+// errors refer to filename.
+func (i *Interpreter) RunFile(filename string) (object.Object, error) {
+	source, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return i.run(filename, string(source))
+}
+
+func (i *Interpreter) run(filename, source string) (object.Object, error) {
+	p := parser.New(lexer.NewFile(filename, source))
+	program := p.ParseProgram()
+	if diagnostics := p.Diagnostics(); len(diagnostics) != 0 {
+		return nil, &SyntaxError{Source: source, Diagnostics: diagnostics}
+	}
+
+	evaluator.DefineMacros(program, i.macroEnv)
+	expanded := evaluator.ExpandMacros(program, i.macroEnv)
+
+	result := i.eval.Eval(expanded, i.env)
+	if err, ok := result.(*object.Error); ok {
+		return nil, err
+	}
+	if result == nil {
+		return object.NULL, nil
+	}
+	return result, nil
+}
+
+// Get returns the value of the global name.
+func (i *Interpreter) Get(name string) (object.Object, bool) {
+	return i.env.Get(name)
+}
+
+// Set binds the global name to value, replacing any existing binding.
+func (i *Interpreter) Set(name string, value object.Object) {
+	i.env.Set(name, value)
+}
+
+// RegisterBuiltin makes fn available to scripts as the function name. It
+// takes precedence over a standard builtin of the same name. fn is called
+// with the interpreter's streams.
+func (i *Interpreter) RegisterBuiltin(name string, fn object.BuiltinFunction) {
+	i.env.Set(name, &object.Builtin{Fn: fn})
+}
+
+// Stdout returns the writer scripts print to.
+func (i *Interpreter) Stdout() io.Writer {
+	return i.exec.Stdout
+}
+
+// Stderr returns the writer for the standard error of scripts.
+func (i *Interpreter) Stderr() io.Writer {
+	return i.exec.Stderr
+}
+
+// Memory returns the approximate number of bytes scripts have allocated,
+// as counted against Limits.MaxMemory.
+func (i *Interpreter) Memory() int64 {
+	return i.eval.Memory()
+}
+
+// SyntaxError reports a program that failed to parse.
+type SyntaxError struct {
+	Source      string
+	Diagnostics []parser.Diagnostic
+}
+
+// Error lists the diagnostics, one per line.
+func (e *SyntaxError) Error() string {
+	lines := make([]string, len(e.Diagnostics))
+	for i, d := range e.Diagnostics {
+		lines[i] = d.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Render formats the diagnostics for a terminal, quoting the source.
+func (e *SyntaxError) Render() string {
+	var out strings.Builder
+	for _, d := range e.Diagnostics {
+		out.WriteString(d.Render(e.Source))
+	}
+	return out.String()
+}
@@ -0,0 +1,192 @@
+package mira
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"mira/evaluator"
+	"mira/object"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunString(t *testing.T) {
+	interp := NewInterpreter(Options{})
+
+	result, err := interp.RunString(`let double = fn(x) { x * 2 }; double(21)`)
+	if err != nil {
+		t.Fatalf("RunString failed: %s", err)
+	}
+	if result.Inspect() != "42" {
+		t.Errorf("wrong result. expected=42, got=%s", result.Inspect())
+	}
+
+	// Globals and macros persist between runs.
+	if _, err := interp.RunString(`let twice = macro(x) { quote(unquote(x) + unquote(x)) };`); err != nil {
+		t.Fatalf("RunString failed: %s", err)
+	}
+	result, err = interp.RunString(`twice(double(1))`)
+	if err != nil {
+		t.Fatalf("RunString failed: %s", err)
+	}
+	if result.Inspect() != "4" {
+		t.Errorf("wrong result. expected=4, got=%s", result.Inspect())
+	}
+
+	result, err = interp.RunString(`let x = 1;`)
+	if err != nil || result != object.NULL {
+		t.Errorf("expected null, got=%v (err %v)", result, err)
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	interp := NewInterpreter(Options{})
+
+	_, err := interp.RunString("let x = ;")
+	var syntaxErr *SyntaxError
+	if !errors.As(err, &syntaxErr) {
+		t.Fatalf("expected a *SyntaxError, got=%T(%v)", err, err)
+	}
+	if err.Error() != "1:9: error[E0002]: expected an expression, found ;" {
+		t.Errorf("wrong error. got=%q", err.Error())
+	}
+	if !strings.Contains(syntaxErr.Render(), "let x = ;\n") {
+		t.Errorf("rendered error does not quote the source. got=%q", syntaxErr.Render())
+	}
+
+	_, err = interp.RunString("1 + true")
+	var errObj *object.Error
+	if !errors.As(err, &errObj) {
+		t.Fatalf("expected an *object.Error, got=%T(%v)", err, err)
+	}
+	if err.Error() != "ERROR: 1:1: type mismatch: INTEGER + BOOL" {
+		t.Errorf("wrong error. got=%q", err.Error())
+	}
+
+	if _, err := interp.RunFile(filepath.Join(t.TempDir(), "missing.mira")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected a missing file error, got=%v", err)
+	}
+}
+
+func TestRunFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "rules.mira")
+	if err := os.WriteFile(file, []byte("let check = fn(n) { n > limit };\ncheck(-true)"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	interp := NewInterpreter(Options{})
+	interp.Set("limit", &object.Integer{Value: 10})
+
+	_, err := interp.RunFile(file)
+	if err == nil || err.Error() != "ERROR: "+file+":2:7: unknown operator: -BOOL" {
+		t.Errorf("wrong error. got=%v", err)
+	}
+
+	check, ok := interp.Get("check")
+	if !ok || check.Type() != object.FUNCTION_TYPE {
+		t.Fatalf("check not defined by the file, got=%v", check)
+	}
+	if _, ok := interp.Get("missing"); ok {
+		t.Errorf("missing is defined")
+	}
+}
+
+func TestRegisterBuiltin(t *testing.T) {
+	var out bytes.Buffer
+	interp := NewInterpreter(Options{Stdout: &out})
+
+	var seen []string
+	interp.RegisterBuiltin("record", func(ctx *object.ExecContext, args ...object.Object) object.Object {
+		for _, arg := range args {
+			seen = append(seen, arg.Inspect())
+		}
+		return &object.Integer{Value: int64(len(args))}
+	})
+	interp.RegisterBuiltin("len", func(ctx *object.ExecContext, args ...object.Object) object.Object {
+		return &object.String{Value: "overridden"}
+	})
+
+	result, err := interp.RunString(`print("n", record(1, "a")); len([])`)
+	if err != nil {
+		t.Fatalf("RunString failed: %s", err)
+	}
+	if result.Inspect() != "overridden" {
+		t.Errorf("builtin not overridden. got=%s", result.Inspect())
+	}
+	if strings.Join(seen, ",") != "1,a" {
+		t.Errorf("wrong arguments. got=%q", seen)
+	}
+	if out.String() != "n 2 " {
+		t.Errorf("wrong output. got=%q", out.String())
+	}
+	if interp.Stdout() != &out {
+		t.Errorf("Stdout is not the configured writer")
+	}
+}
+
+func TestOptionsLimits(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := NewInterpreter(Options{Context: ctx}).RunString("1"); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected cancellation, got=%v", err)
+	}
+
+	interp := NewInterpreter(Options{Limits: evaluator.Limits{MaxMemory: 1000}})
+	_, err := interp.RunString(`let grow = fn(s) { grow(s + s) }; grow("x")`)
+	if !errors.Is(err, object.ErrMemoryLimit) {
+		t.Errorf("expected a memory limit error, got=%v", err)
+	}
+	if interp.Memory() <= 1000 {
+		t.Errorf("memory within the limit: %d", interp.Memory())
+	}
+
+	// MaxDepth defaults to the evaluator's.
+	_, err = NewInterpreter(Options{}).RunString("let f = fn() { 1 + f() }; f()")
+	if !errors.Is(err, object.ErrStackDepth) {
+		t.Errorf("expected a stack depth error, got=%v", err)
+	}
+}
+
+func TestOptionsStreams(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	interp := NewInterpreter(Options{Stdin: strings.NewReader("a\nb\n"), Stdout: &stdout, Stderr: &stderr})
+
+	// Input is buffered across runs, so no line is lost between them.
+	for _, expected := range []string{"a", "b", "null"} {
+		result, err := interp.RunString(`println(">"); eprint("!"); readline()`)
+		if err != nil {
+			t.Fatalf("RunString failed: %s", err)
+		}
+		if result.Inspect() != expected {
+			t.Errorf("wrong line. expected=%q, got=%q", expected, result.Inspect())
+		}
+	}
+
+	if stdout.String() != ">\n>\n>\n" {
+		t.Errorf("wrong stdout. got=%q", stdout.String())
+	}
+	if stderr.String() != "! ! ! " {
+		t.Errorf("wrong stderr. got=%q", stderr.String())
+	}
+	if interp.Stderr() != &stderr {
+		t.Errorf("Stderr is not the configured writer")
+	}
+}
+
+func TestCyclicValues(t *testing.T) {
+	var out bytes.Buffer
+	interp := NewInterpreter(Options{Stdout: &out, Limits: evaluator.Limits{MaxMemory: 1 << 20}})
+
+	result, err := interp.RunString(`let a = [1]; a[0] = a; print(a, "${a}"); a`)
+	if err != nil {
+		t.Fatalf("RunString failed: %s", err)
+	}
+	if result.Inspect() != "[[...]]" {
+		t.Errorf("wrong result. got=%s", result.Inspect())
+	}
+	if out.String() != "[[...]] [[...]] " {
+		t.Errorf("wrong output. got=%q", out.String())
+	}
+}
@@ -0,0 +1,384 @@
+package object
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Builtins lists the builtin functions. Compiled bytecode refers to them by
+// index, so new builtins must be appended at the end.
+var Builtins = []struct {
+	Name    string
+	Builtin *Builtin
+}{
+	{
+		"len",
+		&Builtin{
+			Fn: func(ctx *ExecContext, args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+
+				switch arg := args[0].(type) {
+				case *String:
+					return &Integer{Value: int64(utf8.RuneCountInString(arg.Value))}
+				case *Array:
+					return &Integer{Value: int64(len(arg.Elements))}
+				default:
+					return newError("argument to `len()` not supported, got %s", args[0].Type())
+				}
+			},
+		},
+	},
+	// bytelen returns the length of a string's UTF-8 encoding, where len
+	// counts its characters.
+	{
+		"bytelen",
+		&Builtin{
+			Fn: func(ctx *ExecContext, args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+				if args[0].Type() != STRING_TYPE {
+					return newError("argument to `bytelen()` must be STRING, got %s", args[0].Type())
+				}
+
+				return &Integer{Value: int64(len(args[0].(*String).Value))}
+			},
+		},
+	},
+	{
+		"first",
+		&Builtin{
+			Borrows: true,
+			Fn: func(ctx *ExecContext, args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+				if args[0].Type() != ARRAY_TYPE {
+					return newError("argument to `first()` must be ARRAY_TYPE, got %s", args[0].Type())
+				}
+
+				arr := args[0].(*Array)
+				if len(arr.Elements) > 0 {
+					return arr.Elements[0]
+				}
+
+				return NULL
+			},
+		},
+	},
+	{
+		"last",
+		&Builtin{
+			Borrows: true,
+			Fn: func(ctx *ExecContext, args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+				if args[0].Type() != ARRAY_TYPE {
+					return newError("argument to `last()` must be ARRAY_TYPE, got %s", args[0].Type())
+				}
+
+				arr := args[0].(*Array)
+				length := len(arr.Elements)
+				if length > 0 {
+					return arr.Elements[length-1]
+				}
+
+				return NULL
+			},
+		},
+	},
+	{
+		"tail",
+		&Builtin{
+			Fn: func(ctx *ExecContext, args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+				if args[0].Type() != ARRAY_TYPE {
+					return newError("argument to `tail()` must be ARRAY_TYPE, got %s", args[0].Type())
+				}
+
+				arr := args[0].(*Array)
+				length := len(arr.Elements)
+				if length > 0 {
+					newElems := make([]Object, length-1)
+					copy(newElems, arr.Elements[1:])
+					return &Array{Elements: newElems}
+				}
+
+				return NULL
+			},
+		},
+	},
+	{
+		"push",
+		&Builtin{
+			Fn: func(ctx *ExecContext, args ...Object) Object {
+				if len(args) != 2 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+				if args[0].Type() != ARRAY_TYPE {
+					return newError("argument to `push()` must be ARRAY_TYPE, got %s", args[0].Type())
+				}
+
+				arr := args[0].(*Array)
+				length := len(arr.Elements)
+				newElems := make([]Object, length+1)
+				copy(newElems, arr.Elements)
+				newElems[length] = args[1]
+
+				return &Array{Elements: newElems}
+			},
+		},
+	},
+	{
+		"int",
+		&Builtin{
+			Fn: func(ctx *ExecContext, args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+
+				switch arg := args[0].(type) {
+				case *Integer, *BigInteger:
+					return arg
+				case *Float:
+					return floatToInteger(math.Trunc(arg.Value))
+				case *String:
+					value, ok := new(big.Int).SetString(strings.TrimSpace(arg.Value), 10)
+					if !ok {
+						return newError("cannot convert %q to INTEGER", arg.Value)
+					}
+					return IntegerFromBig(value)
+				default:
+					return newError("argument to `int()` not supported, got %s", args[0].Type())
+				}
+			},
+		},
+	},
+	{
+		"float",
+		&Builtin{
+			Fn: func(ctx *ExecContext, args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+
+				switch arg := args[0].(type) {
+				case *Integer, *BigInteger:
+					return &Float{Value: toFloat(arg)}
+				case *Float:
+					return arg
+				case *String:
+					value, err := strconv.ParseFloat(strings.TrimSpace(arg.Value), 64)
+					if err != nil {
+						return newError("cannot convert %q to FLOAT", arg.Value)
+					}
+					return &Float{Value: value}
+				default:
+					return newError("argument to `float()` not supported, got %s", args[0].Type())
+				}
+			},
+		},
+	},
+	{
+		"round",
+		&Builtin{
+			Fn: func(ctx *ExecContext, args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+
+				switch arg := args[0].(type) {
+				case *Integer, *BigInteger:
+					return arg
+				case *Float:
+					return floatToInteger(math.Round(arg.Value))
+				default:
+					return newError("argument to `round()` must be a number, got %s", args[0].Type())
+				}
+			},
+		},
+	},
+	{
+		"floor",
+		&Builtin{
+			Fn: func(ctx *ExecContext, args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments. got=%d, want=1", len(args))
+				}
+
+				switch arg := args[0].(type) {
+				case *Integer, *BigInteger:
+					return arg
+				case *Float:
+					return floatToInteger(math.Floor(arg.Value))
+				default:
+					return newError("argument to `floor()` must be a number, got %s", args[0].Type())
+				}
+			},
+		},
+	},
+	{
+		"print",
+		&Builtin{
+			Fn: func(ctx *ExecContext, args ...Object) Object {
+				for _, arg := range args {
+					fmt.Fprint(ctx.Stdout, arg.Inspect(), " ")
+				}
+
+				return NULL
+			},
+		},
+	},
+	// println writes its arguments separated by spaces and ends the line.
+	{
+		"println",
+		&Builtin{
+			Fn: func(ctx *ExecContext, args ...Object) Object {
+				fmt.Fprintln(ctx.Stdout, joinInspect(args))
+				return NULL
+			},
+		},
+	},
+	// eprint is print for standard error.
+	{
+		"eprint",
+		&Builtin{
+			Fn: func(ctx *ExecContext, args ...Object) Object {
+				for _, arg := range args {
+					fmt.Fprint(ctx.Stderr, arg.Inspect(), " ")
+				}
+
+				return NULL
+			},
+		},
+	},
+	// input writes its optional prompt, then reads a line like readline.
+	{
+		"input",
+		&Builtin{
+			Fn: func(ctx *ExecContext, args ...Object) Object {
+				if len(args) > 1 {
+					return newError("wrong number of arguments. got=%d, want=0 or 1", len(args))
+				}
+				if len(args) == 1 {
+					fmt.Fprint(ctx.Stdout, args[0].Inspect())
+				}
+
+				return readLine(ctx)
+			},
+		},
+	},
+	// readline reads a line from standard input without its line ending,
+	// or returns null at the end of the input.
+	{
+		"readline",
+		&Builtin{
+			Fn: func(ctx *ExecContext, args ...Object) Object {
+				if len(args) != 0 {
+					return newError("wrong number of arguments. got=%d, want=0", len(args))
+				}
+
+				return readLine(ctx)
+			},
+		},
+	},
+	// range(stop), range(start, stop) or range(start, stop, step) returns
+	// the integers from start, or 0, up to stop, counting by step, or 1.
+	{
+		"range",
+		&Builtin{
+			Fn: func(ctx *ExecContext, args ...Object) Object {
+				if len(args) < 1 || len(args) > 3 {
+					return newError("wrong number of arguments. got=%d, want=1 to 3", len(args))
+				}
+
+				bounds := make([]int64, len(args))
+				for i, arg := range args {
+					integer, ok := arg.(*Integer)
+					if !ok && arg.Type() == INTEGER_TYPE {
+						return newError("argument to `range()` out of range: %s", arg.Inspect())
+					}
+					if !ok {
+						return newError("argument to `range()` must be INTEGER, got %s", arg.Type())
+					}
+					bounds[i] = integer.Value
+				}
+
+				r := &Range{Stop: bounds[0], Step: 1}
+				if len(bounds) > 1 {
+					r.Start, r.Stop = bounds[0], bounds[1]
+				}
+				if len(bounds) > 2 {
+					r.Step = bounds[2]
+				}
+				if r.Step == 0 {
+					return newError("range step must not be zero")
+				}
+
+				return r
+			},
+		},
+	},
+}
+
+func joinInspect(args []Object) string {
+	parts := make([]string, len(args))
+	for i, arg := range args {
+		parts[i] = arg.Inspect()
+	}
+	return strings.Join(parts, " ")
+}
+
+func readLine(ctx *ExecContext) Object {
+	line, err := ctx.Stdin.ReadString('\n')
+	if err == io.EOF && line == "" {
+		return NULL
+	}
+	if err != nil && err != io.EOF {
+		return newError("readline: %s", err)
+	}
+
+	line = strings.TrimSuffix(line, "\n")
+	return &String{Value: strings.TrimSuffix(line, "\r")}
+}
+
+// GetBuiltinByName returns the builtin called name, or nil.
+func GetBuiltinByName(name string) *Builtin {
+	for _, def := range Builtins {
+		if def.Name == name {
+			return def.Builtin
+		}
+	}
+	return nil
+}
+
+// BuiltinNames returns the names of the builtin functions, sorted.
+func BuiltinNames() []string {
+	names := make([]string, 0, len(Builtins))
+	for _, def := range Builtins {
+		names = append(names, def.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// floatToInteger converts an integral float to an integer, failing for
+// infinities and NaN.
+func floatToInteger(value float64) Object {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return newError("cannot convert %s to INTEGER", (&Float{Value: value}).Inspect())
+	}
+	integer, _ := big.NewFloat(value).Int(nil)
+	return IntegerFromBig(integer)
+}
@@ -1,5 +1,7 @@
 package object
 
+import "sort"
+
 type Env struct {
 	store map[string]Object
 	outer *Env
@@ -28,3 +30,31 @@ func (e *Env) Set(name string, obj Object) Object {
 	e.store[name] = obj
 	return obj
 }
+
+// Assign rebinds name in the innermost scope of the chain that already
+// defines it. It reports false, binding nothing, if name is undefined.
+func (e *Env) Assign(name string, obj Object) bool {
+	for env := e; env != nil; env = env.outer {
+		if _, ok := env.store[name]; ok {
+			env.store[name] = obj
+			return true
+		}
+	}
+	return false
+}
+
+// Names returns the names bound in this scope, excluding outer scopes,
+// in sorted order.
+func (e *Env) Names() []string {
+	names := make([]string, 0, len(e.store))
+	for name := range e.store {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Outer returns the enclosing scope, or nil for the outermost one.
+func (e *Env) Outer() *Env {
+	return e.outer
+}
@@ -0,0 +1,30 @@
+package object
+
+import (
+	"bufio"
+	"io"
+	"os"
+)
+
+// ExecContext holds the standard streams of a running program, through
+// which builtins do their I/O.
+type ExecContext struct {
+	Stdin  *bufio.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// NewExecContext returns an ExecContext for the given streams. Reading
+// stdin is buffered, so once it is handed over it should only be read
+// through the ExecContext.
+func NewExecContext(stdin io.Reader, stdout, stderr io.Writer) *ExecContext {
+	return &ExecContext{Stdin: bufio.NewReader(stdin), Stdout: stdout, Stderr: stderr}
+}
+
+var stdio = NewExecContext(os.Stdin, os.Stdout, os.Stderr)
+
+// Stdio returns the ExecContext of the process's standard streams. It is
+// shared, so that all readers of os.Stdin use the same buffer.
+func Stdio() *ExecContext {
+	return stdio
+}
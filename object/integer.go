@@ -0,0 +1,215 @@
+package object
+
+import (
+	"math"
+	"math/big"
+)
+
+// maxIntegerBits bounds the size of the results of ** and <<, which could
+// otherwise exhaust memory in a single operation.
+const maxIntegerBits = 1 << 20
+
+// integerInfix implements integer arithmetic, bitwise operators and
+// comparison. Operands that fit in an int64 use native arithmetic; results
+// that would overflow are recomputed with math/big, and big results that
+// fit in an int64 again are demoted by IntegerFromBig.
+func integerInfix(left Object, operator string, right Object) Object {
+	leftInt, leftSmall := left.(*Integer)
+	rightInt, rightSmall := right.(*Integer)
+
+	if leftSmall && rightSmall {
+		if result, ok := smallIntegerInfix(leftInt.Value, operator, rightInt.Value); ok {
+			return result
+		}
+	}
+
+	return bigIntegerInfix(left, operator, right)
+}
+
+// smallIntegerInfix reports false when the result does not fit in an int64.
+func smallIntegerInfix(leftVal int64, operator string, rightVal int64) (Object, bool) {
+	switch operator {
+	case "+":
+		sum := leftVal + rightVal
+		if (leftVal^sum)&(rightVal^sum) < 0 {
+			return nil, false
+		}
+		return &Integer{Value: sum}, true
+	case "-":
+		diff := leftVal - rightVal
+		if (leftVal^rightVal)&(leftVal^diff) < 0 {
+			return nil, false
+		}
+		return &Integer{Value: diff}, true
+	case "*":
+		if leftVal == 0 || rightVal == 0 {
+			return &Integer{Value: 0}, true
+		}
+		product := leftVal * rightVal
+		if product/rightVal != leftVal || (leftVal == -1 && rightVal == math.MinInt64) ||
+			(rightVal == -1 && leftVal == math.MinInt64) {
+			return nil, false
+		}
+		return &Integer{Value: product}, true
+	case "/":
+		if rightVal == 0 {
+			return newError("division by zero"), true
+		}
+		if leftVal == math.MinInt64 && rightVal == -1 {
+			return nil, false
+		}
+		return &Integer{Value: leftVal / rightVal}, true
+	case "%":
+		if rightVal == 0 {
+			return newError("modulo by zero"), true
+		}
+		return &Integer{Value: leftVal % rightVal}, true
+	case "&":
+		return &Integer{Value: leftVal & rightVal}, true
+	case "|":
+		return &Integer{Value: leftVal | rightVal}, true
+	case "^":
+		return &Integer{Value: leftVal ^ rightVal}, true
+	case "<<":
+		if rightVal < 0 {
+			return newError("negative shift count: %d", rightVal), true
+		}
+		if rightVal >= 63 || leftVal<<rightVal>>rightVal != leftVal {
+			return nil, false
+		}
+		return &Integer{Value: leftVal << rightVal}, true
+	case ">>":
+		if rightVal < 0 {
+			return newError("negative shift count: %d", rightVal), true
+		}
+		if rightVal > 63 {
+			rightVal = 63
+		}
+		return &Integer{Value: leftVal >> rightVal}, true
+	case "**":
+		return nil, false
+	case "<":
+		return NativeBool(leftVal < rightVal), true
+	case ">":
+		return NativeBool(leftVal > rightVal), true
+	case "<=":
+		return NativeBool(leftVal <= rightVal), true
+	case ">=":
+		return NativeBool(leftVal >= rightVal), true
+	case "==":
+		return NativeBool(leftVal == rightVal), true
+	case "!=":
+		return NativeBool(leftVal != rightVal), true
+	default:
+		return newError("unknown operator: %s %s %s", INTEGER_TYPE, operator, INTEGER_TYPE), true
+	}
+}
+
+// bigIntegerInfix implements the same operators as smallIntegerInfix on
+// arbitrary-precision operands. Division and modulo truncate toward zero
+// like their int64 counterparts, bitwise operators treat negative numbers
+// as infinitely sign-extended two's complement, and >> rounds down.
+func bigIntegerInfix(left Object, operator string, right Object) Object {
+	leftVal := toBig(left)
+	rightVal := toBig(right)
+
+	switch operator {
+	case "+":
+		return IntegerFromBig(new(big.Int).Add(leftVal, rightVal))
+	case "-":
+		return IntegerFromBig(new(big.Int).Sub(leftVal, rightVal))
+	case "*":
+		return IntegerFromBig(new(big.Int).Mul(leftVal, rightVal))
+	case "/":
+		if rightVal.Sign() == 0 {
+			return newError("division by zero")
+		}
+		return IntegerFromBig(new(big.Int).Quo(leftVal, rightVal))
+	case "%":
+		if rightVal.Sign() == 0 {
+			return newError("modulo by zero")
+		}
+		return IntegerFromBig(new(big.Int).Rem(leftVal, rightVal))
+	case "&":
+		return IntegerFromBig(new(big.Int).And(leftVal, rightVal))
+	case "|":
+		return IntegerFromBig(new(big.Int).Or(leftVal, rightVal))
+	case "^":
+		return IntegerFromBig(new(big.Int).Xor(leftVal, rightVal))
+	case "<<", ">>":
+		return shift(leftVal, operator, rightVal)
+	case "**":
+		return power(leftVal, rightVal)
+	case "<":
+		return NativeBool(leftVal.Cmp(rightVal) < 0)
+	case ">":
+		return NativeBool(leftVal.Cmp(rightVal) > 0)
+	case "<=":
+		return NativeBool(leftVal.Cmp(rightVal) <= 0)
+	case ">=":
+		return NativeBool(leftVal.Cmp(rightVal) >= 0)
+	case "==":
+		return NativeBool(leftVal.Cmp(rightVal) == 0)
+	case "!=":
+		return NativeBool(leftVal.Cmp(rightVal) != 0)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+func shift(value *big.Int, operator string, count *big.Int) Object {
+	if count.Sign() < 0 {
+		return newError("negative shift count: %s", count)
+	}
+
+	// Shifting right by more than the length of value leaves only its sign.
+	if operator == ">>" {
+		n := uint(value.BitLen())
+		if count.IsUint64() && count.Uint64() < uint64(n) {
+			n = uint(count.Uint64())
+		}
+		return IntegerFromBig(new(big.Int).Rsh(value, n))
+	}
+
+	if value.Sign() == 0 {
+		return &Integer{Value: 0}
+	}
+	if !count.IsInt64() || count.Int64() > maxIntegerBits-int64(value.BitLen()) {
+		return newError("integer too large")
+	}
+	return IntegerFromBig(new(big.Int).Lsh(value, uint(count.Int64())))
+}
+
+// power computes base ** exp. A negative exponent gives a float, as the
+// result is a fraction unless base is 1 or -1.
+func power(base, exp *big.Int) Object {
+	if exp.Sign() < 0 {
+		if base.Sign() == 0 {
+			return newError("division by zero")
+		}
+		return &Float{Value: math.Pow(bigToFloat(base), bigToFloat(exp))}
+	}
+
+	// The result has at least exp bits for each bit of base after the
+	// first, so 0, 1 and -1 can be raised to any power.
+	if bits := int64(base.BitLen() - 1); bits > 0 && (!exp.IsInt64() || exp.Int64() > maxIntegerBits/bits) {
+		return newError("integer too large")
+	}
+	return IntegerFromBig(new(big.Int).Exp(base, exp, nil))
+}
+
+func bigToFloat(v *big.Int) float64 {
+	f, _ := new(big.Float).SetInt(v).Float64()
+	return f
+}
+
+// toBig converts an Integer or BigInteger to a *big.Int. The result must
+// not be modified.
+func toBig(obj Object) *big.Int {
+	switch obj := obj.(type) {
+	case *Integer:
+		return big.NewInt(obj.Value)
+	default:
+		return obj.(*BigInteger).Value
+	}
+}
@@ -0,0 +1,107 @@
+package object
+
+import "unicode/utf8"
+
+// Iterator steps through the elements of an array, string or range, or
+// the entries of a hash, for a for-in loop. Both execution engines use it,
+// so that they visit the same elements in the same order.
+type Iterator struct {
+	next  func() (key, value Object, ok bool)
+	keyed bool // Whether a single loop variable is bound to the key
+	fresh bool // Whether the values are new objects, as for strings
+}
+
+func (it *Iterator) Type() ObjectType { return ITERATOR_TYPE }
+func (it *Iterator) Inspect() string  { return "iterator" }
+
+// Iterate returns an Iterator over obj, or an error if obj cannot be
+// iterated over.
+//
+// The key of an element is its index, counted in characters for strings,
+// and the value is the element itself. Arrays are read as the loop goes,
+// so assignments to later elements are seen. Hashes yield the entries
+// they held when the loop started, ordered as by SortedPairs, with the
+// current value of each.
+func Iterate(obj Object) (*Iterator, *Error) {
+	switch obj := obj.(type) {
+	case *Array:
+		i := 0
+		return &Iterator{next: func() (Object, Object, bool) {
+			if i >= len(obj.Elements) {
+				return nil, nil, false
+			}
+			i++
+			return &Integer{Value: int64(i - 1)}, obj.Elements[i-1], true
+		}}, nil
+
+	case *String:
+		i, offset := 0, 0
+		return &Iterator{fresh: true, next: func() (Object, Object, bool) {
+			if offset >= len(obj.Value) {
+				return nil, nil, false
+			}
+			_, width := utf8.DecodeRuneInString(obj.Value[offset:])
+			char := obj.Value[offset : offset+width]
+			i, offset = i+1, offset+width
+			return &Integer{Value: int64(i - 1)}, &String{Value: char}, true
+		}}, nil
+
+	case *Range:
+		i, value := 0, obj.Start
+		return &Iterator{next: func() (Object, Object, bool) {
+			if obj.Step > 0 && value >= obj.Stop || obj.Step < 0 && value <= obj.Stop {
+				return nil, nil, false
+			}
+			key := &Integer{Value: int64(i)}
+			current := &Integer{Value: value}
+			i++
+			// Stop once the next value would overflow.
+			if next := value + obj.Step; (next > value) == (obj.Step > 0) {
+				value = next
+			} else {
+				value = obj.Stop
+			}
+			return key, current, true
+		}}, nil
+
+	case *Hash:
+		pairs := obj.SortedPairs()
+		i := 0
+		return &Iterator{keyed: true, next: func() (Object, Object, bool) {
+			if i >= len(pairs) {
+				return nil, nil, false
+			}
+			pair := pairs[i]
+			i++
+			if current, ok := obj.Pairs[pair.Key.(Hashable).HashKey()]; ok {
+				pair = current
+			}
+			return pair.Key, pair.Value, true
+		}}, nil
+
+	default:
+		return nil, newError("not iterable: %s", obj.Type())
+	}
+}
+
+// Next returns the key and value of the next element, or false once the
+// iterator is exhausted.
+func (it *Iterator) Next() (key, value Object, ok bool) {
+	return it.next()
+}
+
+// Single returns what a loop with a single variable binds to the element
+// with key and value: the key of a hash entry, and otherwise the value.
+func (it *Iterator) Single(key, value Object) Object {
+	if it.keyed {
+		return key
+	}
+	return value
+}
+
+// Fresh reports whether the values Next returns are created by the
+// iterator, like the characters of a string, rather than taken from what
+// it iterates over.
+func (it *Iterator) Fresh() bool {
+	return it.fresh
+}
@@ -0,0 +1,37 @@
+package object
+
+// Limits bound the resources an evaluation may use. Zero means no limit.
+// Both execution engines enforce them, though the VM counts its steps
+// differently.
+type Limits struct {
+	MaxDepth  int   // Nested calls to Mira functions
+	MaxSteps  int   // Syntax tree nodes evaluated, or VM instructions run
+	MaxMemory int64 // Approximate bytes allocated, as reported by Size
+}
+
+// Approximate sizes in bytes of the objects that are accounted for. An
+// object is charged for its header and the slots referring to its
+// elements; the elements are charged when they are created.
+const (
+	stringSize  = 16 // Plus one byte per byte of the string
+	arraySize   = 24
+	elementSize = 16
+	hashSize    = 48
+
+	// PairSize is charged for each key added to an existing hash.
+	PairSize = 64
+)
+
+// Size returns the approximate number of bytes charged for creating obj,
+// or zero for objects that are not accounted for.
+func Size(obj Object) int64 {
+	switch obj := obj.(type) {
+	case *String:
+		return stringSize + int64(len(obj.Value))
+	case *Array:
+		return arraySize + elementSize*int64(len(obj.Elements))
+	case *Hash:
+		return hashSize + PairSize*int64(len(obj.Pairs))
+	}
+	return 0
+}
@@ -2,14 +2,22 @@ package object
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"hash/fnv"
+	"math"
+	"math/big"
 	"mira/ast"
+	"mira/code"
+	"mira/token"
+	"sort"
+	"strconv"
 	"strings"
 )
 
 const (
 	INTEGER_TYPE  = "INTEGER"
+	FLOAT_TYPE    = "FLOAT"
 	BOOL_TYPE     = "BOOL"
 	NULL_TYPE     = "NULL"
 	RETURN_VALUE  = "RETURN_VALUE"
@@ -19,6 +27,16 @@ const (
 	BUILTIN_TYPE  = "BUILTIN"
 	ARRAY_TYPE    = "ARRAY"
 	HASH_TYPE     = "HASH"
+	RANGE_TYPE    = "RANGE"
+
+	// Loops
+	BREAK_TYPE    = "BREAK"
+	CONTINUE_TYPE = "CONTINUE"
+	ITERATOR_TYPE = "ITERATOR"
+
+	// Bytecode
+	COMPILED_FUNCTION_TYPE = "COMPILED_FUNCTION"
+	CELL_TYPE              = "CELL"
 
 	// Macro
 	QUOTE_TYPE = "QUOTE"
@@ -39,6 +57,40 @@ type Integer struct {
 func (i *Integer) Inspect() string  { return fmt.Sprintf("%d", i.Value) }
 func (i *Integer) Type() ObjectType { return INTEGER_TYPE }
 
+// BigInteger holds integers that do not fit in an int64. It is the same
+// Mira type as Integer; IntegerFromBig keeps every value in exactly one of
+// the two representations.
+type BigInteger struct {
+	Value *big.Int
+}
+
+func (b *BigInteger) Inspect() string  { return b.Value.String() }
+func (b *BigInteger) Type() ObjectType { return INTEGER_TYPE }
+
+// IntegerFromBig returns an Integer when v fits in an int64 and a
+// BigInteger otherwise.
+func IntegerFromBig(v *big.Int) Object {
+	if v.IsInt64() {
+		return &Integer{Value: v.Int64()}
+	}
+	return &BigInteger{Value: v}
+}
+
+type Float struct {
+	Value float64
+}
+
+// Inspect formats the shortest representation that round-trips, always
+// keeping a decimal point or exponent so floats read back as floats.
+func (f *Float) Inspect() string {
+	s := strconv.FormatFloat(f.Value, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eIN") {
+		s += ".0"
+	}
+	return s
+}
+func (f *Float) Type() ObjectType { return FLOAT_TYPE }
+
 type Bool struct {
 	Value bool
 }
@@ -65,14 +117,92 @@ type ReturnValue struct {
 func (rv *ReturnValue) Type() ObjectType { return RETURN_VALUE }
 func (rv *ReturnValue) Inspect() string  { return rv.Value.Inspect() }
 
+// Break and Continue are the signals of the break and continue statements,
+// which the evaluator passes up to the innermost enclosing loop like it
+// passes a ReturnValue up to the enclosing function.
+type (
+	Break    struct{}
+	Continue struct{}
+)
+
+func (b *Break) Type() ObjectType    { return BREAK_TYPE }
+func (b *Break) Inspect() string     { return "break" }
+func (c *Continue) Type() ObjectType { return CONTINUE_TYPE }
+func (c *Continue) Inspect() string  { return "continue" }
+
+var (
+	BREAK    = &Break{}
+	CONTINUE = &Continue{}
+)
+
 type Error struct {
 	Message string
+	Pos     token.Position // Where the error was raised, if known
+	Stack   []Frame        // Call stack at Pos, innermost frame first
+	Cause   error          // Why evaluation was aborted, for limit errors
+}
+
+// Errors that abort an evaluation which exceeded one of its limits, as
+// opposed to errors in the program itself. They are the Cause of the
+// *Error that reports them, so hosts can detect them with errors.Is.
+var (
+	ErrStackDepth  = errors.New("stack depth exceeded")
+	ErrStepLimit   = errors.New("step limit exceeded")
+	ErrMemoryLimit = errors.New("memory limit exceeded")
+)
+
+// Frame is one entry of an error's stack trace: a function and the
+// position execution had reached inside it.
+type Frame struct {
+	Function string
+	Pos      token.Position
 }
 
 func (e *Error) Type() ObjectType { return ERROR_TYPE }
-func (e *Error) Inspect() string  { return "ERROR: " + e.Message }
+func (e *Error) Inspect() string {
+	if e.Pos.IsValid() {
+		return "ERROR: " + e.Pos.String() + ": " + e.Message
+	}
+	return "ERROR: " + e.Message
+}
+
+// Error makes *Error a Go error, for hosts that handle Mira errors as such.
+func (e *Error) Error() string { return e.Inspect() }
+
+// Unwrap returns the cause of a limit error, or nil.
+func (e *Error) Unwrap() error { return e.Cause }
+
+// traceEndFrames is how many frames StackTrace shows at each end of a
+// longer call stack, such as that of runaway recursion.
+const traceEndFrames = 10
+
+// StackTrace formats the call stack in the style of a Go panic trace, one
+// function per entry followed by its indented position. Of a stack with
+// more than 2*traceEndFrames frames, only the innermost and outermost
+// traceEndFrames are shown, around a line counting the others.
+func (e *Error) StackTrace() string {
+	var out bytes.Buffer
+
+	skipped := len(e.Stack) - 2*traceEndFrames
+	for i, f := range e.Stack {
+		if skipped > 0 && i >= traceEndFrames && i < len(e.Stack)-traceEndFrames {
+			if i == traceEndFrames {
+				fmt.Fprintf(&out, "... %d more frames\n", skipped)
+			}
+			continue
+		}
+		out.WriteString(f.Function)
+		out.WriteString("\n\t")
+		out.WriteString(f.Pos.String())
+		out.WriteString("\n")
+	}
+
+	return out.String()
+}
 
 type Function struct {
+	Name       string // Declared or binding name, empty for anonymous functions
+	Declared   bool   // Whether Name is declared, and so shown by Inspect
 	Body       *ast.BlockStatement
 	Env        *Env
 	Parameters []*ast.Identifier
@@ -88,6 +218,9 @@ func (f *Function) Inspect() string {
 	}
 
 	out.WriteString("fn")
+	if f.Declared {
+		out.WriteString(" " + f.Name)
+	}
 	out.WriteString("(")
 	out.WriteString(strings.Join(params, ", "))
 	out.WriteString(") {\n")
@@ -97,27 +230,101 @@ func (f *Function) Inspect() string {
 	return out.String()
 }
 
+// CompiledFunction is the bytecode of a function literal, shared by every
+// closure created from it.
+type CompiledFunction struct {
+	Instructions  code.Instructions
+	NumLocals     int
+	NumParameters int
+	Name          string        // "<main>" for the program, or the declared name
+	Positions     code.PosTable // Source positions of the instructions
+	LocalNames    []string      // Names of the local slots, for errors
+	FreeNames     []string      // Names of the free variables, for errors
+	Source        string        // Inspect of the equivalent unnamed Function
+}
+
+func (cf *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION_TYPE }
+func (cf *CompiledFunction) Inspect() string {
+	if cf.Source != "" {
+		return cf.Source
+	}
+	return fmt.Sprintf("CompiledFunction[%p]", cf)
+}
+
+// Closure is a CompiledFunction together with the cells of the variables
+// it captured. It is the same Mira type as Function.
+type Closure struct {
+	Fn   *CompiledFunction
+	Free []Object
+	Name string // Binding name, empty for anonymous functions
+}
+
+func (c *Closure) Type() ObjectType { return FUNCTION_TYPE }
+func (c *Closure) Inspect() string {
+	if c.Fn.Name == "" || c.Fn.Source == "" {
+		return c.Fn.Inspect()
+	}
+	return "fn " + c.Fn.Name + strings.TrimPrefix(c.Fn.Source, "fn")
+}
+
+// Cell holds a local variable that is captured by a closure. Value is nil
+// until the variable is bound.
+type Cell struct {
+	Value Object
+}
+
+func (c *Cell) Type() ObjectType { return CELL_TYPE }
+func (c *Cell) Inspect() string {
+	if c.Value == nil {
+		return "cell()"
+	}
+	return "cell(" + c.Value.Inspect() + ")"
+}
+
 type (
-	BuiltinFunction func(args ...Object) Object
+	// BuiltinFunction implements a builtin. It reads and writes the
+	// program's standard streams through ctx.
+	BuiltinFunction func(ctx *ExecContext, args ...Object) Object
 	Builtin         struct {
 		Fn BuiltinFunction
+
+		// Borrows reports that Fn returns one of its arguments or an
+		// element of one rather than a new object, so an evaluation does
+		// not charge its result against the memory limit again.
+		Borrows bool
 	}
 )
 
 func (b *Builtin) Type() ObjectType { return BUILTIN_TYPE }
 func (b *Builtin) Inspect() string  { return "builtin function" }
 
+// Array is a fixed-length sequence of values. Arrays are mutable and
+// shared by reference: assigning to arr[i] replaces the element in place,
+// and the change is seen through every variable and element holding the
+// same array. Only existing elements can be assigned; builtins such as
+// push never modify their arguments but return a new array.
 type Array struct {
 	Elements []Object
 }
 
 func (a *Array) Type() ObjectType { return ARRAY_TYPE }
-func (a *Array) Inspect() string {
+func (a *Array) Inspect() string  { return a.inspect(map[Object]bool{}) }
+
+// inspect prints the array, showing as [...] any array or hash that
+// contains itself through seen, the containers being printed. Index
+// assignment can create such cycles.
+func (a *Array) inspect(seen map[Object]bool) string {
+	if seen[a] {
+		return "[...]"
+	}
+	seen[a] = true
+	defer delete(seen, a)
+
 	var out bytes.Buffer
 
 	elements := []string{}
 	for _, el := range a.Elements {
-		elements = append(elements, el.Inspect())
+		elements = append(elements, inspectElement(el, seen))
 	}
 
 	out.WriteString("[")
@@ -148,6 +355,28 @@ func (i *Integer) HashKey() HashKey {
 	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
 }
 
+// HashKey of a float with an integral value matches the integer key, so
+// that keys which compare equal with == also find the same entry.
+func (f *Float) HashKey() HashKey {
+	if f.Value == math.Trunc(f.Value) && !math.IsInf(f.Value, 0) {
+		integer, _ := big.NewFloat(f.Value).Int(nil)
+		return IntegerFromBig(integer).(Hashable).HashKey()
+	}
+
+	return HashKey{Type: f.Type(), Value: math.Float64bits(f.Value)}
+}
+
+// bigIntegerKeyType keeps BigInteger hash keys apart from Integer keys,
+// which use the value itself as the hash.
+const bigIntegerKeyType = "BIG_INTEGER"
+
+func (b *BigInteger) HashKey() HashKey {
+	h := fnv.New64a()
+	h.Write([]byte(b.Value.String()))
+
+	return HashKey{Type: bigIntegerKeyType, Value: h.Sum64()}
+}
+
 func (s *String) HashKey() HashKey {
 	h := fnv.New64a()
 	h.Write([]byte(s.Value))
@@ -160,18 +389,33 @@ type HashPair struct {
 	Value Object
 }
 
+// Hash maps hashable keys to values. Like arrays, hashes are mutable and
+// shared by reference: assigning to h[k] adds the entry or replaces its
+// value in place, visibly to every holder of the hash.
 type Hash struct {
 	Pairs map[HashKey]HashPair
 }
 
 func (h *Hash) Type() ObjectType { return HASH_TYPE }
-func (h *Hash) Inspect() string {
+func (h *Hash) Inspect() string  { return h.inspect(map[Object]bool{}) }
+
+// inspect prints the hash, showing as {...} a hash that contains itself,
+// like Array.inspect.
+func (h *Hash) inspect(seen map[Object]bool) string {
+	if seen[h] {
+		return "{...}"
+	}
+	seen[h] = true
+	defer delete(seen, h)
+
 	var out bytes.Buffer
 
+	// Sort the pairs so that printing a hash is deterministic.
 	pairs := []string{}
 	for _, pair := range h.Pairs {
-		pairs = append(pairs, fmt.Sprintf("%s: %s", pair.Key.Inspect(), pair.Value.Inspect()))
+		pairs = append(pairs, fmt.Sprintf("%s: %s", pair.Key.Inspect(), inspectElement(pair.Value, seen)))
 	}
+	sort.Strings(pairs)
 
 	out.WriteString("{")
 	out.WriteString(strings.Join(pairs, ", "))
@@ -180,6 +424,75 @@ func (h *Hash) Inspect() string {
 	return out.String()
 }
 
+// inspectElement prints an element of an array or hash.
+func inspectElement(obj Object, seen map[Object]bool) string {
+	switch obj := obj.(type) {
+	case *Array:
+		return obj.inspect(seen)
+	case *Hash:
+		return obj.inspect(seen)
+	default:
+		return obj.Inspect()
+	}
+}
+
+// SortedPairs returns the entries of the hash ordered by key: false before
+// true, then numbers by value, then strings. For-in loops visit hashes in
+// this order.
+func (h *Hash) SortedPairs() []HashPair {
+	pairs := make([]HashPair, 0, len(h.Pairs))
+	for _, pair := range h.Pairs {
+		pairs = append(pairs, pair)
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		return keyLess(pairs[i].Key, pairs[j].Key)
+	})
+	return pairs
+}
+
+func keyLess(a, b Object) bool {
+	rankA, rankB := keyRank(a), keyRank(b)
+	if rankA != rankB {
+		return rankA < rankB
+	}
+
+	switch a := a.(type) {
+	case *Bool:
+		return !a.Value && b.(*Bool).Value
+	case *String:
+		return a.Value < b.(*String).Value
+	default:
+		return Infix(a, "<", b) == TRUE
+	}
+}
+
+func keyRank(key Object) int {
+	switch key.Type() {
+	case BOOL_TYPE:
+		return 0
+	case INTEGER_TYPE, FLOAT_TYPE:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// Range is the sequence of integers from Start up to, but excluding, Stop
+// in increments of Step, which is negative for a range that counts down.
+// It is made by the range builtin and iterated by for-in loops without
+// ever being stored as an array.
+type Range struct {
+	Start, Stop, Step int64
+}
+
+func (r *Range) Type() ObjectType { return RANGE_TYPE }
+func (r *Range) Inspect() string {
+	if r.Step == 1 {
+		return fmt.Sprintf("range(%d, %d)", r.Start, r.Stop)
+	}
+	return fmt.Sprintf("range(%d, %d, %d)", r.Start, r.Stop, r.Step)
+}
+
 type Hashable interface {
 	HashKey() HashKey
 }
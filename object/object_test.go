@@ -1,6 +1,13 @@
 package object
 
-import "testing"
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"mira/token"
+	"strings"
+	"testing"
+)
 
 func TestStringHashKey(t *testing.T) {
 	hello1 := &String{Value: "Hello World!"}
@@ -20,3 +27,139 @@ func TestStringHashKey(t *testing.T) {
 		t.Errorf("strings with same content have different hash keys")
 	}
 }
+
+func TestFloatHashKey(t *testing.T) {
+	if (&Float{Value: 1.5}).HashKey() != (&Float{Value: 1.5}).HashKey() {
+		t.Errorf("floats with same value have different hash keys")
+	}
+
+	if (&Float{Value: 1.5}).HashKey() == (&Float{Value: 2.5}).HashKey() {
+		t.Errorf("floats with different values have same hash keys")
+	}
+
+	if (&Float{Value: 2}).HashKey() != (&Integer{Value: 2}).HashKey() {
+		t.Errorf("integral float and equal integer have different hash keys")
+	}
+
+	if (&Float{Value: -0.0}).HashKey() != (&Float{Value: 0}).HashKey() {
+		t.Errorf("negative and positive zero have different hash keys")
+	}
+}
+
+func TestFloatInspect(t *testing.T) {
+	tests := []struct {
+		value    float64
+		expected string
+	}{
+		{1, "1.0"},
+		{3.25, "3.25"},
+		{-0.5, "-0.5"},
+		{1e21, "1e+21"},
+	}
+
+	for _, tt := range tests {
+		if got := (&Float{Value: tt.value}).Inspect(); got != tt.expected {
+			t.Errorf("wrong Inspect. got=%q, want=%q", got, tt.expected)
+		}
+	}
+}
+
+func TestCyclicInspect(t *testing.T) {
+	arr := &Array{Elements: []Object{&Integer{Value: 1}, NULL}}
+	arr.Elements[1] = arr
+	if got := arr.Inspect(); got != "[1, [...]]" {
+		t.Errorf("wrong Inspect. got=%q", got)
+	}
+
+	key := &String{Value: "self"}
+	hash := &Hash{Pairs: map[HashKey]HashPair{}}
+	hash.Pairs[key.HashKey()] = HashPair{Key: key, Value: &Array{Elements: []Object{hash}}}
+	if got := hash.Inspect(); got != "{self: [{...}]}" {
+		t.Errorf("wrong Inspect. got=%q", got)
+	}
+}
+
+func TestStackTraceTruncation(t *testing.T) {
+	frames := func(n int) []Frame {
+		stack := make([]Frame, n)
+		for i := range stack {
+			stack[i] = Frame{Function: fmt.Sprintf("f%d", i), Pos: token.Position{Line: i + 1, Column: 1}}
+		}
+		return stack
+	}
+
+	full := (&Error{Stack: frames(20)}).StackTrace()
+	if strings.Count(full, "\n\t") != 20 || strings.Contains(full, "more frames") {
+		t.Errorf("short trace shortened. got=%q", full)
+	}
+
+	trace := (&Error{Stack: frames(25)}).StackTrace()
+	if strings.Count(trace, "\n\t") != 20 {
+		t.Errorf("wrong number of frames. got=%q", trace)
+	}
+	if !strings.Contains(trace, "f9\n\t10:1\n... 5 more frames\nf15\n\t16:1\n") {
+		t.Errorf("wrong elision. got=%q", trace)
+	}
+}
+
+func TestBigIntegerHashKey(t *testing.T) {
+	two64, _ := new(big.Int).SetString("18446744073709551616", 10)
+	a := &BigInteger{Value: two64}
+	b := &BigInteger{Value: new(big.Int).Set(two64)}
+	f := &Float{Value: 18446744073709551616.0}
+
+	if a.HashKey() != b.HashKey() {
+		t.Errorf("big integers with same value have different hash keys")
+	}
+	if a.HashKey() != f.HashKey() {
+		t.Errorf("big integer and equal float have different hash keys")
+	}
+
+	small := IntegerFromBig(big.NewInt(42))
+	if _, ok := small.(*Integer); !ok {
+		t.Errorf("IntegerFromBig did not demote 42. got=%T", small)
+	}
+	if _, ok := IntegerFromBig(two64).(*BigInteger); !ok {
+		t.Errorf("IntegerFromBig demoted 2**64")
+	}
+}
+
+func TestIterate(t *testing.T) {
+	hash := &Hash{Pairs: map[HashKey]HashPair{}}
+	for _, key := range []Object{&String{Value: "b"}, &Integer{Value: 2}, TRUE, &String{Value: "a"}, &Float{Value: 1.5}} {
+		hash.Pairs[key.(Hashable).HashKey()] = HashPair{Key: key, Value: NULL}
+	}
+
+	tests := []struct {
+		iterable Object
+		expected string
+	}{
+		{&Array{Elements: []Object{TRUE, NULL}}, "0:true 1:null"},
+		{&String{Value: "añb"}, "0:a 1:ñ 2:b"},
+		{&Range{Start: 0, Stop: 5, Step: 2}, "0:0 1:2 2:4"},
+		{&Range{Start: 3, Stop: 3, Step: 1}, ""},
+		{&Range{Start: 1, Stop: -2, Step: -1}, "0:1 1:0 2:-1"},
+		{&Range{Start: math.MaxInt64 - 1, Stop: math.MaxInt64, Step: 3}, "0:9223372036854775806"},
+		{hash, "true:null 1.5:null 2:null a:null b:null"},
+	}
+
+	for _, tt := range tests {
+		it, err := Iterate(tt.iterable)
+		if err != nil {
+			t.Fatalf("Iterate(%s) returned error: %s", tt.iterable.Inspect(), err.Message)
+		}
+
+		var got []string
+		for key, value, ok := it.Next(); ok; key, value, ok = it.Next() {
+			got = append(got, key.Inspect()+":"+value.Inspect())
+		}
+
+		if strings.Join(got, " ") != tt.expected {
+			t.Errorf("wrong elements for %s. want=%q, got=%q", tt.iterable.Inspect(), tt.expected, strings.Join(got, " "))
+		}
+	}
+
+	if _, err := Iterate(NULL); err == nil || err.Message != "not iterable: NULL" {
+		t.Errorf("wrong error. got=%v", err)
+	}
+}
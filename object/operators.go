@@ -0,0 +1,317 @@
+package object
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+)
+
+// The operator semantics below are shared by every execution engine, so
+// that the evaluator and the VM produce identical results and errors.
+
+var (
+	NULL  = &Null{}
+	TRUE  = &Bool{Value: true}
+	FALSE = &Bool{Value: false}
+)
+
+func NativeBool(input bool) *Bool {
+	if input {
+		return TRUE
+	}
+	return FALSE
+}
+
+func newError(format string, a ...any) *Error {
+	return &Error{Message: fmt.Sprintf(format, a...)}
+}
+
+// IsTruthy reports whether obj counts as true in a condition. Only false
+// and null are falsy.
+func IsTruthy(obj Object) bool {
+	switch obj {
+	case NULL:
+		return false
+	case TRUE:
+		return true
+	case FALSE:
+		return false
+	default:
+		return true
+	}
+}
+
+// IsLogical reports whether operator is one of the logical operators &&,
+// || and ??, which are not applied by Infix since their right operand is
+// only evaluated when ShortCircuits reports false.
+func IsLogical(operator string) bool {
+	return operator == "&&" || operator == "||" || operator == "??"
+}
+
+// ShortCircuits reports whether the logical operator yields left without
+// looking at its right operand: && when left is falsy, || when it is
+// truthy and ?? when it is not null.
+func ShortCircuits(operator string, left Object) bool {
+	switch operator {
+	case "&&":
+		return !IsTruthy(left)
+	case "||":
+		return IsTruthy(left)
+	default:
+		return left != NULL
+	}
+}
+
+// Prefix applies the prefix operator "!", "-" or "~" to right.
+func Prefix(operator string, right Object) Object {
+	switch operator {
+	case "!":
+		return NativeBool(!IsTruthy(right))
+	case "-":
+		return minusPrefix(right)
+	case "~":
+		return bitNotPrefix(right)
+	default:
+		return newError("unknown operator: %s%s", operator, right.Type())
+	}
+}
+
+func minusPrefix(right Object) Object {
+	switch right := right.(type) {
+	case *Integer, *BigInteger:
+		return integerInfix(&Integer{Value: 0}, "-", right)
+	case *Float:
+		return &Float{Value: -right.Value}
+	default:
+		return newError("unknown operator: -%s", right.Type())
+	}
+}
+
+// bitNotPrefix computes the bitwise complement of an integer, which is
+// -right - 1 in two's complement.
+func bitNotPrefix(right Object) Object {
+	switch right := right.(type) {
+	case *Integer:
+		return &Integer{Value: ^right.Value}
+	case *BigInteger:
+		return IntegerFromBig(new(big.Int).Not(right.Value))
+	default:
+		return newError("unknown operator: ~%s", right.Type())
+	}
+}
+
+// Infix applies a binary operator such as "+" or "<=" to its operands.
+func Infix(left Object, operator string, right Object) Object {
+	switch {
+	case left.Type() == INTEGER_TYPE && right.Type() == INTEGER_TYPE:
+		return integerInfix(left, operator, right)
+	case isNumber(left) && isNumber(right):
+		return floatInfix(left, operator, right)
+	case left.Type() == STRING_TYPE && right.Type() == STRING_TYPE:
+		return stringInfix(left, operator, right)
+	case operator == "==":
+		return NativeBool(left == right)
+	case operator == "!=":
+		return NativeBool(left != right)
+	case left.Type() != right.Type():
+		return newError("type mismatch: %s %s %s", left.Type(), operator, right.Type())
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+func stringInfix(left Object, operator string, right Object) Object {
+	leftVal := left.(*String).Value
+	rightVal := right.(*String).Value
+	switch operator {
+	case "+":
+		return &String{Value: leftVal + rightVal}
+	case "<":
+		return NativeBool(leftVal < rightVal)
+	case ">":
+		return NativeBool(leftVal > rightVal)
+	case "<=":
+		return NativeBool(leftVal <= rightVal)
+	case ">=":
+		return NativeBool(leftVal >= rightVal)
+	case "==":
+		return NativeBool(leftVal == rightVal)
+	case "!=":
+		return NativeBool(leftVal != rightVal)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+// floatInfix handles arithmetic and comparison where at least one operand
+// is a float, promoting the other operand to float. Like /, % follows
+// IEEE 754 rather than failing on a zero divisor.
+func floatInfix(left Object, operator string, right Object) Object {
+	leftVal := toFloat(left)
+	rightVal := toFloat(right)
+	switch operator {
+	case "+":
+		return &Float{Value: leftVal + rightVal}
+	case "-":
+		return &Float{Value: leftVal - rightVal}
+	case "*":
+		return &Float{Value: leftVal * rightVal}
+	case "/":
+		return &Float{Value: leftVal / rightVal}
+	case "%":
+		return &Float{Value: math.Mod(leftVal, rightVal)}
+	case "**":
+		return &Float{Value: math.Pow(leftVal, rightVal)}
+	case "<":
+		return NativeBool(leftVal < rightVal)
+	case ">":
+		return NativeBool(leftVal > rightVal)
+	case "<=":
+		return NativeBool(leftVal <= rightVal)
+	case ">=":
+		return NativeBool(leftVal >= rightVal)
+	case "==":
+		return NativeBool(leftVal == rightVal)
+	case "!=":
+		return NativeBool(leftVal != rightVal)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+func isNumber(obj Object) bool {
+	switch obj.(type) {
+	case *Integer, *BigInteger, *Float:
+		return true
+	default:
+		return false
+	}
+}
+
+// toFloat converts a number to float64. obj must satisfy isNumber.
+func toFloat(obj Object) float64 {
+	switch obj := obj.(type) {
+	case *Integer:
+		return float64(obj.Value)
+	case *BigInteger:
+		return bigToFloat(obj.Value)
+	default:
+		return obj.(*Float).Value
+	}
+}
+
+// IncDec applies "++" or "--" to a number.
+func IncDec(operator string, current Object) Object {
+	one := &Integer{Value: 1}
+
+	switch current.(type) {
+	case *Integer, *BigInteger:
+		return integerInfix(current, operator[:1], one)
+	case *Float:
+		return floatInfix(current, operator[:1], one)
+	default:
+		return newError("unknown operator: %s%s", operator, current.Type())
+	}
+}
+
+// Index evaluates left[index]. Out of range array indices and missing hash
+// keys yield null.
+func Index(left, index Object) Object {
+	switch {
+	case left.Type() == ARRAY_TYPE && index.Type() == INTEGER_TYPE:
+		return arrayIndex(left, index)
+	case left.Type() == HASH_TYPE:
+		return hashIndex(left, index)
+	default:
+		return newError("index operator not supported: %s", left.Type())
+	}
+}
+
+func arrayIndex(array, index Object) Object {
+	arrayObject := array.(*Array)
+	integer, ok := index.(*Integer)
+	if !ok {
+		// A BigInteger is out of range of any array.
+		return NULL
+	}
+	idx := integer.Value
+
+	max := int64(len(arrayObject.Elements) - 1)
+	if idx < 0 || idx > max {
+		return NULL
+	}
+
+	return arrayObject.Elements[idx]
+}
+
+func hashIndex(hash, index Object) Object {
+	hashObject := hash.(*Hash)
+
+	key, ok := index.(Hashable)
+	if !ok {
+		return newError("unusable as hashkey: %s", index.Type())
+	}
+
+	pair, ok := hashObject.Pairs[key.HashKey()]
+	if !ok {
+		return NULL
+	}
+
+	return pair.Value
+}
+
+// CheckIndexTarget reports an error unless container[index] can be
+// assigned to: the element of an array must already exist, while any
+// hashable key of a hash can be set.
+func CheckIndexTarget(container, index Object) *Error {
+	switch container := container.(type) {
+	case *Array:
+		if index.Type() != INTEGER_TYPE {
+			return newError("index operator not supported: %s[%s]", container.Type(), index.Type())
+		}
+		idx, ok := index.(*Integer)
+		if !ok {
+			return newError("index out of range: %s", index.Inspect())
+		}
+		if idx.Value < 0 || idx.Value >= int64(len(container.Elements)) {
+			return newError("index out of range: %d", idx.Value)
+		}
+		return nil
+
+	case *Hash:
+		if _, ok := index.(Hashable); !ok {
+			return newError("unusable as hashkey: %s", index.Type())
+		}
+		return nil
+
+	default:
+		return newError("index operator not supported: %s", container.Type())
+	}
+}
+
+// GetIndexTarget returns the value at container[index], which must have
+// passed CheckIndexTarget, or nil for a missing hash entry.
+func GetIndexTarget(container, index Object) Object {
+	switch container := container.(type) {
+	case *Array:
+		return container.Elements[index.(*Integer).Value]
+	default:
+		pair, ok := container.(*Hash).Pairs[index.(Hashable).HashKey()]
+		if !ok {
+			return nil
+		}
+		return pair.Value
+	}
+}
+
+// SetIndexTarget stores val at container[index], which must have passed
+// CheckIndexTarget.
+func SetIndexTarget(container, index, val Object) {
+	switch container := container.(type) {
+	case *Array:
+		container.Elements[index.(*Integer).Value] = val
+	default:
+		hashed := index.(Hashable).HashKey()
+		container.(*Hash).Pairs[hashed] = HashPair{Key: index, Value: val}
+	}
+}
@@ -0,0 +1,117 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"mira/token"
+	"strings"
+)
+
+type Severity int
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+	SeverityNote
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	case SeverityNote:
+		return "note"
+	default:
+		return "unknown"
+	}
+}
+
+// INFO: Diagnostic codes
+const (
+	CodeUnexpectedToken = "E0001"
+	CodeExpectedExpr    = "E0002"
+	CodeInvalidInteger  = "E0003"
+	CodeUnclosed        = "E0004"
+	CodeInvalidFloat    = "E0005"
+	CodeInvalidToken    = "E0006"
+	CodeOutsideLoop     = "E0007"
+)
+
+// Span is the half-open source range [Start, End) a diagnostic refers to.
+type Span struct {
+	Start token.Position
+	End   token.Position
+}
+
+// Fix is a suggested edit: replace the text covered by Span with Replacement.
+type Fix struct {
+	Message     string
+	Span        Span
+	Replacement string
+}
+
+type Diagnostic struct {
+	Severity Severity
+	Code     string
+	Span     Span
+	Message  string
+	Notes    []string
+	Fix      *Fix
+}
+
+// String formats the diagnostic on a single line, e.g.
+// "main.mira:2:9: error[E0002]: expected an expression, found ;".
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s[%s]: %s", d.Span.Start, d.Severity, d.Code, d.Message)
+}
+
+// Render formats the diagnostic for a terminal, quoting the offending line
+// of source and underlining the span, followed by any notes and fix.
+func (d Diagnostic) Render(source string) string {
+	var out bytes.Buffer
+
+	out.WriteString(d.String())
+	out.WriteString("\n")
+
+	start := d.Span.Start
+	if start.IsValid() && start.Offset <= len(source) {
+		lineStart := strings.LastIndexByte(source[:start.Offset], '\n') + 1
+		lineEnd := strings.IndexByte(source[start.Offset:], '\n')
+		if lineEnd < 0 {
+			lineEnd = len(source)
+		} else {
+			lineEnd += start.Offset
+		}
+
+		width := 1
+		if d.Span.End.Line == start.Line && d.Span.End.Offset > start.Offset {
+			width = d.Span.End.Offset - start.Offset
+		}
+
+		// Keep tabs in the padding so the caret lines up with the quoted source.
+		padding := strings.Map(func(r rune) rune {
+			if r == '\t' {
+				return r
+			}
+			return ' '
+		}, source[lineStart:start.Offset])
+
+		gutter := fmt.Sprintf("%d", start.Line)
+		blank := strings.Repeat(" ", len(gutter))
+
+		fmt.Fprintf(&out, " %s | %s\n", gutter, source[lineStart:lineEnd])
+		fmt.Fprintf(&out, " %s | %s%s\n", blank, padding, strings.Repeat("^", width))
+	}
+
+	for _, note := range d.Notes {
+		fmt.Fprintf(&out, "  = note: %s\n", note)
+	}
+
+	if d.Fix != nil {
+		fmt.Fprintf(&out, "  = help: %s\n", d.Fix.Message)
+	}
+
+	return out.String()
+}
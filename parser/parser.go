@@ -3,7 +3,9 @@
 package parser
 
 import (
+	"errors"
 	"fmt"
+	"math/big"
 	"mira/ast"
 	"mira/lexer"
 	"mira/token"
@@ -14,16 +16,23 @@ import (
 const (
 	_ int = iota
 	LOWEST
+	NULLISH
+	LOGICAL_OR
+	LOGICAL_AND
 	EQUALS
 	COMPARISON
 	SUM
 	PRODUCT
 	PREFIX
+	POWER
 	CALL
 	INDEX
 )
 
 var precedences = map[token.TokenType]int{
+	token.NULLISH:  NULLISH,
+	token.OR:       LOGICAL_OR,
+	token.AND:      LOGICAL_AND,
 	token.EQ:       EQUALS,
 	token.NEQ:      EQUALS,
 	token.LT:       COMPARISON,
@@ -32,19 +41,40 @@ var precedences = map[token.TokenType]int{
 	token.GE:       COMPARISON,
 	token.PLUS:     SUM,
 	token.MINUS:    SUM,
+	token.BIT_OR:   SUM,
+	token.BIT_XOR:  SUM,
 	token.ASTERISK: PRODUCT,
 	token.SLASH:    PRODUCT,
+	token.PERCENT:  PRODUCT,
+	token.BIT_AND:  PRODUCT,
+	token.SHL:      PRODUCT,
+	token.SHR:      PRODUCT,
+	token.POWER:    POWER,
 	token.LPAREN:   CALL,
 	token.LBRACKET: INDEX,
 }
 
+// Operators that group to the right, so that 2 ** 3 ** 2 is 2 ** (3 ** 2).
+var rightAssociative = map[token.TokenType]bool{
+	token.POWER: true,
+}
+
 type Parser struct {
 	l             *lexer.Lexer
 	prefixParsers map[token.TokenType]prefixParseFn
 	infixParsers  map[token.TokenType]infixParseFn
 	currToken     token.Token
 	peekToken     token.Token
-	errors        []string
+	diagnostics   []Diagnostic
+	panicking     bool           // Set after an error until the parser resynchronizes
+	lexErrorAt    token.Position // Start of the last token the lexer reported
+	loopDepth     int            // Loops enclosing the current token in this function
+
+	// Comments, only collected when the lexer runs in ScanComments mode.
+	comments []*ast.CommentGroup
+	group    *ast.CommentGroup // Group still accepting comments
+	trailing bool              // Whether group trails code on its first line
+	attached map[*ast.CommentGroup]bool
 }
 
 type (
@@ -55,10 +85,66 @@ type (
 func (p *Parser) nextToken() {
 	p.currToken = p.peekToken
 	p.peekToken = p.l.NextToken()
+
+	for p.peekToken.Type == token.COMMENT {
+		p.addComment(p.peekToken)
+		p.peekToken = p.l.NextToken()
+	}
+	p.group = nil
+}
+
+// addComment adds a comment read after currToken to the current group, or
+// starts a new group after a blank line or when the comment trails code.
+func (p *Parser) addComment(tok token.Token) {
+	trailing := p.group == nil && p.currToken.End.IsValid() && tok.Pos.Line == p.currToken.End.Line
+
+	if p.group == nil || trailing ||
+		tok.Pos.Line > p.group.End().Line+1 ||
+		p.trailing && tok.Pos.Line > p.group.End().Line {
+		p.group = &ast.CommentGroup{}
+		p.trailing = trailing
+		p.comments = append(p.comments, p.group)
+	}
+
+	p.group.List = append(p.group.List, &ast.Comment{Token: tok})
+}
+
+// leadingComment claims the comment group ending on the line above (or
+// the line of) a statement starting at pos, before nested statements can.
+func (p *Parser) leadingComment(pos token.Position) *ast.CommentGroup {
+	for i := len(p.comments) - 1; i >= 0; i-- {
+		g := p.comments[i]
+		if g.End().Offset > pos.Offset {
+			continue
+		}
+		if p.attached[g] || g.End().Line < pos.Line-1 {
+			return nil
+		}
+		p.attached[g] = true
+		return g
+	}
+
+	return nil
+}
+
+// lineComment claims the comment group starting after end on the same line.
+func (p *Parser) lineComment(end token.Position) *ast.CommentGroup {
+	var line *ast.CommentGroup
+	for i := len(p.comments) - 1; i >= 0 && p.comments[i].Pos().Offset >= end.Offset; i-- {
+		if g := p.comments[i]; g.Pos().Line == end.Line && !p.attached[g] {
+			line = g
+		}
+	}
+
+	if line != nil {
+		p.attached[line] = true
+	}
+	return line
 }
 
 func New(l *lexer.Lexer) *Parser {
-	p := &Parser{l: l, errors: []string{}}
+	p := &Parser{l: l, diagnostics: []Diagnostic{}, attached: map[*ast.CommentGroup]bool{}}
+	l.OnError(p.lexError)
 
 	// Infix Parse Functions
 	p.infixParsers = make(map[token.TokenType]infixParseFn)
@@ -72,6 +158,16 @@ func New(l *lexer.Lexer) *Parser {
 	p.infixParsers[token.MINUS] = p.parseInfixExpression
 	p.infixParsers[token.ASTERISK] = p.parseInfixExpression
 	p.infixParsers[token.SLASH] = p.parseInfixExpression
+	p.infixParsers[token.PERCENT] = p.parseInfixExpression
+	p.infixParsers[token.POWER] = p.parseInfixExpression
+	p.infixParsers[token.BIT_AND] = p.parseInfixExpression
+	p.infixParsers[token.BIT_OR] = p.parseInfixExpression
+	p.infixParsers[token.BIT_XOR] = p.parseInfixExpression
+	p.infixParsers[token.SHL] = p.parseInfixExpression
+	p.infixParsers[token.SHR] = p.parseInfixExpression
+	p.infixParsers[token.AND] = p.parseInfixExpression
+	p.infixParsers[token.OR] = p.parseInfixExpression
+	p.infixParsers[token.NULLISH] = p.parseInfixExpression
 	p.infixParsers[token.LPAREN] = p.parseCallExpression
 	p.infixParsers[token.LBRACKET] = p.parseIndexExpression
 
@@ -79,8 +175,10 @@ func New(l *lexer.Lexer) *Parser {
 	p.prefixParsers = make(map[token.TokenType]prefixParseFn)
 	p.prefixParsers[token.IDENTIFIER] = p.parseIdentifier
 	p.prefixParsers[token.INT] = p.parseIntegerLiteral
+	p.prefixParsers[token.FLOAT] = p.parseFloatLiteral
 	p.prefixParsers[token.BANG] = p.parsePrefixExpression
 	p.prefixParsers[token.MINUS] = p.parsePrefixExpression
+	p.prefixParsers[token.BIT_NOT] = p.parsePrefixExpression
 	p.prefixParsers[token.DEC] = p.parsePrefixExpression
 	p.prefixParsers[token.INC] = p.parsePrefixExpression
 	p.prefixParsers[token.TRUE] = p.parseBoolean
@@ -89,6 +187,7 @@ func New(l *lexer.Lexer) *Parser {
 	p.prefixParsers[token.IF] = p.parseIfExpression
 	p.prefixParsers[token.FUNCTION] = p.parseFunctionLiteral
 	p.prefixParsers[token.STRING] = p.parseStringLiteral
+	p.prefixParsers[token.INTERP_HEAD] = p.parseInterpolatedString
 	p.prefixParsers[token.LBRACKET] = p.parseArrayLiteral
 	p.prefixParsers[token.LBRACE] = p.parseHashLiteral
 	p.prefixParsers[token.MACRO] = p.parseMacroLiteral
@@ -109,9 +208,14 @@ func (p *Parser) ParseProgram() *ast.Program {
 		if stmnt != nil {
 			program.Statements = append(program.Statements, stmnt)
 		}
+		if p.panicking {
+			p.synchronize()
+		}
 		p.nextToken()
 	}
 
+	program.Comments = p.comments
+
 	return program
 }
 
@@ -127,10 +231,29 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	literal := &ast.IntegerLiteral{Token: p.currToken}
 
 	value, err := strconv.ParseInt(p.currToken.Literal, 0, 64)
+	if errors.Is(err, strconv.ErrRange) {
+		if b, ok := new(big.Int).SetString(p.currToken.Literal, 0); ok {
+			literal.Big = b
+			return literal
+		}
+	}
 	if err != nil {
-		errMsg := fmt.Sprintf("Could not parse %s as integer", p.currToken.Literal)
-		p.errors = append(p.errors, errMsg)
+		p.errorf(CodeInvalidInteger, p.currToken, "could not parse %s as integer", p.currToken.Literal)
+
+		return nil
+	}
+
+	literal.Value = value
+
+	return literal
+}
+
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	literal := &ast.FloatLiteral{Token: p.currToken}
 
+	value, err := strconv.ParseFloat(p.currToken.Literal, 64)
+	if err != nil {
+		p.errorf(CodeInvalidFloat, p.currToken, "could not parse %s as float", p.currToken.Literal)
 		return nil
 	}
 
@@ -143,7 +266,40 @@ func (p *Parser) parseStringLiteral() ast.Expression {
 	return &ast.StringLiteral{Token: p.currToken, Value: p.currToken.Literal}
 }
 
+func (p *Parser) parseInterpolatedString() ast.Expression {
+	str := &ast.InterpolatedString{Token: p.currToken}
+	if p.currToken.Literal != "" {
+		str.Parts = append(str.Parts, p.parseStringLiteral())
+	}
+
+	for {
+		p.nextToken()
+		part := p.parseExpression(LOWEST)
+		if part == nil {
+			return nil
+		}
+		str.Parts = append(str.Parts, part)
+
+		if !p.peekTokenIs(token.INTERP_MID) && !p.peekTokenIs(token.INTERP_TAIL) {
+			p.errorf(CodeUnexpectedToken, p.peekToken,
+				"expected } to close interpolation, got %s instead", p.peekToken.Type)
+			return nil
+		}
+		p.nextToken()
+
+		if p.currToken.Literal != "" {
+			str.Parts = append(str.Parts, p.parseStringLiteral())
+		}
+
+		if p.curTokenIs(token.INTERP_TAIL) {
+			str.Tail = p.currToken
+			return str
+		}
+	}
+}
+
 func (p *Parser) parseHashLiteral() ast.Expression {
+	open := p.currToken
 	hash := &ast.HashLiteral{Token: p.currToken}
 	hash.Pairs = make(map[ast.Expression]ast.Expression)
 
@@ -165,9 +321,10 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 		}
 	}
 
-	if !p.expectPeek(token.RBRACE) {
+	if !p.expectClosing(token.RBRACE, open) {
 		return nil
 	}
+	hash.Rbrace = p.currToken
 
 	return hash
 }
@@ -177,11 +334,15 @@ func (p *Parser) parseArrayLiteral() ast.Expression {
 
 	elements := p.parseExpressionList(token.RBRACKET)
 	array.Elements = elements
+	if p.curTokenIs(token.RBRACKET) {
+		array.Rbracket = p.currToken
+	}
 
 	return array
 }
 
 func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
+	open := p.currToken
 	list := []ast.Expression{}
 
 	if p.peekTokenIs(end) {
@@ -200,7 +361,7 @@ func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
 		list = append(list, p.parseExpression(LOWEST))
 	}
 
-	if !p.expectPeek(end) {
+	if !p.expectClosing(end, open) {
 		return nil
 	}
 
@@ -220,7 +381,7 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 		return nil
 	}
 
-	fn.Body = p.parseBlockStatement()
+	fn.Body = p.parseFunctionBody()
 
 	return fn
 }
@@ -238,11 +399,30 @@ func (p *Parser) parseMacroLiteral() ast.Expression {
 		return nil
 	}
 
-	macro.Body = p.parseBlockStatement()
+	macro.Body = p.parseFunctionBody()
 
 	return macro
 }
 
+// parseFunctionBody parses the body of a function or macro, which is
+// outside of any loop even when the literal is inside one.
+func (p *Parser) parseFunctionBody() *ast.BlockStatement {
+	saved := p.loopDepth
+	p.loopDepth = 0
+	defer func() { p.loopDepth = saved }()
+
+	return p.parseBlockStatement()
+}
+
+// parseLoopBody parses the body of a loop, in which break and continue
+// are allowed.
+func (p *Parser) parseLoopBody() *ast.BlockStatement {
+	p.loopDepth++
+	defer func() { p.loopDepth-- }()
+
+	return p.parseBlockStatement()
+}
+
 func (p *Parser) parsePrefixExpression() ast.Expression {
 	exp := &ast.PrefixExpression{Token: p.currToken, Operator: p.currToken.Literal}
 
@@ -256,7 +436,12 @@ func (p *Parser) parsePrefixExpression() ast.Expression {
 func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	exp := &ast.InfixExpression{Token: p.currToken, Operator: p.currToken.Literal, Left: left}
 
+	// The right operand of a right-associative operator takes in further
+	// operators of the same precedence.
 	precedence := p.currPrecedence()
+	if rightAssociative[p.currToken.Type] {
+		precedence--
+	}
 	p.nextToken()
 
 	exp.Right = p.parseExpression(precedence)
@@ -265,11 +450,12 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 }
 
 func (p *Parser) parseGroupedExpression() ast.Expression {
+	open := p.currToken
 	p.nextToken()
 
 	exp := p.parseExpression(LOWEST)
 
-	if !p.expectPeek(token.RPAREN) {
+	if !p.expectClosing(token.RPAREN, open) {
 		return nil
 	}
 
@@ -307,9 +493,10 @@ func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 	p.nextToken()
 	exp.Index = p.parseExpression(LOWEST)
 
-	if !p.expectPeek(token.RBRACKET) {
+	if !p.expectClosing(token.RBRACKET, exp.Token) {
 		return nil
 	}
+	exp.Rbracket = p.currToken
 
 	return exp
 }
@@ -317,10 +504,14 @@ func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 	exp := &ast.CallExpression{Token: p.currToken, Function: function}
 	exp.Arguments = p.parseExpressionList(token.RPAREN)
+	if p.curTokenIs(token.RPAREN) {
+		exp.Rparen = p.currToken
+	}
 	return exp
 }
 
 func (p *Parser) parseFunctionParams() []*ast.Identifier {
+	open := p.currToken
 	idents := []*ast.Identifier{}
 
 	if p.peekTokenIs(token.RPAREN) {
@@ -342,7 +533,7 @@ func (p *Parser) parseFunctionParams() []*ast.Identifier {
 		idents = append(idents, ident)
 	}
 
-	if !p.expectPeek(token.RPAREN) {
+	if !p.expectClosing(token.RPAREN, open) {
 		return nil
 	}
 
@@ -350,14 +541,41 @@ func (p *Parser) parseFunctionParams() []*ast.Identifier {
 }
 
 func (p *Parser) parseStatement() ast.Statement {
+	doc := p.leadingComment(p.currToken.Pos)
+
+	var stmnt ast.Statement
 	switch p.currToken.Type {
 	case token.LET:
-		return p.parseLetStatement()
+		stmnt = p.parseLetStatement()
 	case token.RETURN:
-		return p.parseReturnStatement()
+		stmnt = p.parseReturnStatement()
+	case token.WHILE:
+		stmnt = p.parseWhileStatement()
+	case token.FOR:
+		stmnt = p.parseForStatement()
+	case token.FUNCTION:
+		if p.peekTokenIs(token.IDENTIFIER) {
+			stmnt = p.parseFunctionStatement()
+		} else {
+			stmnt = p.parseExpressionStatement()
+		}
+	case token.BREAK:
+		stmnt = &ast.BreakStatement{Token: p.currToken}
+		p.parseLoopControl()
+	case token.CONTINUE:
+		stmnt = &ast.ContinueStatement{Token: p.currToken}
+		p.parseLoopControl()
 	default:
-		return p.parseExpressionStatement()
+		stmnt = p.parseExpressionStatement()
+	}
+
+	if c, ok := stmnt.(ast.Commented); ok && len(p.comments) > 0 {
+		trivia := c.CommentTrivia()
+		trivia.Doc = doc
+		trivia.Comment = p.lineComment(p.currToken.End)
 	}
+
+	return stmnt
 }
 
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
@@ -371,9 +589,18 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 		if stmnt != nil {
 			block.Statements = append(block.Statements, stmnt)
 		}
+		if p.panicking && p.synchronize() {
+			break
+		}
 		p.nextToken()
 	}
 
+	if p.curTokenIs(token.RBRACE) {
+		block.Rbrace = p.currToken
+	} else if d := p.errorf(CodeUnclosed, p.currToken, "expected }, got %s instead", p.currToken.Type); d != nil {
+		d.Notes = append(d.Notes, fmt.Sprintf("to match { opened at %s", block.Token.Pos))
+	}
+
 	return block
 }
 
@@ -382,6 +609,11 @@ func (p *Parser) parseExpressionStatement() ast.Statement {
 
 	stmnt.Expression = p.parseExpression(LOWEST)
 
+	if stmnt.Expression != nil && assignOperators[p.peekToken.Type] {
+		p.nextToken()
+		return p.parseAssignStatement(stmnt.Expression)
+	}
+
 	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
@@ -389,11 +621,45 @@ func (p *Parser) parseExpressionStatement() ast.Statement {
 	return stmnt
 }
 
+// Tokens that turn the expression before them into the target of an
+// assignment.
+var assignOperators = map[token.TokenType]bool{
+	token.ASSIGN:          true,
+	token.PLUS_ASSIGN:     true,
+	token.MINUS_ASSIGN:    true,
+	token.ASTERISK_ASSIGN: true,
+	token.SLASH_ASSIGN:    true,
+	token.PERCENT_ASSIGN:  true,
+}
+
+// parseAssignStatement parses the rest of an assignment to target, with
+// the operator as the current token. Whether target can be assigned to is
+// only checked when the assignment runs, as for ++ and --.
+func (p *Parser) parseAssignStatement(target ast.Expression) ast.Statement {
+	stmnt := &ast.AssignStatement{Token: p.currToken, Operator: p.currToken.Literal, Target: target}
+
+	p.nextToken()
+
+	stmnt.Value = p.parseExpression(LOWEST)
+
+	for p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmnt
+}
+
 func (p *Parser) parseExpression(precedence int) ast.Expression {
 	prefix := p.prefixParsers[p.currToken.Type]
 	if prefix == nil {
-		msg := fmt.Sprintf("No prefix parse fn found for %s", p.currToken.Type)
-		p.errors = append(p.errors, msg)
+		if p.curTokenIs(token.ILLEGAL) && p.currToken.Pos == p.lexErrorAt {
+			// Already explained by the lexer, e.g. an unterminated string.
+			p.panicking = true
+		} else if p.curTokenIs(token.ILLEGAL) {
+			p.errorf(CodeUnexpectedToken, p.currToken, "illegal character %q", p.currToken.Literal)
+		} else {
+			p.errorf(CodeExpectedExpr, p.currToken, "expected an expression, found %s", p.currToken.Type)
+		}
 		return nil
 	}
 
@@ -438,6 +704,28 @@ func (p *Parser) parseLetStatement() ast.Statement {
 	return stmnt
 }
 
+// parseFunctionStatement parses a function declaration,
+// `fn name(params) { ... }`.
+func (p *Parser) parseFunctionStatement() ast.Statement {
+	stmnt := &ast.FunctionStatement{Token: p.currToken}
+
+	p.nextToken()
+	stmnt.Name = &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
+
+	fn, ok := p.parseFunctionLiteral().(*ast.FunctionLiteral)
+	if !ok {
+		return nil
+	}
+	fn.Token = stmnt.Token
+	stmnt.Function = fn
+
+	for p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmnt
+}
+
 func (p *Parser) parseReturnStatement() ast.Statement {
 	stmnt := &ast.ReturnStatement{Token: p.currToken}
 
@@ -452,6 +740,85 @@ func (p *Parser) parseReturnStatement() ast.Statement {
 	return stmnt
 }
 
+func (p *Parser) parseWhileStatement() ast.Statement {
+	stmnt := &ast.WhileStatement{Token: p.currToken}
+
+	p.nextToken()
+	stmnt.Condition = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	stmnt.Body = p.parseLoopBody()
+
+	for p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmnt
+}
+
+// parseForStatement parses `for (value in iterable) { ... }` or
+// `for (key, value in iterable) { ... }`.
+func (p *Parser) parseForStatement() ast.Statement {
+	stmnt := &ast.ForStatement{Token: p.currToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	open := p.currToken
+
+	if !p.expectPeek(token.IDENTIFIER) {
+		return nil
+	}
+	stmnt.Value = &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
+
+	if p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+		if !p.expectPeek(token.IDENTIFIER) {
+			return nil
+		}
+		stmnt.Key = stmnt.Value
+		stmnt.Value = &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
+	}
+
+	if !p.expectPeek(token.IN) {
+		return nil
+	}
+
+	p.nextToken()
+	stmnt.Iterable = p.parseExpression(LOWEST)
+
+	if !p.expectClosing(token.RPAREN, open) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	stmnt.Body = p.parseLoopBody()
+
+	for p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmnt
+}
+
+// parseLoopControl finishes a break or continue statement, which must be
+// inside a loop of the same function.
+func (p *Parser) parseLoopControl() {
+	if p.loopDepth == 0 {
+		p.errorf(CodeOutsideLoop, p.currToken, "%s outside of a loop", p.currToken.Literal)
+	}
+
+	for p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+}
+
 func (p Parser) curTokenIs(t token.TokenType) bool {
 	return p.currToken.Type == t
 }
@@ -485,12 +852,128 @@ func (p *Parser) expectPeek(t token.TokenType) bool {
 	return false
 }
 
+// expectClosing is expectPeek for a closing delimiter. When the delimiter is
+// missing the diagnostic points back at the token that opened it.
+func (p *Parser) expectClosing(t token.TokenType, open token.Token) bool {
+	if p.peekTokenIs(t) {
+		p.nextToken()
+		return true
+	}
+	if d := p.peekError(t); d != nil {
+		d.Notes = append(d.Notes, fmt.Sprintf("to match %s opened at %s", open.Literal, open.Pos))
+	}
+	return false
+}
+
+// Errors returns the error diagnostics formatted as "file:line:col: message".
 func (p *Parser) Errors() []string {
-	return p.errors
+	errors := []string{}
+	for _, d := range p.diagnostics {
+		if d.Severity == SeverityError {
+			errors = append(errors, d.Span.Start.String()+": "+d.Message)
+		}
+	}
+	return errors
+}
+
+func (p *Parser) Diagnostics() []Diagnostic {
+	return p.diagnostics
 }
 
-func (p *Parser) peekError(t token.TokenType) {
-	msg := fmt.Sprintf("expected next token to be %s, got %s instead",
+func (p *Parser) peekError(t token.TokenType) *Diagnostic {
+	d := p.errorf(CodeUnexpectedToken, p.peekToken, "expected next token to be %s, got %s instead",
 		t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
+
+	if d != nil && insertable[t] {
+		d.Fix = &Fix{
+			Message:     fmt.Sprintf("insert `%s`", t),
+			Span:        Span{Start: p.currToken.End, End: p.currToken.End},
+			Replacement: string(t),
+		}
+	}
+
+	return d
+}
+
+// Punctuation the parser can suggest inserting when it is missing.
+var insertable = map[token.TokenType]bool{
+	token.ASSIGN:    true,
+	token.COLON:     true,
+	token.COMMA:     true,
+	token.LPAREN:    true,
+	token.RPAREN:    true,
+	token.LBRACE:    true,
+	token.RBRACE:    true,
+	token.RBRACKET:  true,
+	token.SEMICOLON: true,
+}
+
+// errorf records an error diagnostic spanning tok. Only the first error is
+// recorded until the parser resynchronizes; later ones are most likely
+// fallout from it. The returned diagnostic is nil when suppressed, and is
+// otherwise only valid until the next diagnostic is recorded.
+func (p *Parser) errorf(code string, tok token.Token, format string, a ...any) *Diagnostic {
+	if p.panicking {
+		return nil
+	}
+	p.panicking = true
+
+	p.diagnostics = append(p.diagnostics, Diagnostic{
+		Severity: SeverityError,
+		Code:     code,
+		Span:     Span{Start: tok.Pos, End: tok.End},
+		Message:  fmt.Sprintf(format, a...),
+	})
+
+	return &p.diagnostics[len(p.diagnostics)-1]
+}
+
+// lexError records an error reported by the lexer. Lexical errors are never
+// suppressed by panic mode, since the lexer runs a token ahead of the parser.
+func (p *Parser) lexError(pos token.Position, msg string) {
+	p.lexErrorAt = pos
+	p.diagnostics = append(p.diagnostics, Diagnostic{
+		Severity: SeverityError,
+		Code:     CodeInvalidToken,
+		Span:     Span{Start: pos, End: pos},
+		Message:  msg,
+	})
+}
+
+// synchronize leaves panic mode by skipping tokens up to the next likely
+// statement boundary: a `;`, or just before a `}` or statement keyword.
+// Braces opened while skipping are skipped as a unit. It reports true when
+// the error left the parser sitting on a `}` that closes an enclosing block.
+func (p *Parser) synchronize() bool {
+	p.panicking = false
+
+	if p.curTokenIs(token.RBRACE) {
+		return true
+	}
+
+	depth := 0
+	for !p.curTokenIs(token.EOF) {
+		switch p.currToken.Type {
+		case token.LBRACE:
+			depth++
+		case token.RBRACE:
+			depth--
+		case token.SEMICOLON:
+			if depth == 0 {
+				return false
+			}
+		}
+
+		if depth == 0 {
+			switch p.peekToken.Type {
+			case token.LET, token.FUNCTION, token.RETURN, token.WHILE, token.FOR,
+				token.BREAK, token.CONTINUE, token.RBRACE, token.EOF:
+				return false
+			}
+		}
+
+		p.nextToken()
+	}
+
+	return false
 }
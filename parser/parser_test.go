@@ -43,6 +43,50 @@ func TestLetStatements(t *testing.T) {
 	}
 }
 
+func TestAssignStatements(t *testing.T) {
+	tests := []struct {
+		input            string
+		expectedOperator string
+		expected         string
+	}{
+		{"x = 5;", "=", "x = 5;"},
+		{"x += y * 2", "+=", "x += (y * 2);"},
+		{"x -= 1", "-=", "x -= 1;"},
+		{"x *= 1", "*=", "x *= 1;"},
+		{"x /= 1", "/=", "x /= 1;"},
+		{"x %= 1", "%=", "x %= 1;"},
+		{"a[i + 1] = fn() { 1 };", "=", "(a[(i + 1)]) = fn () 1;"},
+		{"h[\"k\"][0] += 1", "+=", "((h[k])[0]) += 1;"},
+		{"5 = 1", "=", "5 = 1;"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statements. got=%d",
+				len(program.Statements))
+		}
+
+		stmt, ok := program.Statements[0].(*ast.AssignStatement)
+		if !ok {
+			t.Fatalf("stmt is not *ast.AssignStatement. got=%T", program.Statements[0])
+		}
+		if stmt.Operator != tt.expectedOperator {
+			t.Errorf("stmt.Operator wrong. expected=%q, got=%q", tt.expectedOperator, stmt.Operator)
+		}
+		if stmt.String() != tt.expected {
+			t.Errorf("stmt.String() wrong. expected=%q, got=%q", tt.expected, stmt.String())
+		}
+		if stmt.Pos() != stmt.Target.Pos() || stmt.End() != stmt.Value.End() {
+			t.Errorf("wrong span %s-%s", stmt.Pos(), stmt.End())
+		}
+	}
+}
+
 func TestReturnStatements(t *testing.T) {
 	tests := []struct {
 		input         string
@@ -177,6 +221,34 @@ func TestIntegerLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestFloatLiteralExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"3.14;", 3.14},
+		{"1e3;", 1000},
+		{"2.5e-1;", 0.25},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmnt := program.Statements[0].(*ast.ExpressionStatement)
+		literal, ok := stmnt.Expression.(*ast.FloatLiteral)
+		if !ok {
+			t.Fatalf("exp not *ast.FloatLiteral. got=%T", stmnt.Expression)
+		}
+
+		if literal.Value != tt.expected {
+			t.Errorf("literal.Value not %g. got=%g", tt.expected, literal.Value)
+		}
+	}
+}
+
 func TestStringLiteralExpression(t *testing.T) {
 	input := `"hello world";`
 
@@ -422,6 +494,7 @@ func TestPrefixOperatorExpression(t *testing.T) {
 		{"-5;", "-", 5},
 		{"--5;", "--", 5},
 		{"++5;", "++", 5},
+		{"~5;", "~", 5},
 	}
 
 	for _, tt := range prefixTests {
@@ -572,6 +645,58 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"add(a * b[2], b[1], 2 * [1, 2][1])",
 			"add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))",
 		},
+		{
+			"a + b % c * d",
+			"(a + ((b % c) * d))",
+		},
+		{
+			"a || b && c == d",
+			"(a || (b && (c == d)))",
+		},
+		{
+			"a && b || !c && d",
+			"((a && b) || ((!c) && d))",
+		},
+		{
+			"a ?? b || c ?? d",
+			"((a ?? (b || c)) ?? d)",
+		},
+		{
+			"a < b && f(x) ?? y[0] + 1",
+			"(((a < b) && f(x)) ?? ((y[0]) + 1))",
+		},
+		{
+			"2 ** 3 ** 2",
+			"(2 ** (3 ** 2))",
+		},
+		{
+			"-2 ** 2",
+			"(-(2 ** 2))",
+		},
+		{
+			"2 ** -1 * 3",
+			"((2 ** (-1)) * 3)",
+		},
+		{
+			"a * b ** c[0]",
+			"(a * (b ** (c[0])))",
+		},
+		{
+			"a & 1 == 0",
+			"((a & 1) == 0)",
+		},
+		{
+			"a | b ^ c & d",
+			"((a | b) ^ (c & d))",
+		},
+		{
+			"1 << n - 1",
+			"((1 << n) - 1)",
+		},
+		{
+			"~a >> 2 + b",
+			"(((~a) >> 2) + b)",
+		},
 	}
 
 	for _, tt := range tests {
@@ -613,6 +738,16 @@ func TestParsingInfixExpressions(t *testing.T) {
 		{"true == true", true, "==", true},
 		{"true != false", true, "!=", false},
 		{"false == false", false, "==", false},
+		{"a && b", "a", "&&", "b"},
+		{"a || b", "a", "||", "b"},
+		{"a ?? b", "a", "??", "b"},
+		{"5 % 5;", 5, "%", 5},
+		{"5 ** 5;", 5, "**", 5},
+		{"5 & 5;", 5, "&", 5},
+		{"5 | 5;", 5, "|", 5},
+		{"5 ^ 5;", 5, "^", 5},
+		{"5 << 5;", 5, "<<", 5},
+		{"5 >> 5;", 5, ">>", 5},
 	}
 
 	for _, tt := range infixTests {
@@ -742,6 +877,159 @@ func TestIfElseExpression(t *testing.T) {
 	}
 }
 
+func TestFunctionStatement(t *testing.T) {
+	input := `fn add(a, b) { a + b } add(1, 2); fn(x) { x }(3)`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 3 {
+		t.Fatalf("program.Statements does not contain 3 statements. got=%d",
+			len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.FunctionStatement)
+	if !ok {
+		t.Fatalf("stmt is not *ast.FunctionStatement. got=%T", program.Statements[0])
+	}
+
+	if stmt.Name.Value != "add" {
+		t.Errorf("wrong name. got=%q", stmt.Name.Value)
+	}
+	if len(stmt.Function.Parameters) != 2 {
+		t.Fatalf("function has wrong parameters. got=%d", len(stmt.Function.Parameters))
+	}
+	if stmt.String() != "fn add(a, b) (a + b)" {
+		t.Errorf("wrong string. got=%q", stmt.String())
+	}
+	if stmt.End() != stmt.Function.Body.End() {
+		t.Errorf("wrong end. got=%s", stmt.End())
+	}
+
+	// A function literal at the start of a statement is still an expression.
+	if _, ok := program.Statements[2].(*ast.ExpressionStatement); !ok {
+		t.Errorf("stmt is not *ast.ExpressionStatement. got=%T", program.Statements[2])
+	}
+}
+
+func TestWhileStatement(t *testing.T) {
+	input := `while (x < 10) { x += 1; if (x == 5) { continue } }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statements. got=%d",
+			len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.WhileStatement)
+	if !ok {
+		t.Fatalf("stmt is not *ast.WhileStatement. got=%T", program.Statements[0])
+	}
+
+	if !testInfixExpression(t, stmt.Condition, "x", "<", 10) {
+		return
+	}
+
+	if len(stmt.Body.Statements) != 2 {
+		t.Fatalf("body is not 2 statements. got=%d", len(stmt.Body.Statements))
+	}
+
+	ifExp := stmt.Body.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.IfExpression)
+	if _, ok := ifExp.Then.Statements[0].(*ast.ContinueStatement); !ok {
+		t.Errorf("statement is not *ast.ContinueStatement. got=%T", ifExp.Then.Statements[0])
+	}
+
+	if stmt.End() != stmt.Body.End() {
+		t.Errorf("wrong end. got=%s", stmt.End())
+	}
+}
+
+func TestForStatement(t *testing.T) {
+	tests := []struct {
+		input    string
+		key      string
+		value    string
+		expected string
+	}{
+		{"for (x in [1, 2]) { break; }", "", "x", "for (x in [1, 2]) break;"},
+		{"for (k, v in h) { k + v };", "k", "v", "for (k, v in h) (k + v)"},
+		{"for (i in range(3)) { for (j in s) { continue } }", "", "i", "for (i in range(3)) for (j in s) continue;"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statements. got=%d",
+				len(program.Statements))
+		}
+
+		stmt, ok := program.Statements[0].(*ast.ForStatement)
+		if !ok {
+			t.Fatalf("stmt is not *ast.ForStatement. got=%T", program.Statements[0])
+		}
+
+		if tt.key == "" && stmt.Key != nil {
+			t.Errorf("stmt.Key is not nil. got=%s", stmt.Key)
+		}
+		if tt.key != "" && (stmt.Key == nil || stmt.Key.Value != tt.key) {
+			t.Errorf("stmt.Key wrong. expected=%s, got=%v", tt.key, stmt.Key)
+		}
+		if stmt.Value.Value != tt.value {
+			t.Errorf("stmt.Value wrong. expected=%s, got=%s", tt.value, stmt.Value)
+		}
+		if stmt.String() != tt.expected {
+			t.Errorf("stmt.String() wrong. expected=%q, got=%q", tt.expected, stmt.String())
+		}
+	}
+}
+
+func TestLoopControlOutsideLoop(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"break;", []string{"1:1: break outside of a loop"}},
+		{"if (x) { continue }", []string{"1:10: continue outside of a loop"}},
+		{"while (x) { let f = fn() { break; }; }", []string{"1:28: break outside of a loop"}},
+		{"for (x in y) { break; continue }; break\nlet a = 1 +;", []string{
+			"1:35: break outside of a loop",
+			"2:12: expected an expression, found ;",
+		}},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != len(tt.expected) {
+			t.Errorf("%q: wrong number of errors. expected=%q, got=%q", tt.input, tt.expected, errors)
+			continue
+		}
+
+		for i, msg := range tt.expected {
+			if errors[i] != msg {
+				t.Errorf("%q: errors[%d] wrong. expected=%q, got=%q", tt.input, i, msg, errors[i])
+			}
+		}
+
+		if d := p.Diagnostics()[0]; d.Code != CodeOutsideLoop {
+			t.Errorf("%q: wrong code. got=%s", tt.input, d.Code)
+		}
+	}
+}
+
 func TestFunctionLiteral(t *testing.T) {
 	input := `fn(x, y) { x + y; }`
 
@@ -966,8 +1254,7 @@ func testInfixExpression(
 }
 
 func checkParserErrors(t *testing.T, p *Parser) {
-	errors := p.errors
-	fmt.Printf("")
+	errors := p.Errors()
 
 	if len(errors) == 0 {
 		return
@@ -1023,3 +1310,278 @@ func TestMacroParsing(t *testing.T) {
 
 	testInfixExpression(t, body.Expression, "x", "+", "y")
 }
+
+func TestErrorPositions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let = 5;", "main.mira:1:5: expected next token to be IDENTIFIER, got = instead"},
+		{"let x = 5;\nlet y = ;", "main.mira:2:9: expected an expression, found ;"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.NewFile("main.mira", tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Fatalf("expected parser errors for %q", tt.input)
+		}
+
+		if errors[0] != tt.expected {
+			t.Errorf("wrong error. expected=%q, got=%q", tt.expected, errors[0])
+		}
+	}
+}
+
+func TestNodePositions(t *testing.T) {
+	input := `let add = fn(x, y) {
+  x + y;
+};
+add(1, [2, 3][0]);`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	tests := []struct {
+		node     ast.Node
+		pos, end string
+	}{
+		{program, "1:1", "4:18"},
+		{program.Statements[0], "1:1", "3:2"},
+		{program.Statements[0].(*ast.LetStatement).Value, "1:11", "3:2"},
+		{program.Statements[1], "4:1", "4:18"},
+		{program.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.CallExpression).Arguments[1], "4:8", "4:17"},
+	}
+
+	for _, tt := range tests {
+		if tt.node.Pos().String() != tt.pos {
+			t.Errorf("%s: wrong pos. expected=%s, got=%s", tt.node, tt.pos, tt.node.Pos())
+		}
+		if tt.node.End().String() != tt.end {
+			t.Errorf("%s: wrong end. expected=%s, got=%s", tt.node, tt.end, tt.node.End())
+		}
+	}
+}
+
+func TestErrorRecovery(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{
+			"let x = 5 +;\nlet y = 10;\ny;",
+			[]string{"1:12: expected an expression, found ;"},
+		},
+		{
+			"let = 5 * * 3;\nlet y = (1 + 2;\nlet z = 3;",
+			[]string{
+				"1:5: expected next token to be IDENTIFIER, got = instead",
+				"2:15: expected next token to be ), got ; instead",
+			},
+		},
+		{
+			"let f = fn(x) { x + ; };\nf(1, 2",
+			[]string{
+				"1:21: expected an expression, found ;",
+				"2:7: expected next token to be ), got EOF instead",
+			},
+		},
+		{
+			"if (x +) { y } let a = 1;",
+			[]string{"1:8: expected an expression, found )"},
+		},
+		{
+			"let x = 1 +)\nfn f() { x }\nfn g( { }",
+			[]string{
+				"1:12: expected an expression, found )",
+				"3:9: expected next token to be ), got } instead",
+			},
+		},
+		{
+			"let add = fn(x, y) { x + y;",
+			[]string{"1:28: expected }, got EOF instead"},
+		},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != len(tt.expected) {
+			t.Errorf("%q: wrong number of errors. expected=%d, got=%d (%q)",
+				tt.input, len(tt.expected), len(errors), errors)
+			continue
+		}
+
+		for i, msg := range tt.expected {
+			if errors[i] != msg {
+				t.Errorf("%q: wrong error[%d]. expected=%q, got=%q", tt.input, i, msg, errors[i])
+			}
+		}
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	input := "let x = (1 + 2;"
+
+	l := lexer.NewFile("main.mira", input)
+	p := New(l)
+	p.ParseProgram()
+
+	diagnostics := p.Diagnostics()
+	if len(diagnostics) != 1 {
+		t.Fatalf("wrong number of diagnostics. got=%d", len(diagnostics))
+	}
+
+	d := diagnostics[0]
+	if d.Severity != SeverityError || d.Code != CodeUnexpectedToken {
+		t.Errorf("wrong severity or code. got=%s %s", d.Severity, d.Code)
+	}
+
+	if d.Fix == nil || d.Fix.Replacement != ")" || d.Fix.Span.Start.Offset != 14 {
+		t.Errorf("wrong fix. got=%+v", d.Fix)
+	}
+
+	expected := `main.mira:1:15: error[E0001]: expected next token to be ), got ; instead
+ 1 | let x = (1 + 2;
+   |               ^
+  = note: to match ( opened at main.mira:1:9
+  = help: insert ` + "`)`" + `
+`
+	if rendered := d.Render(input); rendered != expected {
+		t.Errorf("wrong rendering. expected=\n%s\ngot=\n%s", expected, rendered)
+	}
+}
+
+func TestLexerDiagnostics(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{`let s = "abc;`, []string{"1:9: unterminated string literal"}},
+		{`let s = "a\qc"; let t = 1 +;`, []string{
+			`1:11: unknown escape sequence \q`,
+			"1:28: expected an expression, found ;",
+		}},
+		{"let s = `abc\n", []string{"1:9: unterminated raw string literal"}},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != len(tt.expected) {
+			t.Errorf("%q: wrong number of errors. expected=%q, got=%q", tt.input, tt.expected, errors)
+			continue
+		}
+
+		for i, msg := range tt.expected {
+			if errors[i] != msg {
+				t.Errorf("%q: errors[%d] wrong. expected=%q, got=%q", tt.input, i, msg, errors[i])
+			}
+		}
+	}
+
+	p := New(lexer.New(`"abc`))
+	p.ParseProgram()
+	if d := p.Diagnostics(); len(d) != 1 || d[0].Code != CodeInvalidToken {
+		t.Errorf("wrong diagnostics. got=%+v", d)
+	}
+}
+
+func TestCommentTrivia(t *testing.T) {
+	input := `// add sums
+// two numbers.
+let add = fn(a, b) { a + b }; // exported
+
+/* unattached */
+
+let x = 1;
+// doc for return
+return x; /* one */ // two
+`
+
+	l := lexer.New(input)
+	l.SetMode(lexer.ScanComments)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 3 {
+		t.Fatalf("wrong number of statements. got=%d", len(program.Statements))
+	}
+
+	if len(program.Comments) != 5 {
+		t.Fatalf("wrong number of comment groups. got=%d", len(program.Comments))
+	}
+
+	tests := []struct {
+		doc     string
+		comment string
+	}{
+		{"add sums\ntwo numbers.", "exported"},
+		{"", ""},
+		{"doc for return", "one\ntwo"},
+	}
+
+	for i, tt := range tests {
+		trivia := program.Statements[i].(ast.Commented).CommentTrivia()
+
+		if got := trivia.Doc.Text(); got != tt.doc {
+			t.Errorf("statements[%d] doc wrong. expected=%q, got=%q", i, tt.doc, got)
+		}
+		if got := trivia.Comment.Text(); got != tt.comment {
+			t.Errorf("statements[%d] comment wrong. expected=%q, got=%q", i, tt.comment, got)
+		}
+	}
+}
+
+func TestInterpolatedString(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		parts    int
+	}{
+		{`"hello ${name}!"`, `"hello ${name}!"`, 3},
+		{`"${a + b}"`, `"${(a + b)}"`, 1},
+		{`"x=${x} y=${f(y)}"`, `"x=${x} y=${f(y)}"`, 4},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmnt := program.Statements[0].(*ast.ExpressionStatement)
+		str, ok := stmnt.Expression.(*ast.InterpolatedString)
+		if !ok {
+			t.Fatalf("exp not *ast.InterpolatedString. got=%T", stmnt.Expression)
+		}
+
+		if str.String() != tt.expected {
+			t.Errorf("wrong string. expected=%q, got=%q", tt.expected, str.String())
+		}
+
+		if len(str.Parts) != tt.parts {
+			t.Errorf("wrong number of parts. expected=%d, got=%d", tt.parts, len(str.Parts))
+		}
+
+		if str.End().Offset != len(tt.input) {
+			t.Errorf("wrong end offset. expected=%d, got=%d", len(tt.input), str.End().Offset)
+		}
+	}
+
+	p := New(lexer.New(`"a ${1 2}"`))
+	p.ParseProgram()
+	if errors := p.Errors(); len(errors) != 1 || errors[0] != "1:8: expected } to close interpolation, got INT instead" {
+		t.Errorf("wrong errors. got=%q", errors)
+	}
+}
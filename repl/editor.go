@@ -0,0 +1,439 @@
+// repl/editor.go
+
+package repl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// lineReader reads the REPL's input one line at a time.
+type lineReader interface {
+	readLine(prompt string) (string, error)
+}
+
+// errInterrupt is returned by readLine when the user presses Ctrl-C.
+var errInterrupt = errors.New("interrupt")
+
+// scannerReader reads plain lines, for piped input and dumb terminals.
+type scannerReader struct {
+	scanner *bufio.Scanner
+	out     io.Writer
+}
+
+func (r *scannerReader) readLine(prompt string) (string, error) {
+	fmt.Fprint(r.out, prompt)
+	if !r.scanner.Scan() {
+		if err := r.scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+	return r.scanner.Text(), nil
+}
+
+// A completer returns the candidates for the word ending at the end of
+// line, and the rune offset where that word starts.
+type completer func(line string) (start int, candidates []string)
+
+const historyLimit = 1000
+
+// editor is an interactive line editor with emacs-style key bindings,
+// history and tab completion. It expects a terminal in raw mode.
+type editor struct {
+	in          *bufio.Reader
+	out         io.Writer
+	raw         func() (func(), error) // Enters raw mode, nil if already raw
+	complete    completer
+	history     []string
+	historyFile string // Appended to on every accepted line, "" for none
+
+	prompt  string
+	buf     []rune
+	pos     int    // Cursor position in buf
+	histPos int    // Index into history while browsing it
+	draft   string // The line being edited before browsing history
+}
+
+func ctrl(r rune) rune { return r & 0x1f }
+
+const (
+	keyEscape    = 27
+	keyBackspace = 127
+)
+
+func (e *editor) readLine(prompt string) (string, error) {
+	if e.raw != nil {
+		restore, err := e.raw()
+		if err != nil {
+			return "", err
+		}
+		defer restore()
+	}
+
+	e.prompt, e.buf, e.pos = prompt, nil, 0
+	e.histPos, e.draft = len(e.history), ""
+	e.refresh()
+
+	lastTab := false
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+
+		tab := false
+		switch r {
+		case '\r', '\n':
+			io.WriteString(e.out, "\r\n")
+			line := string(e.buf)
+			e.addHistory(line)
+			return line, nil
+		case ctrl('C'):
+			io.WriteString(e.out, "^C\r\n")
+			return "", errInterrupt
+		case ctrl('D'):
+			if len(e.buf) == 0 {
+				io.WriteString(e.out, "\r\n")
+				return "", io.EOF
+			}
+			e.deleteAt(e.pos)
+		case ctrl('A'):
+			e.pos = 0
+		case ctrl('E'):
+			e.pos = len(e.buf)
+		case ctrl('B'):
+			e.moveTo(e.pos - 1)
+		case ctrl('F'):
+			e.moveTo(e.pos + 1)
+		case ctrl('H'), keyBackspace:
+			if e.pos > 0 {
+				e.pos--
+				e.deleteAt(e.pos)
+			}
+		case ctrl('K'):
+			e.buf = e.buf[:e.pos]
+		case ctrl('U'):
+			e.buf = append([]rune{}, e.buf[e.pos:]...)
+			e.pos = 0
+		case ctrl('W'):
+			start := e.wordStart()
+			e.buf = append(e.buf[:start], e.buf[e.pos:]...)
+			e.pos = start
+		case ctrl('L'):
+			io.WriteString(e.out, "\x1b[H\x1b[2J")
+		case ctrl('P'):
+			e.browseHistory(-1)
+		case ctrl('N'):
+			e.browseHistory(1)
+		case ctrl('R'):
+			if line, ok, err := e.search(); err != nil || ok {
+				return line, err
+			}
+		case '\t':
+			e.completeWord(lastTab)
+			tab = true
+		case keyEscape:
+			if err := e.escape(); err != nil {
+				return "", err
+			}
+		default:
+			if unicode.IsPrint(r) {
+				e.insert(r)
+			}
+		}
+
+		lastTab = tab
+		e.refresh()
+	}
+}
+
+// escape handles the key sequences sent for arrows, Home, End, Delete,
+// and Alt-b/Alt-f word movement.
+func (e *editor) escape() error {
+	r, _, err := e.in.ReadRune()
+	if err != nil {
+		return err
+	}
+
+	switch r {
+	case 'b':
+		e.pos = e.wordStart()
+		return nil
+	case 'f':
+		e.pos = e.wordEnd()
+		return nil
+	case '[', 'O':
+	default:
+		return nil
+	}
+
+	seq := ""
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return err
+		}
+		seq += string(r)
+		if r < '0' || r > '9' {
+			break
+		}
+	}
+
+	switch seq {
+	case "A":
+		e.browseHistory(-1)
+	case "B":
+		e.browseHistory(1)
+	case "C":
+		e.moveTo(e.pos + 1)
+	case "D":
+		e.moveTo(e.pos - 1)
+	case "H", "1~", "7~":
+		e.pos = 0
+	case "F", "4~", "8~":
+		e.pos = len(e.buf)
+	case "3~":
+		e.deleteAt(e.pos)
+	}
+
+	return nil
+}
+
+// refresh redraws the prompt and line, then places the cursor.
+func (e *editor) refresh() {
+	fmt.Fprintf(e.out, "\r%s%s\x1b[K", e.prompt, string(e.buf))
+	if n := len(e.buf) - e.pos; n > 0 {
+		fmt.Fprintf(e.out, "\x1b[%dD", n)
+	}
+}
+
+func (e *editor) insert(r rune) {
+	e.buf = append(e.buf, 0)
+	copy(e.buf[e.pos+1:], e.buf[e.pos:])
+	e.buf[e.pos] = r
+	e.pos++
+}
+
+func (e *editor) deleteAt(i int) {
+	if i >= 0 && i < len(e.buf) {
+		e.buf = append(e.buf[:i], e.buf[i+1:]...)
+	}
+}
+
+func (e *editor) moveTo(pos int) {
+	if pos >= 0 && pos <= len(e.buf) {
+		e.pos = pos
+	}
+}
+
+func (e *editor) setLine(line string) {
+	e.buf = []rune(line)
+	e.pos = len(e.buf)
+}
+
+// wordStart returns the start of the word before the cursor.
+func (e *editor) wordStart() int {
+	i := e.pos
+	for i > 0 && !isWordRune(e.buf[i-1]) {
+		i--
+	}
+	for i > 0 && isWordRune(e.buf[i-1]) {
+		i--
+	}
+	return i
+}
+
+// wordEnd returns the end of the word after the cursor.
+func (e *editor) wordEnd() int {
+	i := e.pos
+	for i < len(e.buf) && !isWordRune(e.buf[i]) {
+		i++
+	}
+	for i < len(e.buf) && isWordRune(e.buf[i]) {
+		i++
+	}
+	return i
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// browseHistory moves dir entries through the history, keeping the line
+// being edited so that browsing past the newest entry restores it.
+func (e *editor) browseHistory(dir int) {
+	next := e.histPos + dir
+	if next < 0 || next > len(e.history) {
+		return
+	}
+
+	if e.histPos == len(e.history) {
+		e.draft = string(e.buf)
+	}
+	e.histPos = next
+
+	if next == len(e.history) {
+		e.setLine(e.draft)
+	} else {
+		e.setLine(e.history[next])
+	}
+}
+
+// search runs an incremental reverse history search. It reports ok when
+// the user accepted a line with Enter; any other key leaves the match in
+// the editor.
+func (e *editor) search() (line string, ok bool, err error) {
+	query := []rune{}
+	original := string(e.buf)
+	match := len(e.history)
+
+	find := func(from int) {
+		if from >= len(e.history) {
+			from = len(e.history) - 1
+		}
+		for i := from; i >= 0; i-- {
+			if strings.Contains(e.history[i], string(query)) {
+				match = i
+				e.setLine(e.history[i])
+				return
+			}
+		}
+	}
+
+	for {
+		fmt.Fprintf(e.out, "\r(reverse-i-search)`%s': %s\x1b[K", string(query), string(e.buf))
+
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return "", false, err
+		}
+
+		switch r {
+		case ctrl('R'):
+			find(match - 1)
+		case ctrl('H'), keyBackspace:
+			if len(query) > 0 {
+				query = query[:len(query)-1]
+				find(len(e.history) - 1)
+			}
+		case ctrl('G'), ctrl('C'):
+			e.setLine(original)
+			return "", false, nil
+		case '\r', '\n':
+			e.refresh()
+			io.WriteString(e.out, "\r\n")
+			line := string(e.buf)
+			e.addHistory(line)
+			return line, true, nil
+		default:
+			if !unicode.IsPrint(r) {
+				return "", false, nil
+			}
+			query = append(query, r)
+			find(match)
+		}
+	}
+}
+
+// completeWord completes the word before the cursor to the longest prefix
+// shared by all candidates. When that adds nothing, a repeated Tab lists
+// the candidates.
+func (e *editor) completeWord(repeated bool) {
+	if e.complete == nil {
+		return
+	}
+
+	start, candidates := e.complete(string(e.buf[:e.pos]))
+	if len(candidates) == 0 {
+		io.WriteString(e.out, "\a")
+		return
+	}
+
+	word := e.buf[start:e.pos]
+	prefix := []rune(commonPrefix(candidates))
+	if len(prefix) > len(word) {
+		rest := append([]rune{}, e.buf[e.pos:]...)
+		e.buf = append(append(e.buf[:start], prefix...), rest...)
+		e.pos = start + len(prefix)
+		return
+	}
+
+	if !repeated || len(candidates) == 1 {
+		io.WriteString(e.out, "\a")
+		return
+	}
+
+	fmt.Fprintf(e.out, "\r\n%s\r\n", strings.Join(candidates, "  "))
+}
+
+func commonPrefix(words []string) string {
+	prefix := []rune(words[0])
+	for _, w := range words[1:] {
+		for !strings.HasPrefix(w, string(prefix)) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	return string(prefix)
+}
+
+// historyPath returns the history file in the user's config directory.
+func historyPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "mira", "history"), nil
+}
+
+// loadHistory reads the history file, keeping the newest historyLimit
+// entries and trimming the file when it has grown past twice that.
+func (e *editor) loadHistory() {
+	data, err := os.ReadFile(e.historyFile)
+	if err != nil {
+		return
+	}
+
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	if len(lines) > 2*historyLimit {
+		lines = lines[len(lines)-historyLimit:]
+		os.WriteFile(e.historyFile, []byte(strings.Join(lines, "\n")+"\n"), 0o600)
+	}
+	if len(lines) > historyLimit {
+		lines = lines[len(lines)-historyLimit:]
+	}
+
+	e.history = lines
+}
+
+func (e *editor) addHistory(line string) {
+	if strings.TrimSpace(line) == "" || len(e.history) > 0 && e.history[len(e.history)-1] == line {
+		return
+	}
+
+	e.history = append(e.history, line)
+	if len(e.history) > historyLimit {
+		e.history = e.history[1:]
+	}
+
+	if e.historyFile == "" {
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(e.historyFile), 0o700); err != nil {
+		return
+	}
+	f, err := os.OpenFile(e.historyFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	fmt.Fprintln(f, line)
+}
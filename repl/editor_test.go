@@ -0,0 +1,142 @@
+package repl
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"mira/object"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestEditor(input string) *editor {
+	return &editor{in: bufio.NewReader(strings.NewReader(input)), out: io.Discard}
+}
+
+func TestEditorKeys(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"abc\r", "abc"},
+		{"abc\x1b[D\x1b[DX\r", "aXbc"},
+		{"abc\x01X\x05Y\r", "XabcY"},
+		{"abc\x7f\x7fd\r", "ad"},
+		{"abc\x02\x02\x0b\r", "a"},
+		{"abc\x02\x15\r", "c"},
+		{"let foo = bar\x17baz\r", "let foo = baz"},
+		{"abc\x01\x1b[3~\r", "bc"},
+		{"one two\x1bbX\r", "one Xtwo"},
+		{"héllo\x1b[D\x1b[D\x1b[D\x7f\r", "hllo"},
+	}
+
+	for _, tt := range tests {
+		line, err := newTestEditor(tt.input).readLine("> ")
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", tt.input, err)
+		}
+		if line != tt.expected {
+			t.Errorf("%q: wrong line. expected=%q, got=%q", tt.input, tt.expected, line)
+		}
+	}
+}
+
+func TestEditorEndOfInput(t *testing.T) {
+	if _, err := newTestEditor("\x04").readLine("> "); err != io.EOF {
+		t.Errorf("Ctrl-D on empty line: expected io.EOF, got %v", err)
+	}
+	if _, err := newTestEditor("abc\x03").readLine("> "); err != errInterrupt {
+		t.Errorf("Ctrl-C: expected errInterrupt, got %v", err)
+	}
+}
+
+func TestEditorHistory(t *testing.T) {
+	e := newTestEditor("first\rsecond\r\x1b[A\x1b[A\r\x10\x10\x0e\r")
+
+	expected := []string{"first", "second", "first", "first"}
+	for _, want := range expected {
+		line, err := e.readLine("> ")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if line != want {
+			t.Errorf("wrong line. expected=%q, got=%q", want, line)
+		}
+	}
+
+	if strings.Join(e.history, ",") != "first,second,first" {
+		t.Errorf("wrong history. got=%q", e.history)
+	}
+}
+
+func TestEditorSearch(t *testing.T) {
+	e := newTestEditor("\x12len\r\x12a\x12\x12\x07x\r")
+	e.history = []string{"len(a)", "let b = 2", "puts(a)"}
+
+	if line, _ := e.readLine("> "); line != "len(a)" {
+		t.Errorf("wrong search result. got=%q", line)
+	}
+
+	// Ctrl-G restores the original (empty) line.
+	if line, _ := e.readLine("> "); line != "x" {
+		t.Errorf("wrong line after cancelled search. got=%q", line)
+	}
+}
+
+func TestEditorCompletion(t *testing.T) {
+	s := newSession(io.Discard, Evaluator)
+	s.env.Set("counter", &object.Integer{Value: 1})
+	s.env.Set("count", &object.Integer{Value: 2})
+
+	var out bytes.Buffer
+	e := newTestEditor("cou\t\r" + "coun\t\t\r" + "ret\t\r" + ":ma\t\r" + "fir\t(x)\r")
+	e.out = &out
+	e.complete = s.complete
+
+	expected := []string{"count", "count", "return", ":macros", "first(x)"}
+	for _, want := range expected {
+		line, err := e.readLine("> ")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if line != want {
+			t.Errorf("wrong completion. expected=%q, got=%q", want, line)
+		}
+	}
+
+	if !strings.Contains(out.String(), "\r\ncount  counter\r\n") {
+		t.Errorf("double Tab did not list candidates. got=%q", out.String())
+	}
+}
+
+func TestHistoryFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mira", "history")
+
+	e := newTestEditor("1 + 1\r\r  \rlen(x)\r")
+	e.historyFile = path
+	for i := 0; i < 4; i++ {
+		e.readLine("> ")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "1 + 1\nlen(x)\n" {
+		t.Errorf("wrong history file. got=%q", data)
+	}
+
+	loaded := &editor{historyFile: path}
+	loaded.loadHistory()
+	if strings.Join(loaded.history, ",") != "1 + 1,len(x)" {
+		t.Errorf("wrong loaded history. got=%q", loaded.history)
+	}
+}
+
+func TestPipedInputUsesScanner(t *testing.T) {
+	if _, ok := newLineReader(strings.NewReader("1\n"), io.Discard, nil).(*scannerReader); !ok {
+		t.Errorf("non-terminal input should be read with a scanner")
+	}
+}
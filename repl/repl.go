@@ -6,49 +6,393 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"mira/ast"
+	"mira/compiler"
 	"mira/evaluator"
 	"mira/lexer"
 	"mira/object"
 	"mira/parser"
+	"mira/token"
+	"mira/vm"
+	"os"
+	"sort"
+	"strings"
 )
 
-const PROMPT = "> "
+const (
+	PROMPT              = "> "
+	CONTINUATION_PROMPT = ".. "
+)
+
+const help = `Enter expressions to evaluate them. Input continues on the next line
+while brackets or strings are left open. Commands:
+  :load <file>    evaluate a file in the current session
+  :env            list the bindings in the session
+  :macros         list the defined macros
+  :ast <expr>     print the syntax tree of expr
+  :tokens <expr>  print the tokens of expr
+  :reset          discard all bindings and macros
+  :quit           leave the REPL
+`
+
+// Engine selects how the REPL executes input.
+type Engine int
+
+const (
+	Evaluator Engine = iota // Walk the syntax tree
+	VM                      // Compile to bytecode and run it on the VM
+)
+
+// session holds the state that persists between inputs.
+type session struct {
+	out      io.Writer
+	engine   Engine
+	env      *object.Env
+	macroEnv *object.Env
+	exec     *object.ExecContext // Streams of the programs run
+
+	// State of the VM engine
+	symbolTable *compiler.SymbolTable
+	constants   []object.Object
+	globals     []object.Object
+}
+
+func newSession(out io.Writer, engine Engine) *session {
+	s := &session{out: out, engine: engine}
+	s.exec = object.NewExecContext(strings.NewReader(""), out, out)
+	s.reset()
+	return s
+}
 
-func Start(in io.Reader, out io.Writer) {
-	scanner := bufio.NewScanner(in)
-	env := object.NewEnv()
-	macroEnv := object.NewEnv()
+func (s *session) reset() {
+	s.env = object.NewEnv()
+	s.macroEnv = object.NewEnv()
+
+	s.symbolTable = compiler.NewGlobalSymbolTable()
+	s.constants = []object.Object{}
+	s.globals = make([]object.Object, vm.GlobalsSize)
+}
+
+// Start runs the REPL until the input ends or the user quits. When in and
+// out are both terminals, lines are read with an interactive editor;
+// otherwise input is read line by line, as is needed for scripted use.
+func Start(in io.Reader, out io.Writer, engine Engine) {
+	s := newSession(out, engine)
+	reader := newLineReader(in, out, s.complete)
+	s.exec = object.NewExecContext(&programInput{reader: reader}, out, out)
 
 	for {
-		fmt.Fprintf(out, PROMPT)
-		scanned := scanner.Scan()
-		if !scanned {
+		source, ok := readInput(reader)
+		if !ok {
 			return
 		}
 
-		line := scanner.Text()
-		lex := lexer.New(line)
-		parser := parser.New(lex)
-		program := parser.ParseProgram()
+		if !s.handle(source) {
+			return
+		}
+	}
+}
+
+func newLineReader(in io.Reader, out io.Writer, complete completer) lineReader {
+	inFile, ok := in.(*os.File)
+	outFile, ok2 := out.(*os.File)
+	if !ok || !ok2 || !isTerminal(inFile.Fd()) || !isTerminal(outFile.Fd()) {
+		return &scannerReader{scanner: bufio.NewScanner(in), out: out}
+	}
+
+	e := &editor{
+		in:       bufio.NewReader(in),
+		out:      out,
+		raw:      func() (func(), error) { return makeRaw(inFile.Fd()) },
+		complete: complete,
+	}
+	if path, err := historyPath(); err == nil {
+		e.historyFile = path
+		e.loadHistory()
+	}
+
+	return e
+}
+
+// programInput is the standard input of programs run in the REPL. It
+// reads lines from the REPL's own input, without a prompt.
+type programInput struct {
+	reader  lineReader
+	pending []byte
+}
+
+func (in *programInput) Read(p []byte) (int, error) {
+	if len(in.pending) == 0 {
+		line, err := in.reader.readLine("")
+		if err == errInterrupt {
+			return 0, io.EOF
+		}
+		if err != nil {
+			return 0, err
+		}
+		in.pending = []byte(line + "\n")
+	}
+
+	n := copy(p, in.pending)
+	in.pending = in.pending[n:]
+	return n, nil
+}
+
+// readInput reads one line, then continuation lines for as long as the
+// input is incomplete. Ctrl-C discards the input read so far. It reports
+// false at end of input.
+func readInput(reader lineReader) (string, bool) {
+	var lines []string
+	prompt := PROMPT
 
-		if len(parser.Errors()) != 0 {
-			printParserErrors(out, parser.Errors())
+	for {
+		line, err := reader.readLine(prompt)
+		if err == errInterrupt {
+			lines, prompt = nil, PROMPT
 			continue
 		}
+		if err != nil {
+			return strings.Join(lines, "\n"), len(lines) > 0
+		}
+
+		lines = append(lines, line)
+		source := strings.Join(lines, "\n")
+		if isCommand(lines[0]) || !incomplete(source) {
+			return source, true
+		}
 
-		evaluator.DefineMacros(program, macroEnv)
-		expanded := evaluator.ExpandMacros(program, macroEnv)
-		evaluated := evaluator.Eval(expanded, env)
-		if evaluated != nil {
-			io.WriteString(out, evaluated.Inspect())
-			io.WriteString(out, "\n")
+		prompt = CONTINUATION_PROMPT
+	}
+}
+
+func isCommand(line string) bool {
+	return strings.HasPrefix(strings.TrimSpace(line), ":")
+}
+
+// incomplete reports whether source ends inside an open bracket, string,
+// interpolation or block comment.
+func incomplete(source string) bool {
+	unterminated := false
+
+	l := lexer.New(source)
+	l.OnError(func(_ token.Position, msg string) {
+		if strings.HasPrefix(msg, "unterminated") {
+			unterminated = true
+		}
+	})
+
+	depth := 0
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		switch tok.Type {
+		case token.LPAREN, token.LBRACKET, token.LBRACE, token.INTERP_HEAD:
+			depth++
+		case token.RPAREN, token.RBRACKET, token.RBRACE, token.INTERP_TAIL:
+			depth--
+		}
+	}
+
+	return unterminated || depth > 0
+}
+
+// handle evaluates one input or runs a command. It reports false when the
+// session should end.
+func (s *session) handle(source string) bool {
+	if !isCommand(source) {
+		s.eval("", source)
+		return true
+	}
+
+	command, arg, _ := strings.Cut(strings.TrimSpace(source), " ")
+	arg = strings.TrimSpace(arg)
+
+	switch command {
+	case ":quit", ":q":
+		return false
+	case ":help", ":h":
+		io.WriteString(s.out, help)
+	case ":reset":
+		s.reset()
+	case ":env":
+		for _, name := range s.bindings() {
+			fmt.Fprintf(s.out, "%s = %s\n", name, s.lookup(name).Inspect())
+		}
+	case ":macros":
+		for _, name := range s.macroEnv.Names() {
+			fmt.Fprintln(s.out, name)
 		}
+	case ":load":
+		s.load(arg)
+	case ":ast":
+		s.printAST(arg)
+	case ":tokens":
+		s.printTokens(arg)
+	default:
+		fmt.Fprintf(s.out, "unknown command %s, try :help\n", command)
+	}
+
+	return true
+}
+
+var commands = []string{":ast", ":env", ":help", ":load", ":macros", ":quit", ":reset", ":tokens"}
+
+// complete offers the commands, or the names bound in the session, the
+// builtins, the macros and the keywords that extend the word ending line.
+func (s *session) complete(line string) (int, []string) {
+	runes := []rune(line)
+	start := len(runes)
+	for start > 0 && isWordRune(runes[start-1]) {
+		start--
+	}
+	word := string(runes[start:])
+
+	var names []string
+	if start == 1 && runes[0] == ':' {
+		start, word, names = 0, line, commands
+	} else {
+		names = append(names, s.bindings()...)
+		names = append(names, object.BuiltinNames()...)
+		names = append(names, s.macroEnv.Names()...)
+		names = append(names, token.Keywords()...)
+	}
+
+	seen := map[string]bool{}
+	candidates := []string{}
+	for _, name := range names {
+		if strings.HasPrefix(name, word) && !seen[name] {
+			seen[name] = true
+			candidates = append(candidates, name)
+		}
+	}
+	sort.Strings(candidates)
+
+	return start, candidates
+}
+
+func (s *session) eval(filename, source string) {
+	p := parser.New(lexer.NewFile(filename, source))
+	program := p.ParseProgram()
+
+	if len(p.Errors()) != 0 {
+		printParserErrors(s.out, source, p.Diagnostics())
+		return
+	}
+
+	evaluator.DefineMacros(program, s.macroEnv)
+	expanded := evaluator.ExpandMacros(program, s.macroEnv)
+
+	var evaluated object.Object
+	if s.engine == VM {
+		comp := compiler.NewWithState(s.symbolTable, s.constants)
+		if err := comp.Compile(expanded); err != nil {
+			fmt.Fprintln(s.out, err)
+			return
+		}
+		bytecode := comp.Bytecode()
+		s.constants = bytecode.Constants
+		machine := vm.NewWithGlobalsStore(bytecode, s.globals)
+		machine.SetExecContext(s.exec)
+		evaluated = machine.Run()
+	} else {
+		c := evaluator.NewContext()
+		c.SetExecContext(s.exec)
+		evaluated = c.Eval(expanded, s.env)
+	}
+
+	if evaluated != nil {
+		io.WriteString(s.out, evaluated.Inspect())
+		io.WriteString(s.out, "\n")
+	}
+
+	if err, ok := evaluated.(*object.Error); ok && len(err.Stack) > 1 {
+		io.WriteString(s.out, err.StackTrace())
+	}
+}
+
+// bindings returns the names bound in the session, sorted.
+func (s *session) bindings() []string {
+	if s.engine != VM {
+		return s.env.Names()
+	}
+
+	names := []string{}
+	for _, name := range s.symbolTable.Bound() {
+		if s.lookup(name) != nil {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// lookup returns the value bound to name, or nil.
+func (s *session) lookup(name string) object.Object {
+	if s.engine != VM {
+		value, _ := s.env.Get(name)
+		return value
+	}
+
+	symbol, ok := s.symbolTable.Resolve(name)
+	if !ok || symbol.Scope != compiler.GlobalScope {
+		return nil
+	}
+	return s.globals[symbol.Index]
+}
+
+func (s *session) load(filename string) {
+	if filename == "" {
+		fmt.Fprintln(s.out, "usage: :load <file>")
+		return
+	}
+
+	source, err := os.ReadFile(filename)
+	if err != nil {
+		fmt.Fprintln(s.out, err)
+		return
+	}
+
+	s.eval(filename, string(source))
+}
+
+// printAST prints one node per line, indented by depth.
+func (s *session) printAST(source string) {
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+
+	if len(p.Errors()) != 0 {
+		printParserErrors(s.out, source, p.Diagnostics())
+		return
+	}
+
+	depth := -1
+	ast.Inspect(program, func(node ast.Node) bool {
+		if node == nil {
+			depth--
+			return false
+		}
+
+		if depth >= 0 {
+			name := strings.TrimPrefix(fmt.Sprintf("%T", node), "*ast.")
+			fmt.Fprintf(s.out, "%s%s %s\n", strings.Repeat("  ", depth), name, node.String())
+		}
+		depth++
+
+		return true
+	})
+}
+
+func (s *session) printTokens(source string) {
+	l := lexer.New(source)
+	l.SetMode(lexer.ScanComments)
+	l.OnError(func(pos token.Position, msg string) {
+		fmt.Fprintf(s.out, "%s: %s\n", pos, msg)
+	})
 
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		fmt.Fprintf(s.out, "%-6s %-12s %q\n", tok.Pos, tok.Type, tok.Literal)
 	}
 }
 
-func printParserErrors(out io.Writer, errors []string) {
-	for _, err := range errors {
-		io.WriteString(out, "\t"+err+"\n")
+func printParserErrors(out io.Writer, source string, diagnostics []parser.Diagnostic) {
+	for _, d := range diagnostics {
+		io.WriteString(out, d.Render(source))
 	}
 }
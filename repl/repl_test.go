@@ -0,0 +1,147 @@
+package repl
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func runSession(input string) string {
+	var out bytes.Buffer
+	Start(strings.NewReader(input), &out, Evaluator)
+	return out.String()
+}
+
+func TestMultiLineInput(t *testing.T) {
+	input := `let add = fn(a, b) {
+  a + b
+};
+add(1,
+  2)
+"a ${
+  1 }"
+`
+
+	expected := "> .. .. " +
+		"> .. 3\n" +
+		"> .. a 1\n" +
+		"> "
+
+	if got := runSession(input); got != expected {
+		t.Errorf("wrong output. expected=%q, got=%q", expected, got)
+	}
+}
+
+func TestIncomplete(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"1 + 2", false},
+		{"fn(x) {", true},
+		{"[1, (2", true},
+		{"}", false},
+		{`"abc`, true},
+		{"`raw", true},
+		{`"a ${b`, true},
+		{"/* comment", true},
+		{"let x = { 1: 2 };", false},
+	}
+
+	for _, tt := range tests {
+		if got := incomplete(tt.input); got != tt.expected {
+			t.Errorf("incomplete(%q) wrong. expected=%t, got=%t", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestCommands(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "lib.mira")
+	if err := os.WriteFile(file, []byte("let lib = 42;"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"let b = 2; let a = 1;\n:env\n", []string{"a = 1\nb = 2\n"}},
+		{"let m = macro(x) { x };\n:macros\n", []string{"> m\n"}},
+		{":load " + file + "\nlib\n", []string{"> > 42\n"}},
+		{"let a = 1;\n:reset\na\n", []string{"identifier not found: a"}},
+		{":ast -x * 2\n", []string{
+			"ExpressionStatement ((-x) * 2)\n" +
+				"  InfixExpression ((-x) * 2)\n" +
+				"    PrefixExpression (-x)\n" +
+				"      Identifier x\n" +
+				"    IntegerLiteral 2\n",
+		}},
+		{":tokens x // hi\n", []string{"1:1    IDENTIFIER   \"x\"\n1:3    COMMENT      \"// hi\"\n"}},
+		{":quit\n1\n", []string{"> "}},
+		{":bogus\n", []string{"unknown command :bogus"}},
+	}
+
+	for _, tt := range tests {
+		got := runSession(tt.input)
+		for _, expected := range tt.expected {
+			if !strings.Contains(got, expected) {
+				t.Errorf("%q: output missing %q. got=%q", tt.input, expected, got)
+			}
+		}
+	}
+
+	if got := runSession(":quit\n1\n"); got != "> " {
+		t.Errorf(":quit did not end the session. got=%q", got)
+	}
+}
+
+func TestVMEngine(t *testing.T) {
+	input := `let x = 40;
+let f = fn() { x + y };
+let y = 2;
+f()
+let m = macro(a) { quote(unquote(a) * 2) };
+m(21)
+:env
+-true
+:reset
+x
+quote(1)
+`
+
+	var out bytes.Buffer
+	Start(strings.NewReader(input), &out, VM)
+	got := out.String()
+
+	expected := []string{
+		"> > > > 42\n",
+		"> > 42\n",
+		"f = fn() {\n(x + y)\n}\nx = 40\ny = 2\n",
+		"ERROR: 1:1: unknown operator: -BOOL\n",
+		"ERROR: 1:1: identifier not found: x\n",
+		"1:1: quote is only supported by the evaluator\n",
+	}
+	for _, want := range expected {
+		if !strings.Contains(got, want) {
+			t.Errorf("output missing %q. got=%q", want, got)
+		}
+	}
+}
+
+func TestProgramInput(t *testing.T) {
+	input := `let name = input("name? ");
+Ann
+println("hi " + name)
+`
+
+	for _, engine := range []Engine{Evaluator, VM} {
+		var out bytes.Buffer
+		Start(strings.NewReader(input), &out, engine)
+
+		if expected := "> name? > hi Ann\nnull\n> "; out.String() != expected {
+			t.Errorf("engine %v: wrong output. expected=%q, got=%q", engine, expected, out.String())
+		}
+	}
+}
@@ -0,0 +1,15 @@
+// repl/term_other.go
+
+//go:build !linux && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd
+
+package repl
+
+import "errors"
+
+// Line editing is only supported on Unix terminals; elsewhere the REPL
+// reads plain lines.
+func isTerminal(fd uintptr) bool { return false }
+
+func makeRaw(fd uintptr) (func(), error) {
+	return nil, errors.New("raw terminal mode not supported")
+}
@@ -1,11 +1,48 @@
 // token/token.go
 package token
 
+import (
+	"fmt"
+	"sort"
+)
+
 type TokenType string
 
 type Token struct {
 	Type    TokenType
 	Literal string
+	Pos     Position // Position of the first character of the token
+	End     Position // Position immediately after the token
+}
+
+// Position describes a location in the source. Line and Column are 1-based,
+// Offset is the 0-based byte offset into the input.
+type Position struct {
+	Filename string
+	Offset   int
+	Line     int
+	Column   int
+}
+
+// IsValid reports whether the position has been set.
+func (p Position) IsValid() bool { return p.Line > 0 }
+
+// String formats the position as "file:line:col", dropping the file name
+// when there is none and returning "-" for an unset position.
+func (p Position) String() string {
+	if !p.IsValid() {
+		if p.Filename != "" {
+			return p.Filename
+		}
+		return "-"
+	}
+
+	s := fmt.Sprintf("%d:%d", p.Line, p.Column)
+	if p.Filename != "" {
+		s = p.Filename + ":" + s
+	}
+
+	return s
 }
 
 const (
@@ -15,7 +52,15 @@ const (
 	// Identifiers + literals
 	IDENTIFIER = "IDENTIFIER" // add, foobar, x, y, ...
 	INT        = "INT"        // 1343456
+	FLOAT      = "FLOAT"      // 3.14, 1e9
 	STRING     = "STRING"
+	COMMENT    = "COMMENT" // Only emitted in lexer.ScanComments mode
+
+	// Interpolated strings: "a ${x} b ${y} c" is lexed as INTERP_HEAD "a ",
+	// the tokens of x, INTERP_MID " b ", the tokens of y, INTERP_TAIL " c".
+	INTERP_HEAD = "INTERP_HEAD"
+	INTERP_MID  = "INTERP_MID"
+	INTERP_TAIL = "INTERP_TAIL"
 
 	// Operators
 	ASSIGN   = "="
@@ -23,6 +68,8 @@ const (
 	MINUS    = "-"
 	SLASH    = "/"
 	ASTERISK = "*"
+	PERCENT  = "%"
+	POWER    = "**"
 	BANG     = "!"
 	LT       = "<"
 	GT       = ">"
@@ -33,6 +80,28 @@ const (
 	DEC      = "--"
 	INC      = "++"
 
+	// Bitwise operators on integers
+	BIT_AND = "&"
+	BIT_OR  = "|"
+	BIT_XOR = "^"
+	BIT_NOT = "~"
+	SHL     = "<<"
+	SHR     = ">>"
+
+	// Logical operators, which only evaluate their right operand when
+	// the left one does not decide the result.
+	AND     = "&&"
+	OR      = "||"
+	NULLISH = "??"
+
+	// Assignment operators other than ASSIGN, which apply the operator
+	// to the current value and the right-hand side.
+	PLUS_ASSIGN     = "+="
+	MINUS_ASSIGN    = "-="
+	ASTERISK_ASSIGN = "*="
+	SLASH_ASSIGN    = "/="
+	PERCENT_ASSIGN  = "%="
+
 	// Delimiters
 	COMMA     = ","
 	SEMICOLON = ";"
@@ -53,17 +122,27 @@ const (
 	TRUE     = "TRUE"
 	FALSE    = "FALSE"
 	MACRO    = "MACRO"
+	WHILE    = "WHILE"
+	FOR      = "FOR"
+	IN       = "IN"
+	BREAK    = "BREAK"
+	CONTINUE = "CONTINUE"
 )
 
 var keywords = map[string]TokenType{
-	"fn":     FUNCTION,
-	"let":    LET,
-	"return": RETURN,
-	"if":     IF,
-	"else":   ELSE,
-	"true":   TRUE,
-	"false":  FALSE,
-	"macro":  MACRO,
+	"fn":       FUNCTION,
+	"let":      LET,
+	"return":   RETURN,
+	"if":       IF,
+	"else":     ELSE,
+	"true":     TRUE,
+	"false":    FALSE,
+	"macro":    MACRO,
+	"while":    WHILE,
+	"for":      FOR,
+	"in":       IN,
+	"break":    BREAK,
+	"continue": CONTINUE,
 }
 
 func LookupIdentifier(ident string) TokenType {
@@ -72,3 +151,13 @@ func LookupIdentifier(ident string) TokenType {
 	}
 	return IDENTIFIER
 }
+
+// Keywords returns the reserved words of the language, sorted.
+func Keywords() []string {
+	words := make([]string, 0, len(keywords))
+	for word := range keywords {
+		words = append(words, word)
+	}
+	sort.Strings(words)
+	return words
+}
@@ -0,0 +1,36 @@
+// vm/frame.go
+
+package vm
+
+import (
+	"mira/code"
+	"mira/object"
+)
+
+// Frame is the activation of a closure: its instruction pointer and the
+// stack index where its locals start.
+type Frame struct {
+	cl          *object.Closure
+	ip          int
+	basePointer int
+}
+
+func NewFrame(cl *object.Closure, basePointer int) *Frame {
+	return &Frame{cl: cl, ip: -1, basePointer: basePointer}
+}
+
+func (f *Frame) Instructions() code.Instructions {
+	return f.cl.Fn.Instructions
+}
+
+// name is the function name reported in stack traces.
+func (f *Frame) name() string {
+	switch {
+	case f.cl.Fn.Name != "":
+		return f.cl.Fn.Name
+	case f.cl.Name != "":
+		return f.cl.Name
+	default:
+		return "<anonymous>"
+	}
+}
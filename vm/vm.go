@@ -0,0 +1,863 @@
+// vm/vm.go
+
+package vm
+
+import (
+	"context"
+	"fmt"
+	"mira/code"
+	"mira/compiler"
+	"mira/object"
+	"strings"
+)
+
+const (
+	StackSize   = 1 << 16
+	GlobalsSize = 1 << 16
+	MaxFrames   = 1 << 14
+)
+
+// VM executes compiled bytecode. Runtime errors are returned as error
+// objects carrying the same position and stack trace the evaluator would
+// report.
+type VM struct {
+	constants   []object.Object
+	globals     []object.Object
+	globalNames []string
+
+	stack []object.Object
+	sp    int // Always points to the next free slot. Top of stack is stack[sp-1]
+
+	frames      []*Frame
+	framesIndex int
+
+	exec *object.ExecContext
+
+	unnamed int // Stores left that bind loop variables, which name no functions
+
+	ctx     context.Context
+	done    <-chan struct{}
+	limits  object.Limits
+	checked bool // Whether steps are checked against a budget or ctx
+	steps   int
+	memory  int64
+}
+
+func New(bytecode *compiler.Bytecode) *VM {
+	return NewWithGlobalsStore(bytecode, make([]object.Object, GlobalsSize))
+}
+
+// NewWithGlobalsStore returns a VM that reads and writes globals in s, so
+// that globals persist across programs compiled with the same symbol table.
+func NewWithGlobalsStore(bytecode *compiler.Bytecode, s []object.Object) *VM {
+	mainClosure := &object.Closure{Fn: bytecode.Main}
+
+	frames := make([]*Frame, MaxFrames)
+	frames[0] = NewFrame(mainClosure, 0)
+
+	return &VM{
+		constants:   bytecode.Constants,
+		globals:     s,
+		globalNames: bytecode.Globals,
+
+		stack: make([]object.Object, StackSize),
+		sp:    0,
+
+		frames:      frames,
+		framesIndex: 1,
+
+		exec: object.Stdio(),
+	}
+}
+
+// SetExecContext sets the streams builtins use, which are the process's
+// standard streams by default.
+func (vm *VM) SetExecContext(exec *object.ExecContext) {
+	vm.exec = exec
+}
+
+// SetLimits makes the VM stop with an error once ctx is done or it exceeds
+// limits, as an evaluator.Context does. Steps are instructions here, so a
+// program takes more of them on the VM than on the evaluator.
+func (vm *VM) SetLimits(ctx context.Context, limits object.Limits) {
+	vm.ctx, vm.done, vm.limits = ctx, ctx.Done(), limits
+	vm.checked = limits.MaxSteps > 0 || vm.done != nil
+}
+
+// Steps returns the number of instructions run so far.
+func (vm *VM) Steps() int {
+	return vm.steps
+}
+
+// Memory returns the approximate number of bytes allocated so far for
+// strings, arrays and hashes, counted as the evaluator counts them.
+func (vm *VM) Memory() int64 {
+	return vm.memory
+}
+
+func (vm *VM) currentFrame() *Frame {
+	return vm.frames[vm.framesIndex-1]
+}
+
+func (vm *VM) pushFrame(f *Frame) {
+	vm.frames[vm.framesIndex] = f
+	vm.framesIndex++
+}
+
+func (vm *VM) popFrame() *Frame {
+	vm.framesIndex--
+	return vm.frames[vm.framesIndex]
+}
+
+// Run executes the program and returns its value: the value of its last
+// expression statement or return, nil if it ends in any other statement,
+// or an *object.Error.
+func (vm *VM) Run() object.Object {
+	result, err := vm.run()
+	if err != nil {
+		vm.locate(err)
+		return err
+	}
+	return result
+}
+
+func (vm *VM) run() (object.Object, *object.Error) {
+	for {
+		frame := vm.currentFrame()
+		frame.ip++
+
+		vm.steps++
+		if vm.checked {
+			if err := vm.step(); err != nil {
+				return nil, err
+			}
+		}
+
+		ins := frame.Instructions()
+		ip := frame.ip
+		op := code.Opcode(ins[ip])
+
+		switch op {
+		case code.OpConstant:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+
+			// The evaluator creates a string each time it evaluates a
+			// literal, so loading one is charged the same.
+			constant := vm.constants[constIndex]
+			if err := vm.allocate(constant); err != nil {
+				return nil, err
+			}
+
+			if err := vm.push(constant); err != nil {
+				return nil, err
+			}
+
+		case code.OpPop:
+			vm.pop()
+
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpMod,
+			code.OpPow, code.OpBitAnd, code.OpBitOr, code.OpBitXor, code.OpShl, code.OpShr,
+			code.OpEqual, code.OpNotEqual, code.OpLess, code.OpGreater,
+			code.OpLessEqual, code.OpGreaterEqual:
+			right := vm.pop()
+			left := vm.pop()
+
+			result := object.Infix(left, infixOperators[op], right)
+			if result != left && result != right {
+				if err := vm.allocate(result); err != nil {
+					return nil, err
+				}
+			}
+
+			if err := vm.pushResult(result); err != nil {
+				return nil, err
+			}
+
+		case code.OpMinus:
+			if err := vm.pushResult(object.Prefix("-", vm.pop())); err != nil {
+				return nil, err
+			}
+
+		case code.OpBang:
+			if err := vm.pushResult(object.Prefix("!", vm.pop())); err != nil {
+				return nil, err
+			}
+
+		case code.OpBitNot:
+			if err := vm.pushResult(object.Prefix("~", vm.pop())); err != nil {
+				return nil, err
+			}
+
+		case code.OpTrue:
+			if err := vm.push(object.TRUE); err != nil {
+				return nil, err
+			}
+
+		case code.OpFalse:
+			if err := vm.push(object.FALSE); err != nil {
+				return nil, err
+			}
+
+		case code.OpNull:
+			if err := vm.push(object.NULL); err != nil {
+				return nil, err
+			}
+
+		case code.OpJump:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip = pos - 1
+
+		case code.OpJumpNotTruthy:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+
+			if !object.IsTruthy(vm.pop()) {
+				frame.ip = pos - 1
+			}
+
+		case code.OpAnd, code.OpOr, code.OpNullish:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+
+			if object.ShortCircuits(logicalOperators[op], vm.stack[vm.sp-1]) {
+				frame.ip = pos - 1
+			} else {
+				vm.pop()
+			}
+
+		case code.OpGetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+
+			value := vm.globals[globalIndex]
+			if value == nil {
+				// An unbound global may still name a builtin.
+				name := vm.globalNames[globalIndex]
+				builtin := object.GetBuiltinByName(name)
+				if builtin == nil {
+					return nil, notFound(name)
+				}
+				value = builtin
+			}
+
+			if err := vm.push(value); err != nil {
+				return nil, err
+			}
+
+		case code.OpSetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+
+			vm.globals[globalIndex] = vm.bind(vm.pop(), vm.globalNames[globalIndex])
+
+		case code.OpGetLocal:
+			localIndex := int(code.ReadUint8(ins[ip+1:]))
+			frame.ip += 1
+
+			value := vm.stack[frame.basePointer+localIndex]
+			if value == nil {
+				return nil, notFound(frame.cl.Fn.LocalNames[localIndex])
+			}
+
+			if err := vm.push(value); err != nil {
+				return nil, err
+			}
+
+		case code.OpSetLocal:
+			localIndex := int(code.ReadUint8(ins[ip+1:]))
+			frame.ip += 1
+
+			name := frame.cl.Fn.LocalNames[localIndex]
+			vm.stack[frame.basePointer+localIndex] = vm.bind(vm.pop(), name)
+
+		case code.OpGetBuiltin:
+			builtinIndex := code.ReadUint8(ins[ip+1:])
+			frame.ip += 1
+
+			if err := vm.push(object.Builtins[builtinIndex].Builtin); err != nil {
+				return nil, err
+			}
+
+		case code.OpArray:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+
+			elements := make([]object.Object, numElements)
+			copy(elements, vm.stack[vm.sp-numElements:vm.sp])
+			vm.sp = vm.sp - numElements
+
+			array := &object.Array{Elements: elements}
+			if err := vm.allocate(array); err != nil {
+				return nil, err
+			}
+
+			if err := vm.push(array); err != nil {
+				return nil, err
+			}
+
+		case code.OpHash:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+
+			hash, err := vm.buildHash(vm.sp-numElements, vm.sp)
+			if err != nil {
+				return nil, err
+			}
+			vm.sp = vm.sp - numElements
+
+			if err := vm.allocate(hash); err != nil {
+				return nil, err
+			}
+
+			if err := vm.push(hash); err != nil {
+				return nil, err
+			}
+
+		case code.OpIndex:
+			index := vm.pop()
+			left := vm.pop()
+
+			if err := vm.pushResult(object.Index(left, index)); err != nil {
+				return nil, err
+			}
+
+		case code.OpCall:
+			numArgs := int(code.ReadUint8(ins[ip+1:]))
+			frame.ip += 1
+
+			if err := vm.executeCall(numArgs); err != nil {
+				return nil, err
+			}
+
+		case code.OpTailCall:
+			numArgs := int(code.ReadUint8(ins[ip+1:]))
+			frame.ip += 1
+
+			if err := vm.executeTailCall(numArgs); err != nil {
+				return nil, err
+			}
+
+		case code.OpReturnValue:
+			returnValue := vm.pop()
+
+			frame := vm.popFrame()
+			if vm.framesIndex == 0 {
+				return returnValue, nil
+			}
+			vm.sp = frame.basePointer - 1
+
+			if err := vm.push(returnValue); err != nil {
+				return nil, err
+			}
+
+		case code.OpReturn:
+			frame := vm.popFrame()
+			if vm.framesIndex == 0 {
+				return nil, nil
+			}
+			vm.sp = frame.basePointer - 1
+
+			if err := vm.push(object.NULL); err != nil {
+				return nil, err
+			}
+
+		case code.OpClosure:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			numFree := int(code.ReadUint8(ins[ip+3:]))
+			frame.ip += 3
+
+			if err := vm.pushClosure(int(constIndex), numFree); err != nil {
+				return nil, err
+			}
+
+		case code.OpGetFree:
+			freeIndex := int(code.ReadUint8(ins[ip+1:]))
+			frame.ip += 1
+
+			cell := frame.cl.Free[freeIndex].(*object.Cell)
+			if cell.Value == nil {
+				return nil, notFound(frame.cl.Fn.FreeNames[freeIndex])
+			}
+
+			if err := vm.push(cell.Value); err != nil {
+				return nil, err
+			}
+
+		case code.OpSetFree:
+			freeIndex := int(code.ReadUint8(ins[ip+1:]))
+			frame.ip += 1
+
+			cell := frame.cl.Free[freeIndex].(*object.Cell)
+			cell.Value = vm.bind(vm.pop(), frame.cl.Fn.FreeNames[freeIndex])
+
+		case code.OpGetCell:
+			localIndex := int(code.ReadUint8(ins[ip+1:]))
+			frame.ip += 1
+
+			cell, ok := vm.stack[frame.basePointer+localIndex].(*object.Cell)
+			if !ok || cell.Value == nil {
+				return nil, notFound(frame.cl.Fn.LocalNames[localIndex])
+			}
+
+			if err := vm.push(cell.Value); err != nil {
+				return nil, err
+			}
+
+		case code.OpSetCell:
+			localIndex := int(code.ReadUint8(ins[ip+1:]))
+			frame.ip += 1
+
+			value := vm.bind(vm.pop(), frame.cl.Fn.LocalNames[localIndex])
+			slot := &vm.stack[frame.basePointer+localIndex]
+			if cell, ok := (*slot).(*object.Cell); ok {
+				cell.Value = value
+			} else {
+				*slot = &object.Cell{Value: value}
+			}
+
+		case code.OpLoadCell:
+			localIndex := int(code.ReadUint8(ins[ip+1:]))
+			frame.ip += 1
+
+			// A local that is not yet a cell is moved into a new one,
+			// which is empty if the local is not bound yet.
+			slot := &vm.stack[frame.basePointer+localIndex]
+			cell, ok := (*slot).(*object.Cell)
+			if !ok {
+				cell = &object.Cell{Value: *slot}
+				*slot = cell
+			}
+
+			if err := vm.push(cell); err != nil {
+				return nil, err
+			}
+
+		case code.OpLoadFreeCell:
+			freeIndex := int(code.ReadUint8(ins[ip+1:]))
+			frame.ip += 1
+
+			if err := vm.push(frame.cl.Free[freeIndex]); err != nil {
+				return nil, err
+			}
+
+		case code.OpTryGetLocal, code.OpTryGetFree:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			index := int(code.ReadUint8(ins[ip+3:]))
+			frame.ip += 3
+
+			var value object.Object
+			if op == code.OpTryGetLocal {
+				value = vm.stack[frame.basePointer+index]
+			} else {
+				value = frame.cl.Free[index]
+			}
+			if cell, ok := value.(*object.Cell); ok {
+				value = cell.Value
+			}
+			if value == nil {
+				break
+			}
+
+			if err := vm.push(value); err != nil {
+				return nil, err
+			}
+			frame.ip = pos - 1
+
+		case code.OpTrySetLocal:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			localIndex := int(code.ReadUint8(ins[ip+3:]))
+			frame.ip += 3
+
+			slot := &vm.stack[frame.basePointer+localIndex]
+			name := frame.cl.Fn.LocalNames[localIndex]
+			if cell, ok := (*slot).(*object.Cell); ok {
+				if cell.Value == nil {
+					break
+				}
+				cell.Value = vm.bind(vm.pop(), name)
+			} else if *slot == nil {
+				break
+			} else {
+				*slot = vm.bind(vm.pop(), name)
+			}
+			frame.ip = pos - 1
+
+		case code.OpTrySetFree:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			freeIndex := int(code.ReadUint8(ins[ip+3:]))
+			frame.ip += 3
+
+			cell := frame.cl.Free[freeIndex].(*object.Cell)
+			if cell.Value == nil {
+				break
+			}
+			cell.Value = vm.bind(vm.pop(), frame.cl.Fn.FreeNames[freeIndex])
+			frame.ip = pos - 1
+
+		case code.OpIncrement, code.OpDecrement:
+			operator := "++"
+			if op == code.OpDecrement {
+				operator = "--"
+			}
+
+			if err := vm.pushResult(object.IncDec(operator, vm.pop())); err != nil {
+				return nil, err
+			}
+
+		case code.OpDup:
+			if err := vm.push(vm.stack[vm.sp-1]); err != nil {
+				return nil, err
+			}
+
+		case code.OpDup2:
+			if err := vm.push(vm.stack[vm.sp-2]); err != nil {
+				return nil, err
+			}
+			if err := vm.push(vm.stack[vm.sp-2]); err != nil {
+				return nil, err
+			}
+
+		case code.OpGetIndexTarget:
+			index := vm.pop()
+			container := vm.pop()
+
+			if err := object.CheckIndexTarget(container, index); err != nil {
+				return nil, err
+			}
+
+			value := object.GetIndexTarget(container, index)
+			if value == nil {
+				return nil, &object.Error{Message: "key not found: " + index.Inspect()}
+			}
+
+			if err := vm.push(value); err != nil {
+				return nil, err
+			}
+
+		case code.OpCheckIndexTarget:
+			if err := object.CheckIndexTarget(vm.stack[vm.sp-2], vm.stack[vm.sp-1]); err != nil {
+				return nil, err
+			}
+
+		case code.OpSetIndex:
+			value := vm.pop()
+			index := vm.pop()
+			container := vm.pop()
+
+			if object.GetIndexTarget(container, index) == nil {
+				if err := vm.charge(object.PairSize); err != nil {
+					return nil, err
+				}
+			}
+			object.SetIndexTarget(container, index, value)
+
+			if err := vm.push(value); err != nil {
+				return nil, err
+			}
+
+		case code.OpInterpolate:
+			numParts := int(code.ReadUint16(ins[ip+1:]))
+			frame.ip += 2
+
+			var out strings.Builder
+			for _, part := range vm.stack[vm.sp-numParts : vm.sp] {
+				out.WriteString(part.Inspect())
+			}
+			vm.sp = vm.sp - numParts
+
+			str := &object.String{Value: out.String()}
+			if err := vm.allocate(str); err != nil {
+				return nil, err
+			}
+
+			if err := vm.push(str); err != nil {
+				return nil, err
+			}
+
+		case code.OpIter:
+			it, err := object.Iterate(vm.pop())
+			if err != nil {
+				return nil, err
+			}
+
+			if err := vm.push(it); err != nil {
+				return nil, err
+			}
+
+		case code.OpIterNext:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			numVars := int(code.ReadUint8(ins[ip+3:]))
+			frame.ip += 3
+
+			it := vm.stack[vm.sp-1].(*object.Iterator)
+			key, value, ok := it.Next()
+			if !ok {
+				frame.ip = pos - 1
+				break
+			}
+
+			// Each character of a string is a new string.
+			if it.Fresh() {
+				if err := vm.allocate(value); err != nil {
+					return nil, err
+				}
+			}
+
+			if numVars == 2 {
+				if err := vm.push(value); err != nil {
+					return nil, err
+				}
+				value = key
+			} else {
+				value = it.Single(key, value)
+			}
+
+			if err := vm.push(value); err != nil {
+				return nil, err
+			}
+			vm.unnamed = numVars
+
+		case code.OpError:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			frame.ip += 2
+
+			return nil, &object.Error{Message: vm.constants[constIndex].(*object.String).Value}
+
+		default:
+			return nil, &object.Error{Message: fmt.Sprintf("unknown opcode %d", op)}
+		}
+	}
+}
+
+var infixOperators = map[code.Opcode]string{
+	code.OpAdd:          "+",
+	code.OpSub:          "-",
+	code.OpMul:          "*",
+	code.OpDiv:          "/",
+	code.OpMod:          "%",
+	code.OpPow:          "**",
+	code.OpBitAnd:       "&",
+	code.OpBitOr:        "|",
+	code.OpBitXor:       "^",
+	code.OpShl:          "<<",
+	code.OpShr:          ">>",
+	code.OpEqual:        "==",
+	code.OpNotEqual:     "!=",
+	code.OpLess:         "<",
+	code.OpGreater:      ">",
+	code.OpLessEqual:    "<=",
+	code.OpGreaterEqual: ">=",
+}
+
+var logicalOperators = map[code.Opcode]string{
+	code.OpAnd:     "&&",
+	code.OpOr:      "||",
+	code.OpNullish: "??",
+}
+
+func (vm *VM) executeCall(numArgs int) *object.Error {
+	callee := vm.stack[vm.sp-1-numArgs]
+	switch callee := callee.(type) {
+	case *object.Closure:
+		return vm.callClosure(callee, numArgs)
+	case *object.Builtin:
+		return vm.callBuiltin(callee, numArgs)
+	default:
+		return &object.Error{Message: fmt.Sprintf("not a function: %s", callee.Type())}
+	}
+}
+
+// executeTailCall calls a closure in place of the current frame: the
+// callee and its arguments are moved down over the current function's
+// slots before the call. Other callees are called as usual.
+func (vm *VM) executeTailCall(numArgs int) *object.Error {
+	callee, ok := vm.stack[vm.sp-1-numArgs].(*object.Closure)
+	if !ok || numArgs != callee.Fn.NumParameters {
+		return vm.executeCall(numArgs)
+	}
+
+	frame := vm.popFrame()
+	copy(vm.stack[frame.basePointer-1:], vm.stack[vm.sp-1-numArgs:vm.sp])
+	vm.sp = frame.basePointer + numArgs
+
+	return vm.callClosure(callee, numArgs)
+}
+
+func (vm *VM) callClosure(cl *object.Closure, numArgs int) *object.Error {
+	if numArgs != cl.Fn.NumParameters {
+		return &object.Error{Message: fmt.Sprintf("wrong number of arguments: want=%d, got=%d",
+			cl.Fn.NumParameters, numArgs)}
+	}
+
+	basePointer := vm.sp - numArgs
+	if vm.framesIndex == MaxFrames || basePointer+cl.Fn.NumLocals >= StackSize ||
+		vm.limits.MaxDepth > 0 && vm.framesIndex > vm.limits.MaxDepth {
+		return stackDepthError()
+	}
+
+	// Clear the slots of the locals, which may hold values left by an
+	// earlier call.
+	for i := vm.sp; i < basePointer+cl.Fn.NumLocals; i++ {
+		vm.stack[i] = nil
+	}
+
+	vm.pushFrame(NewFrame(cl, basePointer))
+	vm.sp = basePointer + cl.Fn.NumLocals
+
+	return nil
+}
+
+func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) *object.Error {
+	args := make([]object.Object, numArgs)
+	copy(args, vm.stack[vm.sp-numArgs:vm.sp])
+
+	result := builtin.Fn(vm.exec, args...)
+	vm.sp = vm.sp - numArgs - 1
+
+	if result == nil {
+		result = object.NULL
+	}
+	if !builtin.Borrows {
+		if err := vm.allocate(result); err != nil {
+			return err
+		}
+	}
+	return vm.pushResult(result)
+}
+
+func (vm *VM) pushClosure(constIndex int, numFree int) *object.Error {
+	function := vm.constants[constIndex].(*object.CompiledFunction)
+
+	free := make([]object.Object, numFree)
+	copy(free, vm.stack[vm.sp-numFree:vm.sp])
+	vm.sp = vm.sp - numFree
+
+	return vm.push(&object.Closure{Fn: function, Free: free})
+}
+
+func (vm *VM) buildHash(startIndex, endIndex int) (object.Object, *object.Error) {
+	hashedPairs := make(map[object.HashKey]object.HashPair)
+
+	for i := startIndex; i < endIndex; i += 2 {
+		key := vm.stack[i]
+		value := vm.stack[i+1]
+
+		hashKey, ok := key.(object.Hashable)
+		if !ok {
+			return nil, &object.Error{Message: fmt.Sprintf("unusable as hashkey: %s", key.Type())}
+		}
+
+		hashedPairs[hashKey.HashKey()] = object.HashPair{Key: key, Value: value}
+	}
+
+	return &object.Hash{Pairs: hashedPairs}, nil
+}
+
+func (vm *VM) push(o object.Object) *object.Error {
+	if vm.sp >= StackSize {
+		return stackDepthError()
+	}
+
+	vm.stack[vm.sp] = o
+	vm.sp++
+
+	return nil
+}
+
+// pushResult pushes the result of an operation, or returns it if it is an
+// error.
+func (vm *VM) pushResult(o object.Object) *object.Error {
+	if err, ok := o.(*object.Error); ok {
+		return err
+	}
+	return vm.push(o)
+}
+
+func (vm *VM) pop() object.Object {
+	o := vm.stack[vm.sp-1]
+	vm.sp--
+	return o
+}
+
+// locate stamps err with the position of the failing instruction and the
+// call stack, unless it already carries a position.
+func (vm *VM) locate(err *object.Error) {
+	if err.Pos.IsValid() {
+		return
+	}
+
+	stack := make([]object.Frame, 0, vm.framesIndex)
+	for i := vm.framesIndex - 1; i >= 0; i-- {
+		f := vm.frames[i]
+		pos := f.cl.Fn.Positions.Lookup(f.ip)
+		stack = append(stack, object.Frame{Function: f.name(), Pos: pos})
+	}
+
+	err.Pos = stack[0].Pos
+	err.Stack = stack
+}
+
+// step fails once the step budget is spent or the context is done.
+func (vm *VM) step() *object.Error {
+	if vm.limits.MaxSteps > 0 && vm.steps > vm.limits.MaxSteps {
+		return limitError(object.ErrStepLimit)
+	}
+
+	if vm.done != nil {
+		select {
+		case <-vm.done:
+			return limitError(vm.ctx.Err())
+		default:
+		}
+	}
+	return nil
+}
+
+// allocate charges obj, which has just been created, against the memory
+// limit.
+func (vm *VM) allocate(obj object.Object) *object.Error {
+	if size := object.Size(obj); size > 0 {
+		return vm.charge(size)
+	}
+	return nil
+}
+
+// charge counts size more bytes as allocated, returning an error once the
+// memory limit is exceeded.
+func (vm *VM) charge(size int64) *object.Error {
+	vm.memory += size
+	if vm.limits.MaxMemory > 0 && vm.memory > vm.limits.MaxMemory {
+		return limitError(object.ErrMemoryLimit)
+	}
+	return nil
+}
+
+func limitError(cause error) *object.Error {
+	return &object.Error{Message: cause.Error(), Cause: cause}
+}
+
+// stackDepthError reports that the frames or the stack ran out, with the
+// same message and cause as the evaluator's depth limit.
+func stackDepthError() *object.Error {
+	return limitError(object.ErrStackDepth)
+}
+
+func notFound(name string) *object.Error {
+	return &object.Error{Message: "identifier not found: " + name}
+}
+
+// bind names an anonymous function after the variable it is first bound
+// to, as the evaluator does for let statements. Like the evaluator, it
+// leaves the functions bound to loop variables, which belong to the
+// iterable, unnamed.
+func (vm *VM) bind(value object.Object, name string) object.Object {
+	if vm.unnamed > 0 {
+		vm.unnamed--
+		return value
+	}
+	if cl, ok := value.(*object.Closure); ok && cl.Name == "" {
+		cl.Name = name
+	}
+	return value
+}
@@ -0,0 +1,205 @@
+package vm
+
+import (
+	"mira/ast"
+	"mira/compiler"
+	"mira/lexer"
+	"mira/object"
+	"mira/parser"
+	"testing"
+)
+
+type vmTestCase struct {
+	input    string
+	expected any
+}
+
+func TestIntegerArithmetic(t *testing.T) {
+	tests := []vmTestCase{
+		{"1", 1},
+		{"1 + 2", 3},
+		{"4 / 2 * 3 - 1", 5},
+		{"-5 + 10", 5},
+		{"9223372036854775807 + 1 - 1", 9223372036854775807},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestConditionals(t *testing.T) {
+	tests := []vmTestCase{
+		{"if (true) { 10 }", 10},
+		{"if (false) { 10 } else { 20 }", 20},
+		{"if (false) { 10 }", nil},
+		{"if (true) { let x = 1 }", nil},
+		{"if ((if (false) { 10 })) { 10 } else { 20 }", 20},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestProgramValue(t *testing.T) {
+	tests := []string{"", "let x = 1", "1; let y = 2;"}
+
+	for _, input := range tests {
+		if result := run(t, input); result != nil {
+			t.Errorf("%q: expected no value, got=%s", input, result.Inspect())
+		}
+	}
+}
+
+func TestClosures(t *testing.T) {
+	tests := []vmTestCase{
+		{"let add = fn(a) { fn(b) { a + b } }; add(1)(2)", 3},
+		{"let mk = fn() { let c = 0; fn() { ++c } }; let a = mk(); a(); a()", 2},
+		{"let mk = fn() { let c = 0; let inc = fn() { ++c }; inc(); inc(); c }; mk()", 2},
+		{"let f = fn() { let g = fn() { h() }; let h = fn() { 7 }; g() }; f()", 7},
+		{"let f = fn(n) { fn() { fn() { n } } }; f(5)()()", 5},
+		{`let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; fib(15)`, 610},
+		{`let f = fn() { let r = fn(n) { if (n == 0) { 0 } else { n + r(n - 1) } }; r(10) }; f()`, 55},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestBuiltinsAndGlobals(t *testing.T) {
+	tests := []vmTestCase{
+		{`len("four")`, 4},
+		{`let f = fn() { len([1]) }; let len = fn(x) { 42 }; f()`, 42},
+		{`push([1], 2)`, []int{1, 2}},
+		{`first([])`, nil},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestLoops(t *testing.T) {
+	tests := []vmTestCase{
+		{"let n = 0; while (n < 5) { n += 1 }; n", 5},
+		{"let s = 0; for (x in [1, 2, 3]) { s += x }; s", 6},
+		{"let f = fn() { let s = 0; for (i, x in [5, 6]) { s += i * x }; s }; f()", 6},
+		// Values left on the stack by a break or continue are popped, so
+		// long loops do not overflow it.
+		{"let n = 0; while (n < 100000) { n += 1; [1, 2, if (true) { continue } else { 0 }] }; n", 100000},
+		{"let n = 0; for (x in range(100000)) { n = n + [x, if (true) { continue }][0] }; n", 0},
+		{"let f = fn() { let n = 0; for (x in range(100000)) { for (y in [1]) { n += 1; [y, if (true) { break }] } }; n }; f()", 100000},
+		{"for (x in [1]) {}", nil},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestRuntimeErrors(t *testing.T) {
+	tests := []vmTestCase{
+		{"5 + true", "ERROR: 1:1: type mismatch: INTEGER + BOOL"},
+		{"x", "ERROR: 1:1: identifier not found: x"},
+		{"let f = fn() { y }; f()", "ERROR: 1:16: identifier not found: y"},
+		{"fn(a, b) { a }(1)", "ERROR: 1:1: wrong number of arguments: want=2, got=1"},
+		{"5(1)", "ERROR: 1:1: not a function: INTEGER"},
+		{"{fn() {}: 1}", "ERROR: 1:1: unusable as hashkey: FUNCTION"},
+		{"++5", "ERROR: 1:1: cannot assign to 5"},
+		{"let f = fn() { 1 + f() }; f()", "ERROR: 1:20: stack depth exceeded"},
+		{"for (x in true) {}", "ERROR: 1:11: not iterable: BOOL"},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestErrorStackTrace(t *testing.T) {
+	input := `let inner = fn(x) {
+  -x
+};
+let outer = fn() {
+  inner(true) + 1;
+};
+let run = fn(f) { [f()] };
+run(outer);
+run(fn() { 1 });`
+
+	errObj, ok := run(t, input).(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned")
+	}
+
+	trace := "inner\n\t2:3\nouter\n\t5:3\nrun\n\t7:20\n<main>\n\t8:1\n"
+	if errObj.StackTrace() != trace {
+		t.Errorf("wrong stack trace. got=%q, want=%q", errObj.StackTrace(), trace)
+	}
+}
+
+func TestGlobalsStore(t *testing.T) {
+	symbolTable := compiler.NewGlobalSymbolTable()
+	constants := []object.Object{}
+	globals := make([]object.Object, GlobalsSize)
+
+	inputs := []vmTestCase{
+		{"let x = 40; let f = fn() { x + y }", nil},
+		{"let y = 2; f()", 42},
+	}
+
+	for _, tt := range inputs {
+		comp := compiler.NewWithState(symbolTable, constants)
+		if err := comp.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		bytecode := comp.Bytecode()
+		constants = bytecode.Constants
+
+		result := NewWithGlobalsStore(bytecode, globals).Run()
+		testExpectedObject(t, tt.input, tt.expected, result)
+	}
+}
+
+func parse(input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	return p.ParseProgram()
+}
+
+func run(t *testing.T, input string) object.Object {
+	t.Helper()
+
+	comp := compiler.New()
+	if err := comp.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	return New(comp.Bytecode()).Run()
+}
+
+func runVmTests(t *testing.T, tests []vmTestCase) {
+	t.Helper()
+
+	for _, tt := range tests {
+		testExpectedObject(t, tt.input, tt.expected, run(t, tt.input))
+	}
+}
+
+func testExpectedObject(t *testing.T, input string, expected any, actual object.Object) {
+	t.Helper()
+
+	switch expected := expected.(type) {
+	case int:
+		integer, ok := actual.(*object.Integer)
+		if !ok || integer.Value != int64(expected) {
+			t.Errorf("%q: wrong result. want=%d, got=%v", input, expected, actual)
+		}
+	case []int:
+		array, ok := actual.(*object.Array)
+		if !ok || len(array.Elements) != len(expected) {
+			t.Errorf("%q: wrong result. want=%v, got=%v", input, expected, actual)
+			return
+		}
+		for i, want := range expected {
+			testExpectedObject(t, input, want, array.Elements[i])
+		}
+	case string:
+		if actual == nil || actual.Inspect() != expected {
+			t.Errorf("%q: wrong result. want=%q, got=%v", input, expected, actual)
+		}
+	case nil:
+		if actual != object.NULL && actual != nil {
+			t.Errorf("%q: expected null, got=%s", input, actual.Inspect())
+		}
+	}
+}